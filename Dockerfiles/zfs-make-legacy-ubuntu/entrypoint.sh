@@ -1,6 +0,0 @@
-#!/bin/bash
-
-zfs set mountpoint=legacy $POOLNAME/$DATASETNAME
-
-# Sleep for testing
-# sleep infinity
\ No newline at end of file
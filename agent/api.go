@@ -0,0 +1,309 @@
+/*
+Copyright 2023 thehamdiaz.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package agent implements the node agent that runs the ZFS commands of the migrations on every node,
+// and the client the controllers use to call it.
+//
+// The agent serves a gRPC API whose messages are the Go types below, encoded as JSON,
+// except for the chunks of the receive streams which travel as raw bytes.
+// There is no protobuf definition: these structs and their JSON field names are the wire contract
+// between the controllers and the agents of every node, renaming a field breaks the agents of the
+// other versions.
+package agent
+
+import (
+	"context"
+	"time"
+
+	"google.golang.org/grpc"
+)
+
+// ServiceName is the name of the node agent gRPC service
+const ServiceName = "zfsvolumemigrator.agent.v1.NodeAgent"
+
+// DefaultPort is the port the node agent listens on, on the network of its node
+const DefaultPort = 9550
+
+// SnapshotRequest takes a snapshot of a dataset
+type SnapshotRequest struct {
+	// Dataset is the full name of the dataset, pool included
+	Dataset string `json:"dataset"`
+	// Name is the name of the snapshot, without the dataset
+	Name string `json:"name"`
+}
+
+type SnapshotResponse struct {
+	// Snapshot is the full name of the snapshot, dataset@name
+	Snapshot string `json:"snapshot"`
+}
+
+// SendOptions maps to zfs send flags
+type SendOptions struct {
+	Compressed bool `json:"compressed,omitempty"`
+	LargeBlock bool `json:"largeBlock,omitempty"`
+	Embedded   bool `json:"embedded,omitempty"`
+	Raw        bool `json:"raw,omitempty"`
+	Properties bool `json:"properties,omitempty"`
+}
+
+// SSHDestination receives the stream with zfs receive run over ssh
+type SSHDestination struct {
+	User string `json:"user"`
+	Host string `json:"host"`
+	// PrivateKey is the identity used to log in to the destination
+	PrivateKey []byte `json:"privateKey"`
+	// KnownHosts are the known_hosts entries the host key of the destination is verified against,
+	// the send is refused when there are none unless InsecureSkipHostKeyCheck is set
+	KnownHosts []byte `json:"knownHosts,omitempty"`
+	// InsecureSkipHostKeyCheck accepts any host key of the destination when there are no known_hosts entries
+	InsecureSkipHostKeyCheck bool `json:"insecureSkipHostKeyCheck,omitempty"`
+}
+
+// SendRequest sends a snapshot to a destination dataset. Sends are identified by ID,
+// sending an ID that is already running or finished returns its status instead of sending again.
+type SendRequest struct {
+	ID string `json:"id"`
+	// Snapshot is the full name of the snapshot to send
+	Snapshot string `json:"snapshot"`
+	// Base is the snapshot the incremental stream starts from, the whole dataset is sent when it is empty
+	Base string `json:"base,omitempty"`
+	// ResumeToken continues an interrupted stream, it takes precedence over Snapshot and Base
+	ResumeToken string      `json:"resumeToken,omitempty"`
+	Options     SendOptions `json:"options,omitempty"`
+	// BandwidthLimit caps the stream in bytes per second, 0 means unlimited. It is applied to a running send too.
+	BandwidthLimit int64 `json:"bandwidthLimit,omitempty"`
+
+	// Pool and Dataset name the destination dataset
+	Pool    string `json:"pool"`
+	Dataset string `json:"dataset"`
+	// SSH or AgentAddress, the host:port of the node agent of the destination, picks the transport
+	SSH          *SSHDestination `json:"ssh,omitempty"`
+	AgentAddress string          `json:"agentAddress,omitempty"`
+}
+
+type SendState string
+
+const (
+	SendRunning   SendState = "Running"
+	SendSucceeded SendState = "Succeeded"
+	SendFailed    SendState = "Failed"
+)
+
+// FailureReason is the cause of a send that can't succeed by sending again
+type FailureReason string
+
+const (
+	// FailureUnsupportedFeature is a send option the destination pool lacks the feature for
+	FailureUnsupportedFeature FailureReason = "UnsupportedFeature"
+	// FailureHostKeyMismatch is a host key of the destination that doesn't match its known_hosts entries
+	FailureHostKeyMismatch FailureReason = "HostKeyMismatch"
+	// FailureCanceled is a send stopped by CancelSend
+	FailureCanceled FailureReason = "Canceled"
+)
+
+// SendStatus is the progress and outcome of a send
+type SendStatus struct {
+	ID             string    `json:"id"`
+	State          SendState `json:"state"`
+	EstimatedBytes int64     `json:"estimatedBytes,omitempty"`
+	BytesSent      int64     `json:"bytesSent,omitempty"`
+	BytesPerSecond int64     `json:"bytesPerSecond,omitempty"`
+	StartTime      time.Time `json:"startTime"`
+	CompletionTime time.Time `json:"completionTime,omitempty"`
+
+	// Error describes why a send failed
+	Error string `json:"error,omitempty"`
+	// Permanent is set when sending again can't succeed, such as when the destination lacks a pool feature
+	Permanent bool `json:"permanent,omitempty"`
+	// Reason is why a permanent failure is permanent
+	Reason FailureReason `json:"reason,omitempty"`
+	// ResumeToken continues the stream of a failed send from the last byte the destination received
+	ResumeToken string `json:"resumeToken,omitempty"`
+}
+
+// GetSendRequest returns the status of a send without starting it
+type GetSendRequest struct {
+	ID string `json:"id"`
+}
+
+// CancelSendRequest stops a running send, the destination keeps what it received as a partially received stream
+type CancelSendRequest struct {
+	ID string `json:"id"`
+}
+
+// ReceiveRequest opens a receive stream, the chunks of the stream follow it
+type ReceiveRequest struct {
+	Pool    string `json:"pool"`
+	Dataset string `json:"dataset"`
+	// Resume is set when the stream continues a partially received one, otherwise the partial state is discarded
+	Resume bool `json:"resume,omitempty"`
+	// Options are checked against the features of the pool before receiving
+	Options SendOptions `json:"options,omitempty"`
+}
+
+type ReceiveResponse struct{}
+
+// Chunk is a piece of a zfs send stream
+type Chunk struct {
+	Data []byte
+}
+
+// SetPropertyRequest sets the mountpoint of a dataset received by a migration
+type SetPropertyRequest struct {
+	Dataset  string `json:"dataset"`
+	Property string `json:"property"`
+	Value    string `json:"value"`
+}
+
+type SetPropertyResponse struct{}
+
+// ListRequest lists datasets or snapshots with some of their properties, like zfs list
+type ListRequest struct {
+	// Dataset restricts the list to a dataset, and its children when Recursive is set
+	Dataset   string `json:"dataset,omitempty"`
+	Recursive bool   `json:"recursive,omitempty"`
+	// Types are the zfs list types, filesystem when empty
+	Types      []string `json:"types,omitempty"`
+	Properties []string `json:"properties,omitempty"`
+}
+
+type ListResponse struct {
+	Datasets []Dataset `json:"datasets"`
+}
+
+type Dataset struct {
+	Name       string            `json:"name"`
+	Properties map[string]string `json:"properties,omitempty"`
+}
+
+// DestroyRequest removes what a migration received into a dataset, the other datasets are refused. A partially
+// received stream is always discarded, and destroying snapshots or a dataset that don't exist succeeds.
+type DestroyRequest struct {
+	// Dataset is the full name of the dataset, pool included
+	Dataset string `json:"dataset"`
+	// Snapshots are the names of the snapshots to destroy, without the dataset
+	Snapshots []string `json:"snapshots,omitempty"`
+	// All destroys the dataset itself with all its snapshots
+	All bool `json:"all,omitempty"`
+}
+
+type DestroyResponse struct{}
+
+// AuthorizeKeyRequest installs a public key in the authorized_keys of a user of the node,
+// restricted to the commands receiving into one dataset. The user must be a migration user of the agent.
+type AuthorizeKeyRequest struct {
+	// ID identifies the key, authorizing the same ID again replaces the key
+	ID   string `json:"id"`
+	User string `json:"user"`
+	// PublicKey is the key in the authorized_keys format
+	PublicKey string `json:"publicKey"`
+	Pool      string `json:"pool"`
+	// Datasets are the datasets of the pool the key may receive into
+	Datasets []string `json:"datasets"`
+}
+
+type AuthorizeKeyResponse struct{}
+
+// RevokeKeyRequest removes the key authorized with ID, revoking a key that isn't installed succeeds
+type RevokeKeyRequest struct {
+	ID   string `json:"id"`
+	User string `json:"user"`
+}
+
+type RevokeKeyResponse struct{}
+
+// NodeAgentServer is the API of the node agent
+type NodeAgentServer interface {
+	Snapshot(context.Context, *SnapshotRequest) (*SnapshotResponse, error)
+	Send(context.Context, *SendRequest) (*SendStatus, error)
+	GetSend(context.Context, *GetSendRequest) (*SendStatus, error)
+	CancelSend(context.Context, *CancelSendRequest) (*SendStatus, error)
+	Receive(*ReceiveStream) error
+	SetProperty(context.Context, *SetPropertyRequest) (*SetPropertyResponse, error)
+	List(context.Context, *ListRequest) (*ListResponse, error)
+	Destroy(context.Context, *DestroyRequest) (*DestroyResponse, error)
+	AuthorizeKey(context.Context, *AuthorizeKeyRequest) (*AuthorizeKeyResponse, error)
+	RevokeKey(context.Context, *RevokeKeyRequest) (*RevokeKeyResponse, error)
+}
+
+// ReceiveStream is the server side of a receive stream
+type ReceiveStream struct {
+	grpc.ServerStream
+}
+
+// Request returns the request opening the stream, it must be called before reading chunks
+func (s *ReceiveStream) Request() (*ReceiveRequest, error) {
+	request := &ReceiveRequest{}
+	return request, s.RecvMsg(request)
+}
+
+// Recv reads the next chunk of the stream, it returns io.EOF at the end of the stream
+func (s *ReceiveStream) Recv(chunk *Chunk) error {
+	return s.RecvMsg(chunk)
+}
+
+func (s *ReceiveStream) SendAndClose(response *ReceiveResponse) error {
+	return s.SendMsg(response)
+}
+
+var serviceDesc = grpc.ServiceDesc{
+	ServiceName: ServiceName,
+	HandlerType: (*NodeAgentServer)(nil),
+	Methods: []grpc.MethodDesc{
+		unaryMethod("Snapshot", NodeAgentServer.Snapshot),
+		unaryMethod("Send", NodeAgentServer.Send),
+		unaryMethod("GetSend", NodeAgentServer.GetSend),
+		unaryMethod("CancelSend", NodeAgentServer.CancelSend),
+		unaryMethod("SetProperty", NodeAgentServer.SetProperty),
+		unaryMethod("List", NodeAgentServer.List),
+		unaryMethod("Destroy", NodeAgentServer.Destroy),
+		unaryMethod("AuthorizeKey", NodeAgentServer.AuthorizeKey),
+		unaryMethod("RevokeKey", NodeAgentServer.RevokeKey),
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName: "Receive",
+			Handler: func(srv interface{}, stream grpc.ServerStream) error {
+				return srv.(NodeAgentServer).Receive(&ReceiveStream{stream})
+			},
+			ClientStreams: true,
+		},
+	},
+}
+
+func fullMethod(name string) string {
+	return "/" + ServiceName + "/" + name
+}
+
+// unaryMethod describes a unary method of the service from its NodeAgentServer method
+func unaryMethod[Request, Response any](name string, call func(NodeAgentServer, context.Context, *Request) (*Response, error)) grpc.MethodDesc {
+	return grpc.MethodDesc{
+		MethodName: name,
+		Handler: func(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+			request := new(Request)
+			if err := dec(request); err != nil {
+				return nil, err
+			}
+			if interceptor == nil {
+				return call(srv.(NodeAgentServer), ctx, request)
+			}
+			info := &grpc.UnaryServerInfo{Server: srv, FullMethod: fullMethod(name)}
+			return interceptor(ctx, request, info, func(ctx context.Context, request interface{}) (interface{}, error) {
+				return call(srv.(NodeAgentServer), ctx, request.(*Request))
+			})
+		},
+	}
+}
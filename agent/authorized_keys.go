@@ -0,0 +1,242 @@
+/*
+Copyright 2023 thehamdiaz.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package agent
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// keyCommentPrefix tags the authorized_keys lines managed by the agent, the key ID follows it
+const keyCommentPrefix = "zfs-volume-migrator:"
+
+// safeName matches the names that can be written in a forced command without quoting issues
+var safeName = regexp.MustCompile(`^[A-Za-z0-9_.:/-]+$`)
+
+// sshCommands are the commands a send runs on the destination over ssh,
+// a migration key is only allowed to run exactly these
+type sshCommands struct {
+	pool    string
+	dataset string
+}
+
+func (c sshCommands) receive() []string {
+	return []string{"zfs", "receive", "-s", "-u", "-o", migratedProperty + "=true", c.dataset}
+}
+
+func (c sshCommands) abortReceive() []string {
+	return []string{"zfs", "receive", "-A", c.dataset}
+}
+
+func (c sshCommands) resumeToken() []string {
+	return []string{"zfs", "get", "-H", "-o", "value", "receive_resume_token", c.dataset}
+}
+
+func (c sshCommands) listSnapshots() []string {
+	return []string{"zfs", "list", "-H", "-o", "name", "-t", "snapshot", "-d", "1", c.dataset}
+}
+
+// poolFeature returns the command printing the state of a pool feature
+func (c sshCommands) poolFeature(feature string) []string {
+	return []string{"zpool", "get", "-H", "-o", "value", "feature@" + feature, c.pool}
+}
+
+func (c sshCommands) all() [][]string {
+	commands := [][]string{c.receive(), c.abortReceive(), c.resumeToken(), c.listSnapshots()}
+	for _, flag := range sendFlags(SendOptions{Compressed: true, LargeBlock: true, Embedded: true, Raw: true}) {
+		commands = append(commands, c.poolFeature(flag.feature))
+	}
+	return commands
+}
+
+// forcedCommand returns the command of the authorized key, it runs the command requested by the client
+// only when it is one of the allowed ones for one of the datasets. ssh joins the arguments with spaces, so they are compared as is.
+func forcedCommand(datasets []sshCommands) string {
+	var allowed []string
+	seen := map[string]bool{}
+	for _, c := range datasets {
+		for _, command := range c.all() {
+			quoted := "'" + strings.Join(command, " ") + "'"
+			if !seen[quoted] {
+				seen[quoted] = true
+				allowed = append(allowed, quoted)
+			}
+		}
+	}
+	return fmt.Sprintf(`case "$SSH_ORIGINAL_COMMAND" in %s) exec $SSH_ORIGINAL_COMMAND ;; *) echo "command not allowed" >&2; exit 1 ;; esac`,
+		strings.Join(allowed, "|"))
+}
+
+// authorizedKeyLine returns the authorized_keys line of a migration key
+func authorizedKeyLine(request *AuthorizeKeyRequest) string {
+	var datasets []sshCommands
+	for _, dataset := range request.Datasets {
+		datasets = append(datasets, sshCommands{pool: request.Pool, dataset: request.Pool + "/" + dataset})
+	}
+	command := strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(forcedCommand(datasets))
+	return fmt.Sprintf(`restrict,command="%s" %s %s%s`, command, strings.TrimSpace(request.PublicKey), keyCommentPrefix, request.ID)
+}
+
+func (s *Server) AuthorizeKey(ctx context.Context, request *AuthorizeKeyRequest) (*AuthorizeKeyResponse, error) {
+	if len(request.Datasets) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "datasets is required")
+	}
+	if !s.migrationUser(request.User) {
+		return nil, status.Errorf(codes.PermissionDenied, "user %s isn't a migration user of the node agent", request.User)
+	}
+	for _, name := range append([]string{request.ID, request.User, request.Pool}, request.Datasets...) {
+		if !safeName.MatchString(name) {
+			return nil, status.Errorf(codes.InvalidArgument, "invalid id, user, pool or dataset %q", name)
+		}
+	}
+	fields := strings.Fields(request.PublicKey)
+	if len(fields) < 2 || !strings.HasPrefix(fields[0], "ssh-") {
+		return nil, status.Error(codes.InvalidArgument, "publicKey must be in the authorized_keys format")
+	}
+	request.PublicKey = fields[0] + " " + fields[1]
+
+	if err := s.updateAuthorizedKeys(request.User, request.ID, authorizedKeyLine(request)); err != nil {
+		return nil, err
+	}
+	s.Log.Info("key authorized", "id", request.ID, "user", request.User, "pool", request.Pool, "datasets", request.Datasets)
+	return &AuthorizeKeyResponse{}, nil
+}
+
+func (s *Server) RevokeKey(ctx context.Context, request *RevokeKeyRequest) (*RevokeKeyResponse, error) {
+	if !safeName.MatchString(request.ID) || !safeName.MatchString(request.User) {
+		return nil, status.Error(codes.InvalidArgument, "invalid id or user")
+	}
+
+	if err := s.updateAuthorizedKeys(request.User, request.ID, ""); err != nil {
+		return nil, err
+	}
+	s.Log.Info("key revoked", "id", request.ID, "user", request.User)
+	return &RevokeKeyResponse{}, nil
+}
+
+// migrationUser tells whether the migration keys may be authorized for the user
+func (s *Server) migrationUser(user string) bool {
+	for _, migrationUser := range s.MigrationUsers {
+		if user == migrationUser {
+			return true
+		}
+	}
+	return false
+}
+
+// updateAuthorizedKeys removes the key with the given ID from the authorized_keys of the user,
+// and adds line in its place when it isn't empty
+func (s *Server) updateAuthorizedKeys(user, id, line string) error {
+	s.keysMu.Lock()
+	defer s.keysMu.Unlock()
+
+	home, uid, gid, err := s.lookupUser(user)
+	if err != nil {
+		return err
+	}
+	if uid == 0 && line != "" {
+		return status.Error(codes.PermissionDenied, "a migration key can't be authorized for root")
+	}
+	dir := filepath.Join(s.HostRoot, home, ".ssh")
+	path := filepath.Join(dir, "authorized_keys")
+
+	content, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		if line == "" {
+			return nil
+		}
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			return status.Error(codes.Internal, err.Error())
+		}
+		if err := os.Chown(dir, uid, gid); err != nil {
+			return status.Error(codes.Internal, err.Error())
+		}
+	} else if err != nil {
+		return status.Error(codes.Internal, err.Error())
+	}
+
+	var lines []string
+	for _, existing := range strings.Split(string(content), "\n") {
+		if existing == "" || strings.HasSuffix(strings.TrimSpace(existing), " "+keyCommentPrefix+id) {
+			continue
+		}
+		lines = append(lines, existing)
+	}
+	if line != "" {
+		lines = append(lines, line)
+	}
+
+	// Replace the file at once so sshd never reads a partially written one
+	tmp, err := os.CreateTemp(dir, ".authorized_keys-")
+	if err != nil {
+		return status.Error(codes.Internal, err.Error())
+	}
+	defer os.Remove(tmp.Name())
+	_, err = tmp.WriteString(strings.Join(lines, "\n") + "\n")
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(tmp.Name(), 0600)
+	}
+	if err == nil {
+		err = os.Chown(tmp.Name(), uid, gid)
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		return status.Error(codes.Internal, err.Error())
+	}
+	return nil
+}
+
+// lookupUser returns the home directory, uid and gid of a user of the node from its passwd file
+func (s *Server) lookupUser(user string) (string, int, int, error) {
+	file, err := os.Open(filepath.Join(s.HostRoot, "etc", "passwd"))
+	if err != nil {
+		return "", 0, 0, status.Error(codes.Internal, err.Error())
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Split(scanner.Text(), ":")
+		if len(fields) < 6 || fields[0] != user {
+			continue
+		}
+		uid, uidErr := strconv.Atoi(fields[2])
+		gid, gidErr := strconv.Atoi(fields[3])
+		if uidErr != nil || gidErr != nil {
+			return "", 0, 0, status.Errorf(codes.Internal, "invalid passwd entry of user %s", user)
+		}
+		return fields[5], uid, gid, nil
+	}
+	if err := scanner.Err(); err != nil {
+		return "", 0, 0, status.Error(codes.Internal, err.Error())
+	}
+	return "", 0, 0, status.Errorf(codes.NotFound, "user %s doesn't exist on the node", user)
+}
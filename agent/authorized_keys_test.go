@@ -0,0 +1,187 @@
+/*
+Copyright 2023 thehamdiaz.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package agent
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/go-logr/logr"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// runForcedCommand runs the forced command the way sshd does, with fake zfs and zpool commands printing their arguments
+func runForcedCommand(t *testing.T, command, original string) (string, error) {
+	t.Helper()
+	dir := t.TempDir()
+	for _, name := range []string{"zfs", "zpool"} {
+		script := fmt.Sprintf("#!/bin/sh\necho \"%s $*\"\n", name)
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(script), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cmd := exec.Command("/bin/sh", "-c", command)
+	cmd.Dir = dir
+	cmd.Env = []string{"PATH=" + dir + string(os.PathListSeparator) + "/usr/bin:/bin", "SSH_ORIGINAL_COMMAND=" + original}
+	out, err := cmd.Output()
+	return string(out), err
+}
+
+// unquoteCommand returns the command option of an authorized_keys line as sshd reads it
+func unquoteCommand(t *testing.T, line string) string {
+	t.Helper()
+	const prefix = `restrict,command="`
+	if !strings.HasPrefix(line, prefix) {
+		t.Fatalf("line %q doesn't start with %q", line, prefix)
+	}
+	var command strings.Builder
+	rest := line[len(prefix):]
+	for i := 0; i < len(rest); i++ {
+		switch rest[i] {
+		case '\\':
+			i++
+			command.WriteByte(rest[i])
+		case '"':
+			return command.String()
+		default:
+			command.WriteByte(rest[i])
+		}
+	}
+	t.Fatalf("unterminated command in %q", line)
+	return ""
+}
+
+func TestForcedCommand(t *testing.T) {
+	line := authorizedKeyLine(&AuthorizeKeyRequest{
+		ID:        "migration",
+		User:      "migration",
+		PublicKey: "ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAI",
+		Pool:      "pool",
+		Datasets:  []string{"pvc-1", "pvc-2"},
+	})
+	command := unquoteCommand(t, line)
+	pvc1 := sshCommands{pool: "pool", dataset: "pool/pvc-1"}
+
+	tests := []struct {
+		name     string
+		original string
+		allowed  bool
+	}{
+		{name: "receive", original: strings.Join(pvc1.receive(), " "), allowed: true},
+		{name: "abort receive", original: strings.Join(pvc1.abortReceive(), " "), allowed: true},
+		{name: "resume token", original: strings.Join(pvc1.resumeToken(), " "), allowed: true},
+		{name: "list snapshots", original: strings.Join(pvc1.listSnapshots(), " "), allowed: true},
+		{name: "pool feature", original: strings.Join(pvc1.poolFeature("large_blocks"), " "), allowed: true},
+		{name: "second dataset", original: "zfs receive -s -u -o " + migratedProperty + "=true pool/pvc-2", allowed: true},
+		{name: "chained command", original: "zfs receive -s -u -o " + migratedProperty + "=true pool/pvc-1; rm -rf /"},
+		{name: "other dataset with the command separator", original: "zfs receive pool/other; rm -rf /"},
+		{name: "newline injection", original: "zfs receive -s -u -o " + migratedProperty + "=true pool/pvc-1\nrm -rf /"},
+		{name: "command substitution", original: "zfs receive -s -u -o " + migratedProperty + "=true pool/pvc-1$(rm -rf /)"},
+		{name: "quoted argument", original: "zfs receive -s -u -o " + migratedProperty + "=true 'pool/pvc-1'"},
+		{name: "dataset outside the migration", original: "zfs receive -s -u -o " + migratedProperty + "=true pool/other"},
+		{name: "dataset sharing the prefix", original: "zfs receive -s -u -o " + migratedProperty + "=true pool/pvc-10"},
+		{name: "child dataset", original: "zfs receive -s -u -o " + migratedProperty + "=true pool/pvc-1/child"},
+		{name: "receive without the migrated property", original: "zfs receive -s -u pool/pvc-1"},
+		{name: "destroy", original: "zfs destroy -r pool/pvc-1"},
+		{name: "other pool", original: "zpool get -H -o value feature@large_blocks other"},
+		{name: "empty command", original: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := runForcedCommand(t, command, tt.original)
+			if !tt.allowed {
+				if err == nil {
+					t.Errorf("command %q was allowed, ran %q", tt.original, out)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("command %q was refused: %v", tt.original, err)
+			}
+			if want := tt.original + "\n"; out != want {
+				t.Errorf("ran %q, want %q", out, want)
+			}
+		})
+	}
+}
+
+func TestAuthorizeKey(t *testing.T) {
+	// The key files are written for the user running the tests, root can't be a migration user
+	uid, gid := os.Getuid(), os.Getgid()
+	if uid == 0 {
+		uid, gid = 1000, 1000
+	}
+	valid := AuthorizeKeyRequest{
+		ID:        "migration",
+		User:      "migration",
+		PublicKey: "ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAI comment",
+		Pool:      "pool",
+		Datasets:  []string{"pvc-1"},
+	}
+
+	tests := []struct {
+		name   string
+		modify func(*AuthorizeKeyRequest)
+		want   codes.Code
+	}{
+		{name: "valid", modify: func(r *AuthorizeKeyRequest) {}, want: codes.OK},
+		{name: "not a migration user", modify: func(r *AuthorizeKeyRequest) { r.User = "other" }, want: codes.PermissionDenied},
+		{name: "root", modify: func(r *AuthorizeKeyRequest) { r.User = "root" }, want: codes.PermissionDenied},
+		{name: "no datasets", modify: func(r *AuthorizeKeyRequest) { r.Datasets = nil }, want: codes.InvalidArgument},
+		{name: "command in the dataset", modify: func(r *AuthorizeKeyRequest) { r.Datasets = []string{"pvc-1; rm -rf /"} }, want: codes.InvalidArgument},
+		{name: "quote in the dataset", modify: func(r *AuthorizeKeyRequest) { r.Datasets = []string{"pvc-1'"} }, want: codes.InvalidArgument},
+		{name: "newline in the pool", modify: func(r *AuthorizeKeyRequest) { r.Pool = "pool\nrm" }, want: codes.InvalidArgument},
+		{name: "options in the key", modify: func(r *AuthorizeKeyRequest) { r.PublicKey = `command="sh" ssh-ed25519 AAAA` }, want: codes.InvalidArgument},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := t.TempDir()
+			if err := os.MkdirAll(filepath.Join(root, "etc"), 0755); err != nil {
+				t.Fatal(err)
+			}
+			passwd := fmt.Sprintf("root:x:0:0:root:/root:/bin/sh\nmigration:x:%d:%d::/home/migration:/bin/sh\n", uid, gid)
+			if err := os.WriteFile(filepath.Join(root, "etc", "passwd"), []byte(passwd), 0644); err != nil {
+				t.Fatal(err)
+			}
+			s := &Server{Log: logr.Discard(), HostRoot: root, MigrationUsers: []string{"migration", "root"}}
+
+			request := valid
+			request.Datasets = append([]string(nil), valid.Datasets...)
+			tt.modify(&request)
+			_, err := s.AuthorizeKey(context.Background(), &request)
+			if got := status.Code(err); got != tt.want {
+				t.Fatalf("AuthorizeKey() = %v, want %v", err, tt.want)
+			}
+			if tt.want != codes.OK {
+				return
+			}
+			content, err := os.ReadFile(filepath.Join(root, "home", "migration", ".ssh", "authorized_keys"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := authorizedKeyLine(&request) + "\n"; string(content) != want {
+				t.Errorf("authorized_keys = %q, want %q", content, want)
+			}
+		})
+	}
+}
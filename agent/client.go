@@ -0,0 +1,159 @@
+/*
+Copyright 2023 thehamdiaz.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package agent
+
+import (
+	"context"
+	"io"
+	"sync"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+)
+
+// Client calls the node agent of one node
+type Client struct {
+	conn *grpc.ClientConn
+}
+
+// Dial returns a client of the node agent listening on address, the connection is established lazily
+func Dial(address string, clientCredentials credentials.TransportCredentials) (*Client, error) {
+	conn, err := grpc.Dial(address,
+		grpc.WithTransportCredentials(clientCredentials),
+		grpc.WithDefaultCallOptions(grpc.ForceCodec(codec{})))
+	if err != nil {
+		return nil, err
+	}
+	return &Client{conn: conn}, nil
+}
+
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
+
+func (c *Client) Snapshot(ctx context.Context, request *SnapshotRequest) (*SnapshotResponse, error) {
+	response := &SnapshotResponse{}
+	return response, c.conn.Invoke(ctx, fullMethod("Snapshot"), request, response)
+}
+
+func (c *Client) Send(ctx context.Context, request *SendRequest) (*SendStatus, error) {
+	response := &SendStatus{}
+	return response, c.conn.Invoke(ctx, fullMethod("Send"), request, response)
+}
+
+func (c *Client) GetSend(ctx context.Context, request *GetSendRequest) (*SendStatus, error) {
+	response := &SendStatus{}
+	return response, c.conn.Invoke(ctx, fullMethod("GetSend"), request, response)
+}
+
+func (c *Client) CancelSend(ctx context.Context, request *CancelSendRequest) (*SendStatus, error) {
+	response := &SendStatus{}
+	return response, c.conn.Invoke(ctx, fullMethod("CancelSend"), request, response)
+}
+
+func (c *Client) SetProperty(ctx context.Context, request *SetPropertyRequest) (*SetPropertyResponse, error) {
+	response := &SetPropertyResponse{}
+	return response, c.conn.Invoke(ctx, fullMethod("SetProperty"), request, response)
+}
+
+func (c *Client) List(ctx context.Context, request *ListRequest) (*ListResponse, error) {
+	response := &ListResponse{}
+	return response, c.conn.Invoke(ctx, fullMethod("List"), request, response)
+}
+
+func (c *Client) Destroy(ctx context.Context, request *DestroyRequest) (*DestroyResponse, error) {
+	response := &DestroyResponse{}
+	return response, c.conn.Invoke(ctx, fullMethod("Destroy"), request, response)
+}
+
+func (c *Client) AuthorizeKey(ctx context.Context, request *AuthorizeKeyRequest) (*AuthorizeKeyResponse, error) {
+	response := &AuthorizeKeyResponse{}
+	return response, c.conn.Invoke(ctx, fullMethod("AuthorizeKey"), request, response)
+}
+
+func (c *Client) RevokeKey(ctx context.Context, request *RevokeKeyRequest) (*RevokeKeyResponse, error) {
+	response := &RevokeKeyResponse{}
+	return response, c.conn.Invoke(ctx, fullMethod("RevokeKey"), request, response)
+}
+
+// Receive opens a receive stream, the stream is written to the returned writer and Close waits for zfs receive to finish
+func (c *Client) Receive(ctx context.Context, request *ReceiveRequest) (*ReceiveWriter, error) {
+	stream, err := c.conn.NewStream(ctx, &serviceDesc.Streams[0], fullMethod("Receive"))
+	if err != nil {
+		return nil, err
+	}
+	if err := stream.SendMsg(request); err != nil {
+		return nil, err
+	}
+	return &ReceiveWriter{stream: stream}, nil
+}
+
+// ReceiveWriter is the client side of a receive stream
+type ReceiveWriter struct {
+	stream grpc.ClientStream
+}
+
+func (w *ReceiveWriter) Write(data []byte) (int, error) {
+	// The message may still be queued when SendMsg returns while the caller reuses its buffer
+	chunk := &Chunk{Data: append([]byte(nil), data...)}
+	if err := w.stream.SendMsg(chunk); err == io.EOF {
+		// The receiver ended the stream, its status tells why
+		if err := w.stream.RecvMsg(&ReceiveResponse{}); err != nil {
+			return 0, err
+		}
+		return 0, io.ErrClosedPipe
+	} else if err != nil {
+		return 0, err
+	}
+	return len(data), nil
+}
+
+// Close ends the stream and returns the outcome of the receive
+func (w *ReceiveWriter) Close() error {
+	if err := w.stream.CloseSend(); err != nil {
+		return err
+	}
+	return w.stream.RecvMsg(&ReceiveResponse{})
+}
+
+// Clients keeps a client per node agent address so that the connections are reused across reconciliations
+type Clients struct {
+	credentials credentials.TransportCredentials
+	mu          sync.Mutex
+	clients     map[string]*Client
+}
+
+// NewClients returns the clients calling the node agents with the credentials, see TLSFiles.ClientCredentials
+func NewClients(clientCredentials credentials.TransportCredentials) *Clients {
+	return &Clients{credentials: clientCredentials, clients: map[string]*Client{}}
+}
+
+// Get returns the client of the node agent listening on address
+func (c *Clients) Get(address string) (*Client, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if client, found := c.clients[address]; found {
+		return client, nil
+	}
+	client, err := Dial(address, c.credentials)
+	if err != nil {
+		return nil, err
+	}
+	c.clients[address] = client
+	return client, nil
+}
@@ -0,0 +1,43 @@
+/*
+Copyright 2023 thehamdiaz.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package agent
+
+import (
+	"encoding/json"
+)
+
+// codec encodes the messages as JSON and the stream chunks as they are, so that the data isn't base64 encoded
+type codec struct{}
+
+func (codec) Marshal(v interface{}) ([]byte, error) {
+	if chunk, ok := v.(*Chunk); ok {
+		return chunk.Data, nil
+	}
+	return json.Marshal(v)
+}
+
+func (codec) Unmarshal(data []byte, v interface{}) error {
+	if chunk, ok := v.(*Chunk); ok {
+		chunk.Data = append(chunk.Data[:0], data...)
+		return nil
+	}
+	return json.Unmarshal(data, v)
+}
+
+func (codec) Name() string {
+	return "json"
+}
@@ -0,0 +1,278 @@
+/*
+Copyright 2023 thehamdiaz.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package agent
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/status"
+)
+
+// sshConnectionFailed is the exit code of ssh when it can't reach the destination
+const sshConnectionFailed = 255
+
+// hostKeyError is returned when the host key of the destination doesn't match its known_hosts entries, or when
+// there are none to verify it against
+type hostKeyError struct {
+	host   string
+	stderr string
+}
+
+func (e *hostKeyError) Error() string {
+	return fmt.Sprintf("host key verification of %s failed: %s", e.host, e.stderr)
+}
+
+// destination is the receiving end of a send
+type destination interface {
+	// hasSnapshot tells whether the destination dataset already has the snapshot of the given name
+	hasSnapshot(ctx context.Context, name string) (bool, error)
+	// receive starts zfs receive, the stream is written to the returned writer and Close returns the outcome
+	receive(ctx context.Context, resume bool) (io.WriteCloser, error)
+	// resumeToken returns the receive_resume_token of the destination dataset, empty when there is none
+	resumeToken(ctx context.Context) (string, error)
+	close() error
+}
+
+func newDestination(request *SendRequest, clientCredentials credentials.TransportCredentials) (destination, error) {
+	dataset := request.Pool + "/" + request.Dataset
+	if request.SSH != nil {
+		return newSSHDestination(request.SSH, request.Pool, dataset, request.Options)
+	}
+	client, err := Dial(request.AgentAddress, clientCredentials)
+	if err != nil {
+		return nil, err
+	}
+	return &agentDestination{client: client, request: request, dataset: dataset}, nil
+}
+
+// sshDestination runs zfs receive on the destination over ssh
+type sshDestination struct {
+	user    string
+	host    string
+	keyFile string
+	// knownHostsFile is empty when the host key isn't checked, which the request must have allowed
+	knownHostsFile string
+	commands       sshCommands
+	options        SendOptions
+}
+
+func newSSHDestination(ssh *SSHDestination, pool, dataset string, options SendOptions) (*sshDestination, error) {
+	if len(ssh.KnownHosts) == 0 && !ssh.InsecureSkipHostKeyCheck {
+		return nil, &hostKeyError{host: ssh.Host, stderr: "no known_hosts entries to verify the host key against"}
+	}
+	d := &sshDestination{
+		user:     ssh.User,
+		host:     ssh.Host,
+		commands: sshCommands{pool: pool, dataset: dataset},
+		options:  options,
+	}
+	var err error
+	if d.keyFile, err = writeTemp("identity-", ssh.PrivateKey); err != nil {
+		return nil, err
+	}
+	if len(ssh.KnownHosts) > 0 {
+		if d.knownHostsFile, err = writeTemp("known_hosts-", ssh.KnownHosts); err != nil {
+			d.close()
+			return nil, err
+		}
+	}
+	return d, nil
+}
+
+// writeTemp writes data to a new temporary file readable by the agent only and returns its name
+func writeTemp(pattern string, data []byte) (string, error) {
+	file, err := os.CreateTemp("", pattern)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	if _, err := file.Write(data); err != nil {
+		os.Remove(file.Name())
+		return "", err
+	}
+	return file.Name(), nil
+}
+
+// command returns the command running args on the destination
+func (d *sshDestination) command(ctx context.Context, args ...string) *exec.Cmd {
+	sshArgs := []string{"-i", d.keyFile, "-o", "BatchMode=yes"}
+	if d.knownHostsFile != "" {
+		sshArgs = append(sshArgs, "-o", "StrictHostKeyChecking=yes", "-o", "UserKnownHostsFile="+d.knownHostsFile)
+	} else {
+		sshArgs = append(sshArgs, "-o", "StrictHostKeyChecking=no")
+	}
+	sshArgs = append(sshArgs, d.user+"@"+d.host)
+	return exec.CommandContext(ctx, "ssh", append(sshArgs, args...)...)
+}
+
+// output runs args on the destination and returns their standard output
+func (d *sshDestination) output(ctx context.Context, args ...string) (string, error) {
+	out, err := output(d.command(ctx, args...))
+	return out, d.checkHostKey(err)
+}
+
+// checkHostKey turns the failure of ssh to verify the host key into a hostKeyError
+func (d *sshDestination) checkHostKey(err error) error {
+	cmdErr, ok := err.(*commandError)
+	if ok && cmdErr.exitCode == sshConnectionFailed && strings.Contains(cmdErr.stderr, "Host key verification failed") {
+		return &hostKeyError{host: d.host, stderr: cmdErr.stderr}
+	}
+	return err
+}
+
+func (d *sshDestination) hasSnapshot(ctx context.Context, name string) (bool, error) {
+	out, err := d.output(ctx, d.commands.listSnapshots()...)
+	if notExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	for _, snapshot := range strings.Split(out, "\n") {
+		if strings.TrimSpace(snapshot) == d.commands.dataset+"@"+name {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (d *sshDestination) receive(ctx context.Context, resume bool) (io.WriteCloser, error) {
+	err := checkPoolFeatures(d.commands.pool, d.options, func(feature string) (string, error) {
+		return d.output(ctx, d.commands.poolFeature(feature)...)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if !resume {
+		// Discard a partially received stream that can no longer be resumed, it fails when there is none
+		_, _ = d.output(ctx, d.commands.abortReceive()...)
+	}
+
+	writer, err := startReceive(d.command(ctx, d.commands.receive()...))
+	if err != nil {
+		return nil, err
+	}
+	return &sshReceiveWriter{receiveWriter: writer, destination: d}, nil
+}
+
+func (d *sshDestination) resumeToken(ctx context.Context) (string, error) {
+	out, err := d.output(ctx, d.commands.resumeToken()...)
+	if err != nil {
+		return "", err
+	}
+	return parseResumeToken(out), nil
+}
+
+func (d *sshDestination) close() error {
+	if d.knownHostsFile != "" {
+		os.Remove(d.knownHostsFile)
+	}
+	return os.Remove(d.keyFile)
+}
+
+// sshReceiveWriter reports the host key failures of the ssh running zfs receive
+type sshReceiveWriter struct {
+	*receiveWriter
+	destination *sshDestination
+}
+
+func (w *sshReceiveWriter) Close() error {
+	return w.destination.checkHostKey(w.receiveWriter.Close())
+}
+
+// agentDestination streams to the node agent of the destination node
+type agentDestination struct {
+	client  *Client
+	request *SendRequest
+	dataset string
+}
+
+func (d *agentDestination) hasSnapshot(ctx context.Context, name string) (bool, error) {
+	_, err := d.client.List(ctx, &ListRequest{Dataset: d.dataset + "@" + name, Types: []string{"snapshot"}})
+	if status.Code(err) == codes.NotFound {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (d *agentDestination) receive(ctx context.Context, resume bool) (io.WriteCloser, error) {
+	return d.client.Receive(ctx, &ReceiveRequest{
+		Pool:    d.request.Pool,
+		Dataset: d.request.Dataset,
+		Resume:  resume,
+		Options: d.request.Options,
+	})
+}
+
+func (d *agentDestination) resumeToken(ctx context.Context) (string, error) {
+	response, err := d.client.List(ctx, &ListRequest{Dataset: d.dataset, Properties: []string{"receive_resume_token"}})
+	if err != nil || len(response.Datasets) == 0 {
+		return "", err
+	}
+	return parseResumeToken(response.Datasets[0].Properties["receive_resume_token"]), nil
+}
+
+func (d *agentDestination) close() error {
+	return d.client.Close()
+}
+
+func parseResumeToken(value string) string {
+	value = strings.TrimSpace(value)
+	if value == "-" {
+		return ""
+	}
+	return value
+}
+
+// receiveWriter feeds the stream to a running zfs receive
+type receiveWriter struct {
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	stderr *bytes.Buffer
+}
+
+func startReceive(cmd *exec.Cmd) (*receiveWriter, error) {
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	w := &receiveWriter{cmd: cmd, stdin: stdin, stderr: &bytes.Buffer{}}
+	cmd.Stderr = w.stderr
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+func (w *receiveWriter) Write(data []byte) (int, error) {
+	return w.stdin.Write(data)
+}
+
+// Close ends the stream and waits for zfs receive to finish
+func (w *receiveWriter) Close() error {
+	w.stdin.Close()
+	return commandResult(w.cmd, w.cmd.Wait(), w.stderr)
+}
@@ -0,0 +1,69 @@
+/*
+Copyright 2023 thehamdiaz.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package agent
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestNewSSHDestination(t *testing.T) {
+	tests := []struct {
+		name             string
+		ssh              SSHDestination
+		wantHostKeyError bool
+		wantArgs         []string
+	}{
+		{
+			name:     "known hosts",
+			ssh:      SSHDestination{User: "migration", Host: "10.0.0.2", KnownHosts: []byte("10.0.0.2 ssh-ed25519 AAAA")},
+			wantArgs: []string{"StrictHostKeyChecking=yes"},
+		},
+		{
+			name:             "no known hosts",
+			ssh:              SSHDestination{User: "migration", Host: "10.0.0.2"},
+			wantHostKeyError: true,
+		},
+		{
+			name:     "host key check skipped",
+			ssh:      SSHDestination{User: "migration", Host: "10.0.0.2", InsecureSkipHostKeyCheck: true},
+			wantArgs: []string{"StrictHostKeyChecking=no"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, err := newSSHDestination(&tt.ssh, "pool", "pool/pvc-1", SendOptions{})
+			var hostKeyErr *hostKeyError
+			if got := errors.As(err, &hostKeyErr); got != tt.wantHostKeyError {
+				t.Fatalf("newSSHDestination() error = %v, want a host key error %t", err, tt.wantHostKeyError)
+			}
+			if err != nil {
+				return
+			}
+			defer d.close()
+
+			args := strings.Join(d.command(context.Background(), "true").Args, " ")
+			for _, want := range tt.wantArgs {
+				if !strings.Contains(args, want) {
+					t.Errorf("ssh args = %q, want %q", args, want)
+				}
+			}
+		})
+	}
+}
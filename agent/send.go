@@ -0,0 +1,281 @@
+/*
+Copyright 2023 thehamdiaz.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package agent
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	"golang.org/x/time/rate"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// chunkSize is the size of the reads from zfs send, and of the chunks of the receive streams
+	chunkSize = 256 * 1024
+	// rateWindow is the period over which the rate of a send is measured
+	rateWindow = 10 * time.Second
+	// resumeTokenTimeout bounds the lookup of the resume token after a failed send
+	resumeTokenTimeout = 30 * time.Second
+)
+
+// send is a send run by the agent in the background
+type send struct {
+	mu          sync.Mutex
+	status      SendStatus
+	limiter     *rate.Limiter
+	sampleTime  time.Time
+	sampleBytes int64
+	// cancel stops the send, done is closed once it is finished
+	cancel   context.CancelFunc
+	canceled bool
+	done     chan struct{}
+}
+
+func newSend(request *SendRequest, cancel context.CancelFunc) *send {
+	now := time.Now()
+	snd := &send{
+		status:     SendStatus{ID: request.ID, State: SendRunning, StartTime: now},
+		limiter:    rate.NewLimiter(rate.Inf, chunkSize),
+		sampleTime: now,
+		cancel:     cancel,
+		done:       make(chan struct{}),
+	}
+	snd.setBandwidthLimit(request.BandwidthLimit)
+	return snd
+}
+
+// stop cancels the send, it has no effect on a finished send
+func (snd *send) stop() {
+	snd.mu.Lock()
+	defer snd.mu.Unlock()
+	if snd.status.State == SendRunning {
+		snd.canceled = true
+		snd.cancel()
+	}
+}
+
+func (snd *send) isCanceled() bool {
+	snd.mu.Lock()
+	defer snd.mu.Unlock()
+	return snd.canceled
+}
+
+// setBandwidthLimit applies a limit in bytes per second, 0 removes the limit
+func (snd *send) setBandwidthLimit(limit int64) {
+	if limit <= 0 {
+		snd.limiter.SetLimit(rate.Inf)
+		return
+	}
+	snd.limiter.SetLimit(rate.Limit(limit))
+}
+
+func (snd *send) currentStatus() *SendStatus {
+	snd.mu.Lock()
+	defer snd.mu.Unlock()
+	current := snd.status
+	return &current
+}
+
+func (snd *send) finished(since time.Duration) bool {
+	snd.mu.Lock()
+	defer snd.mu.Unlock()
+	return snd.status.State != SendRunning && time.Since(snd.status.CompletionTime) > since
+}
+
+func (snd *send) setEstimatedBytes(bytes int64) {
+	snd.mu.Lock()
+	defer snd.mu.Unlock()
+	snd.status.EstimatedBytes = bytes
+}
+
+// add records bytes written to the destination and refreshes the rate once per window
+func (snd *send) add(bytes int) {
+	snd.mu.Lock()
+	defer snd.mu.Unlock()
+	snd.status.BytesSent += int64(bytes)
+	if elapsed := time.Since(snd.sampleTime); elapsed >= rateWindow {
+		snd.status.BytesPerSecond = int64(float64(snd.status.BytesSent-snd.sampleBytes) / elapsed.Seconds())
+		snd.sampleTime = time.Now()
+		snd.sampleBytes = snd.status.BytesSent
+	}
+}
+
+func (snd *send) finish(err error, resumeToken string) {
+	snd.mu.Lock()
+	defer snd.mu.Unlock()
+	snd.status.CompletionTime = time.Now()
+	snd.status.BytesPerSecond = 0
+	if err == nil {
+		snd.status.State = SendSucceeded
+		return
+	}
+	snd.status.State = SendFailed
+	snd.status.Error = err.Error()
+	snd.status.Reason = failureReason(err)
+	if snd.canceled {
+		snd.status.Reason = FailureCanceled
+	}
+	snd.status.Permanent = snd.status.Reason != ""
+	snd.status.ResumeToken = resumeToken
+}
+
+// failureReason returns why sending again can't fix the error, empty when it might
+func failureReason(err error) FailureReason {
+	var featureErr *unsupportedFeatureError
+	var hostKeyErr *hostKeyError
+	switch {
+	case errors.As(err, &featureErr), status.Code(err) == codes.FailedPrecondition:
+		return FailureUnsupportedFeature
+	case errors.As(err, &hostKeyErr):
+		return FailureHostKeyMismatch
+	}
+	return ""
+}
+
+// run sends the snapshot and records the outcome
+func (snd *send) run(ctx context.Context, log logr.Logger, request *SendRequest, clientCredentials credentials.TransportCredentials) {
+	defer close(snd.done)
+	defer snd.cancel()
+
+	dest, err := newDestination(request, clientCredentials)
+	if err != nil {
+		snd.finish(err, "")
+		return
+	}
+	defer dest.close()
+
+	err = snd.transfer(ctx, log, dest, request)
+	if err == nil {
+		log.Info("snapshot sent", "id", request.ID)
+		snd.finish(nil, "")
+		return
+	}
+	if snd.isCanceled() {
+		log.Info("send canceled", "id", request.ID)
+		snd.finish(err, "")
+		return
+	}
+
+	// Look up where the destination stopped so that the next send resumes the stream
+	tokenCtx, cancel := context.WithTimeout(ctx, resumeTokenTimeout)
+	defer cancel()
+	resumeToken, tokenErr := dest.resumeToken(tokenCtx)
+	if tokenErr != nil {
+		log.Error(tokenErr, "failed to get the resume token of the destination", "id", request.ID)
+		resumeToken = request.ResumeToken
+	}
+	log.Error(err, "failed to send snapshot", "id", request.ID, "resumable", resumeToken != "")
+	snd.finish(err, resumeToken)
+}
+
+func (snd *send) transfer(ctx context.Context, log logr.Logger, dest destination, request *SendRequest) error {
+	resume := request.ResumeToken != ""
+	if !resume {
+		// A previous send of the snapshot may have completed without its result being observed
+		name := request.Snapshot[strings.Index(request.Snapshot, "@")+1:]
+		received, err := dest.hasSnapshot(ctx, name)
+		if err != nil {
+			return err
+		}
+		if received {
+			log.Info("the destination already has the snapshot", "id", request.ID)
+			return nil
+		}
+	}
+
+	args := sendArgs(request)
+	estimate, err := exec.CommandContext(ctx, "zfs", append([]string{"send", "-nvP"}, args...)...).CombinedOutput()
+	if err != nil {
+		log.Error(err, "failed to estimate the size of the stream", "id", request.ID, "output", string(estimate))
+	}
+	snd.setEstimatedBytes(estimatedSize(string(estimate)))
+
+	writer, err := dest.receive(ctx, resume)
+	if err != nil {
+		return err
+	}
+
+	// zfs send gets its own context so that it can be stopped without losing the error of the destination
+	sendCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(sendCtx, "zfs", append([]string{"send"}, args...)...)
+	cmd.Stderr = &stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		writer.Close()
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		writer.Close()
+		return err
+	}
+
+	copyErr := snd.copy(ctx, writer, stdout)
+	if copyErr != nil {
+		// The destination stopped reading, stop zfs send instead of letting it block on the pipe
+		cancel()
+		_, _ = io.Copy(io.Discard, stdout)
+	}
+	sendErr := commandResult(cmd, cmd.Wait(), &stderr)
+	receiveErr := writer.Close()
+
+	// Report the side that failed first, the other one usually fails because of it
+	if copyErr == nil && sendErr != nil {
+		return sendErr
+	}
+	if receiveErr != nil {
+		return receiveErr
+	}
+	if sendErr != nil {
+		return sendErr
+	}
+	return copyErr
+}
+
+// copy writes the stream to the destination at the rate the bandwidth limit allows
+func (snd *send) copy(ctx context.Context, w io.Writer, r io.Reader) error {
+	buffer := make([]byte, chunkSize)
+	for {
+		n, err := r.Read(buffer)
+		if n > 0 {
+			if waitErr := snd.limiter.WaitN(ctx, n); waitErr != nil {
+				return waitErr
+			}
+			if _, writeErr := w.Write(buffer[:n]); writeErr != nil {
+				return writeErr
+			}
+			snd.add(n)
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
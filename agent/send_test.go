@@ -0,0 +1,334 @@
+/*
+Copyright 2023 thehamdiaz.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package agent
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+)
+
+// fakeZFS puts a zfs command first in the PATH: zfs send -nvP prints the estimate, zfs send prints the stream
+// or fails with the given stderr when it isn't empty
+func fakeZFS(t *testing.T, stream, stderr string) {
+	t.Helper()
+	dir := t.TempDir()
+	script := `#!/bin/sh
+if [ "$1" = send ] && [ "$2" = -nvP ]; then
+	printf 'full\tpool/data@snap\t1024\nsize\t1024\n'
+	exit 0
+fi
+if [ "$1" = send ]; then
+	if [ -n "$FAKE_ZFS_STDERR" ]; then
+		echo "$FAKE_ZFS_STDERR" >&2
+		exit 1
+	fi
+	printf '%s' "$FAKE_ZFS_STREAM"
+	exit 0
+fi
+exit 1
+`
+	if err := os.WriteFile(filepath.Join(dir, "zfs"), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	t.Setenv("FAKE_ZFS_STREAM", stream)
+	t.Setenv("FAKE_ZFS_STDERR", stderr)
+}
+
+// fakeDestination records what it receives
+type fakeDestination struct {
+	snapshots  map[string]bool
+	receiveErr error
+	closeErr   error
+
+	received   bytes.Buffer
+	receiving  bool
+	resumed    bool
+	checkedFor []string
+}
+
+func (d *fakeDestination) hasSnapshot(ctx context.Context, name string) (bool, error) {
+	d.checkedFor = append(d.checkedFor, name)
+	return d.snapshots[name], nil
+}
+
+func (d *fakeDestination) receive(ctx context.Context, resume bool) (io.WriteCloser, error) {
+	if d.receiveErr != nil {
+		return nil, d.receiveErr
+	}
+	d.receiving = true
+	d.resumed = resume
+	return d, nil
+}
+
+func (d *fakeDestination) Write(data []byte) (int, error) {
+	return d.received.Write(data)
+}
+
+func (d *fakeDestination) Close() error {
+	return d.closeErr
+}
+
+func (d *fakeDestination) resumeToken(ctx context.Context) (string, error) {
+	return "", nil
+}
+
+func (d *fakeDestination) close() error {
+	return nil
+}
+
+func TestTransfer(t *testing.T) {
+	errReceive := errors.New("cannot receive: out of space")
+
+	tests := []struct {
+		name        string
+		request     SendRequest
+		destination *fakeDestination
+		stream      string
+		stderr      string
+		wantErr     string
+		wantCheck   []string
+		wantStream  string
+		wantResumed bool
+	}{
+		{
+			name:        "sends the stream",
+			request:     SendRequest{ID: "send", Snapshot: "pool/data@snap"},
+			destination: &fakeDestination{},
+			stream:      "stream",
+			wantCheck:   []string{"snap"},
+			wantStream:  "stream",
+		},
+		{
+			name:        "skips a snapshot the destination already has",
+			request:     SendRequest{ID: "send", Snapshot: "pool/data@snap"},
+			destination: &fakeDestination{snapshots: map[string]bool{"snap": true}},
+			stream:      "stream",
+			wantCheck:   []string{"snap"},
+		},
+		{
+			name:        "resumes an interrupted stream",
+			request:     SendRequest{ID: "send", Snapshot: "pool/data@snap", ResumeToken: "token"},
+			destination: &fakeDestination{},
+			stream:      "rest of the stream",
+			wantStream:  "rest of the stream",
+			wantResumed: true,
+		},
+		{
+			name:        "reports the failure of zfs send",
+			request:     SendRequest{ID: "send", Snapshot: "pool/data@snap"},
+			destination: &fakeDestination{},
+			stderr:      "cannot open 'pool/data@snap': dataset does not exist",
+			wantCheck:   []string{"snap"},
+			wantErr:     "dataset does not exist",
+		},
+		{
+			name:        "reports the failure of the receive",
+			request:     SendRequest{ID: "send", Snapshot: "pool/data@snap"},
+			destination: &fakeDestination{closeErr: errReceive},
+			stream:      "stream",
+			wantCheck:   []string{"snap"},
+			wantStream:  "stream",
+			wantErr:     errReceive.Error(),
+		},
+		{
+			name:        "reports a receive that can't start",
+			request:     SendRequest{ID: "send", Snapshot: "pool/data@snap"},
+			destination: &fakeDestination{receiveErr: errReceive},
+			stream:      "stream",
+			wantCheck:   []string{"snap"},
+			wantErr:     errReceive.Error(),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fakeZFS(t, tt.stream, tt.stderr)
+			snd := newSend(&tt.request, func() {})
+
+			err := snd.transfer(context.Background(), logr.Discard(), tt.destination, &tt.request)
+			if tt.wantErr == "" && err != nil {
+				t.Fatalf("transfer() error = %v", err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Fatalf("transfer() error = %v, want %q", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(tt.destination.checkedFor, tt.wantCheck) {
+				t.Errorf("checked snapshots = %v, want %v", tt.destination.checkedFor, tt.wantCheck)
+			}
+			if got := tt.destination.received.String(); got != tt.wantStream {
+				t.Errorf("received %q, want %q", got, tt.wantStream)
+			}
+			if tt.destination.resumed != tt.wantResumed {
+				t.Errorf("resumed = %v, want %v", tt.destination.resumed, tt.wantResumed)
+			}
+			if tt.destination.receiving {
+				status := snd.currentStatus()
+				if status.EstimatedBytes != 1024 {
+					t.Errorf("estimated bytes = %d, want 1024", status.EstimatedBytes)
+				}
+				if status.BytesSent != int64(len(tt.wantStream)) {
+					t.Errorf("bytes sent = %d, want %d", status.BytesSent, len(tt.wantStream))
+				}
+			}
+		})
+	}
+}
+
+func TestCopyBandwidthLimit(t *testing.T) {
+	tests := []struct {
+		name  string
+		limit int64
+		// the first chunk is let through at once, the others wait for the limit
+		minDuration time.Duration
+		maxDuration time.Duration
+	}{
+		{
+			name:        "unlimited",
+			maxDuration: 200 * time.Millisecond,
+		},
+		{
+			name:        "limited",
+			limit:       8 * chunkSize,
+			minDuration: 200 * time.Millisecond,
+			maxDuration: 2 * time.Second,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stream := bytes.Repeat([]byte{1}, 3*chunkSize)
+			snd := newSend(&SendRequest{ID: "send", BandwidthLimit: tt.limit}, func() {})
+			var received bytes.Buffer
+
+			start := time.Now()
+			if err := snd.copy(context.Background(), &received, bytes.NewReader(stream)); err != nil {
+				t.Fatalf("copy() error = %v", err)
+			}
+			elapsed := time.Since(start)
+			if elapsed < tt.minDuration || elapsed > tt.maxDuration {
+				t.Errorf("copy() took %v, want between %v and %v", elapsed, tt.minDuration, tt.maxDuration)
+			}
+			if !bytes.Equal(received.Bytes(), stream) {
+				t.Errorf("received %d bytes, want the %d bytes of the stream", received.Len(), len(stream))
+			}
+			if got := snd.currentStatus().BytesSent; got != int64(len(stream)) {
+				t.Errorf("bytes sent = %d, want %d", got, len(stream))
+			}
+		})
+	}
+}
+
+func TestCopyStopsWhenCanceled(t *testing.T) {
+	snd := newSend(&SendRequest{ID: "send", BandwidthLimit: 1}, func() {})
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	err := snd.copy(ctx, io.Discard, bytes.NewReader(bytes.Repeat([]byte{1}, 2*chunkSize)))
+	if err == nil {
+		t.Fatal("copy() succeeded, want the bandwidth limit to hold the stream until it is canceled")
+	}
+	if got := snd.currentStatus().BytesSent; got != chunkSize {
+		t.Errorf("bytes sent = %d, want %d", got, chunkSize)
+	}
+}
+
+func TestSendArgs(t *testing.T) {
+	tests := []struct {
+		name    string
+		request SendRequest
+		want    []string
+	}{
+		{
+			name:    "full stream",
+			request: SendRequest{Snapshot: "pool/data@snap1"},
+			want:    []string{"pool/data@snap1"},
+		},
+		{
+			name:    "incremental stream",
+			request: SendRequest{Snapshot: "pool/data@snap2", Base: "pool/data@snap1"},
+			want:    []string{"-i", "pool/data@snap1", "pool/data@snap2"},
+		},
+		{
+			name: "flags in a fixed order before the snapshots",
+			request: SendRequest{Snapshot: "pool/data@snap2", Base: "pool/data@snap1",
+				Options: SendOptions{Compressed: true, LargeBlock: true, Embedded: true, Raw: true, Properties: true}},
+			want: []string{"-c", "-L", "-e", "-w", "-p", "-i", "pool/data@snap1", "pool/data@snap2"},
+		},
+		{
+			name:    "resumed stream carries its own flags",
+			request: SendRequest{Snapshot: "pool/data@snap2", Base: "pool/data@snap1", ResumeToken: "1-abc", Options: SendOptions{Raw: true}},
+			want:    []string{"-t", "1-abc"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := sendArgs(&tt.request); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("sendArgs() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEstimatedSize(t *testing.T) {
+	tests := []struct {
+		name string
+		out  string
+		want int64
+	}{
+		{
+			name: "full stream",
+			out:  "full\tpool/data@snap1\t4194304\nsize\t4194304\n",
+			want: 4194304,
+		},
+		{
+			name: "incremental stream",
+			out:  "incremental\tsnap1\tpool/data@snap2\t8192\nsize\t8192\n",
+			want: 8192,
+		},
+		{
+			name: "resumed stream",
+			out:  "resume token contents:\nnvlist version: 0\n\tobject = 0x2\nfull\tpool/data@snap1\t1048576\nsize\t1048576\n",
+			want: 1048576,
+		},
+		{
+			name: "no size",
+			out:  "cannot open 'pool/data@snap1': dataset does not exist\n",
+			want: 0,
+		},
+		{
+			name: "invalid size",
+			out:  "size\tunknown\n",
+			want: 0,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := estimatedSize(tt.out); got != tt.want {
+				t.Errorf("estimatedSize() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,339 @@
+/*
+Copyright 2023 thehamdiaz.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package agent
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/status"
+)
+
+// finishedSendRetention is how long the status of a finished send is kept for the controllers to observe it
+const finishedSendRetention = time.Hour
+
+// Server runs the ZFS commands of the node it is deployed on
+type Server struct {
+	Log logr.Logger
+	// HostRoot is where the root filesystem of the node is mounted, the authorized keys are written there
+	HostRoot string
+	// TLS is the certificate of the agent, it serves the API with it and calls the agents of the other nodes with it
+	TLS TLSFiles
+	// MigrationUsers are the users of the node the migration keys may be authorized for, none when empty
+	MigrationUsers []string
+
+	// clientCredentials are the credentials of the calls to the agents of the other nodes
+	clientCredentials credentials.TransportCredentials
+	// ctx is the lifetime of the server, the sends run in the background until it ends
+	ctx   context.Context
+	mu    sync.Mutex
+	sends map[string]*send
+	// keysMu serializes the changes to the authorized_keys files
+	keysMu sync.Mutex
+}
+
+func NewServer(log logr.Logger) *Server {
+	return &Server{Log: log, HostRoot: "/", ctx: context.Background(), sends: map[string]*send{}}
+}
+
+// Serve serves the API on address until ctx is done. The callers must present a certificate issued by the CA of the agent,
+// only the controller manager may call the methods changing the node.
+func (s *Server) Serve(ctx context.Context, address string) error {
+	serverCredentials, err := s.TLS.ServerCredentials()
+	if err != nil {
+		return fmt.Errorf("failed to load the certificate of the agent: %w", err)
+	}
+	if s.clientCredentials, err = s.TLS.ClientCredentials(); err != nil {
+		return fmt.Errorf("failed to load the certificate of the agent: %w", err)
+	}
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return err
+	}
+
+	server := grpc.NewServer(
+		grpc.Creds(serverCredentials),
+		grpc.ForceServerCodec(codec{}),
+		grpc.UnaryInterceptor(unaryAuthorizer),
+		grpc.StreamInterceptor(streamAuthorizer))
+	server.RegisterService(&serviceDesc, s)
+	s.ctx = ctx
+	go func() {
+		<-ctx.Done()
+		server.Stop()
+	}()
+
+	s.Log.Info("serving the node agent API", "address", address)
+	return server.Serve(listener)
+}
+
+func (s *Server) Snapshot(ctx context.Context, request *SnapshotRequest) (*SnapshotResponse, error) {
+	if request.Dataset == "" || request.Name == "" {
+		return nil, status.Error(codes.InvalidArgument, "dataset and name are required")
+	}
+
+	snapshot := request.Dataset + "@" + request.Name
+	if _, err := zfs(ctx, "snapshot", snapshot); err != nil {
+		// Taking a snapshot that already exists is a retry of a snapshot that succeeded
+		if cmdErr, ok := err.(*commandError); !ok || !strings.Contains(cmdErr.stderr, "already exists") {
+			return nil, zfsStatus(err)
+		}
+	}
+	s.Log.Info("snapshot taken", "snapshot", snapshot)
+	return &SnapshotResponse{Snapshot: snapshot}, nil
+}
+
+// Send starts a send in the background, or returns the status of the send with the same ID.
+// The bandwidth limit of the request is applied to a running send.
+func (s *Server) Send(ctx context.Context, request *SendRequest) (*SendStatus, error) {
+	if request.ID == "" || (request.Snapshot == "" && request.ResumeToken == "") || request.Pool == "" || request.Dataset == "" {
+		return nil, status.Error(codes.InvalidArgument, "id, snapshot, pool and dataset are required")
+	}
+	if (request.SSH == nil) == (request.AgentAddress == "") {
+		return nil, status.Error(codes.InvalidArgument, "exactly one of ssh and agentAddress is required")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for id, snd := range s.sends {
+		if snd.finished(finishedSendRetention) {
+			delete(s.sends, id)
+		}
+	}
+
+	snd, found := s.sends[request.ID]
+	if !found {
+		ctx, cancel := context.WithCancel(s.ctx)
+		snd = newSend(request, cancel)
+		s.sends[request.ID] = snd
+		s.Log.Info("sending snapshot", "id", request.ID, "snapshot", request.Snapshot, "base", request.Base,
+			"resumed", request.ResumeToken != "")
+		go snd.run(ctx, s.Log, request, s.clientCredentials)
+	} else {
+		snd.setBandwidthLimit(request.BandwidthLimit)
+	}
+	return snd.currentStatus(), nil
+}
+
+// GetSend returns the status of the send with the given ID, NotFound when there is none
+func (s *Server) GetSend(ctx context.Context, request *GetSendRequest) (*SendStatus, error) {
+	s.mu.Lock()
+	snd, found := s.sends[request.ID]
+	s.mu.Unlock()
+	if !found {
+		return nil, status.Errorf(codes.NotFound, "send %s not found", request.ID)
+	}
+	return snd.currentStatus(), nil
+}
+
+// CancelSend stops the send with the given ID and waits for it to finish, canceling a finished send returns its status
+func (s *Server) CancelSend(ctx context.Context, request *CancelSendRequest) (*SendStatus, error) {
+	s.mu.Lock()
+	snd, found := s.sends[request.ID]
+	s.mu.Unlock()
+	if !found {
+		return nil, status.Errorf(codes.NotFound, "send %s not found", request.ID)
+	}
+
+	snd.stop()
+	select {
+	case <-snd.done:
+	case <-ctx.Done():
+		return nil, status.FromContextError(ctx.Err()).Err()
+	}
+	return snd.currentStatus(), nil
+}
+
+// Receive pipes a stream sent by the node agent of another node into zfs receive
+func (s *Server) Receive(stream *ReceiveStream) error {
+	request, err := stream.Request()
+	if err != nil {
+		return err
+	}
+	if request.Pool == "" || request.Dataset == "" {
+		return status.Error(codes.InvalidArgument, "pool and dataset are required")
+	}
+	ctx := stream.Context()
+	dataset := request.Pool + "/" + request.Dataset
+
+	err = checkPoolFeatures(request.Pool, request.Options, func(feature string) (string, error) {
+		args := sshCommands{pool: request.Pool}.poolFeature(feature)
+		return output(exec.CommandContext(ctx, args[0], args[1:]...))
+	})
+	if err != nil {
+		return status.Error(codes.FailedPrecondition, err.Error())
+	}
+
+	// A stream can be received into a new dataset or into one received by a migration, the partially received
+	// stream of another dataset is left alone
+	if err := checkMigrated(ctx, dataset); err != nil && status.Code(err) != codes.NotFound {
+		return err
+	}
+
+	if !request.Resume {
+		// Discard a partially received stream that can no longer be resumed, it fails when there is none
+		_, _ = zfs(ctx, "receive", "-A", dataset)
+	}
+
+	args := sshCommands{pool: request.Pool, dataset: dataset}.receive()
+	writer, err := startReceive(exec.CommandContext(ctx, args[0], args[1:]...))
+	if err != nil {
+		return status.Error(codes.Internal, err.Error())
+	}
+
+	chunk := &Chunk{}
+	for {
+		err := stream.Recv(chunk)
+		if err == io.EOF {
+			break
+		}
+		if err == nil {
+			_, err = writer.Write(chunk.Data)
+		}
+		if err != nil {
+			// Let zfs receive exit before reporting, it keeps the partial state for the next attempt
+			if receiveErr := writer.Close(); receiveErr != nil {
+				return zfsStatus(receiveErr)
+			}
+			return err
+		}
+	}
+	if err := writer.Close(); err != nil {
+		return zfsStatus(err)
+	}
+
+	s.Log.Info("stream received", "dataset", dataset)
+	return stream.SendAndClose(&ReceiveResponse{})
+}
+
+// SetProperty sets a property of a dataset received by a migration, only its mountpoint can be changed
+func (s *Server) SetProperty(ctx context.Context, request *SetPropertyRequest) (*SetPropertyResponse, error) {
+	if request.Dataset == "" || request.Property == "" {
+		return nil, status.Error(codes.InvalidArgument, "dataset and property are required")
+	}
+	if request.Property != "mountpoint" {
+		return nil, status.Errorf(codes.PermissionDenied, "property %s can't be set", request.Property)
+	}
+	if err := checkMigrated(ctx, request.Dataset); err != nil {
+		return nil, err
+	}
+
+	if _, err := zfs(ctx, "set", request.Property+"="+request.Value, request.Dataset); err != nil {
+		return nil, zfsStatus(err)
+	}
+	s.Log.Info("property set", "dataset", request.Dataset, "property", request.Property, "value", request.Value)
+	return &SetPropertyResponse{}, nil
+}
+
+func (s *Server) List(ctx context.Context, request *ListRequest) (*ListResponse, error) {
+	types := request.Types
+	if len(types) == 0 {
+		types = []string{"filesystem"}
+	}
+	args := []string{"list", "-H", "-p", "-t", strings.Join(types, ","),
+		"-o", strings.Join(append([]string{"name"}, request.Properties...), ",")}
+	if request.Recursive {
+		args = append(args, "-r")
+	}
+	if request.Dataset != "" {
+		args = append(args, request.Dataset)
+	}
+
+	out, err := zfs(ctx, args...)
+	if err != nil {
+		return nil, zfsStatus(err)
+	}
+
+	response := &ListResponse{Datasets: []Dataset{}}
+	for _, line := range strings.Split(strings.TrimSpace(out), "\n") {
+		if line == "" {
+			continue
+		}
+		values := strings.Split(line, "\t")
+		dataset := Dataset{Name: values[0], Properties: map[string]string{}}
+		for i, property := range request.Properties {
+			if i+1 < len(values) {
+				dataset.Properties[property] = values[i+1]
+			}
+		}
+		response.Datasets = append(response.Datasets, dataset)
+	}
+	return response, nil
+}
+
+func (s *Server) Destroy(ctx context.Context, request *DestroyRequest) (*DestroyResponse, error) {
+	// A pool can't be destroyed this way
+	if !strings.Contains(request.Dataset, "/") || strings.ContainsAny(request.Dataset, "@%") {
+		return nil, status.Error(codes.InvalidArgument, "dataset must be a dataset of a pool")
+	}
+	for _, name := range request.Snapshots {
+		if name == "" || strings.ContainsAny(name, "@/,%") {
+			return nil, status.Errorf(codes.InvalidArgument, "invalid snapshot name %q", name)
+		}
+	}
+
+	// Only the datasets received by a migration are destroyed, a partially received new dataset doesn't exist yet
+	err := checkMigrated(ctx, request.Dataset)
+	if status.Code(err) == codes.NotFound {
+		_, _ = zfs(ctx, "receive", "-A", request.Dataset)
+		return &DestroyResponse{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// It fails when there is no partially received stream
+	_, _ = zfs(ctx, "receive", "-A", request.Dataset)
+
+	for _, name := range request.Snapshots {
+		snapshot := request.Dataset + "@" + name
+		_, err := zfs(ctx, "destroy", snapshot)
+		if cmdErr, ok := err.(*commandError); ok && strings.Contains(cmdErr.stderr, "could not find any snapshots") {
+			continue
+		}
+		if err != nil && !notExist(err) {
+			return nil, zfsStatus(err)
+		}
+		s.Log.Info("snapshot destroyed", "snapshot", snapshot)
+	}
+	if request.All {
+		if _, err := zfs(ctx, "destroy", "-r", request.Dataset); err != nil && !notExist(err) {
+			return nil, zfsStatus(err)
+		}
+		s.Log.Info("dataset destroyed", "dataset", request.Dataset)
+	}
+	return &DestroyResponse{}, nil
+}
+
+// zfsStatus maps the error of a zfs command to a gRPC status
+func zfsStatus(err error) error {
+	if notExist(err) {
+		return status.Error(codes.NotFound, err.Error())
+	}
+	return status.Error(codes.Internal, err.Error())
+}
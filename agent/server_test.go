@@ -0,0 +1,103 @@
+/*
+Copyright 2023 thehamdiaz.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package agent
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/go-logr/logr"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// fakeReceiveStream is a receive stream opened with the request and closed without chunks
+type fakeReceiveStream struct {
+	grpc.ServerStream
+	request *ReceiveRequest
+}
+
+func (s *fakeReceiveStream) Context() context.Context {
+	return context.Background()
+}
+
+func (s *fakeReceiveStream) RecvMsg(m interface{}) error {
+	if request, ok := m.(*ReceiveRequest); ok {
+		*request = *s.request
+		return nil
+	}
+	return io.EOF
+}
+
+func (s *fakeReceiveStream) SendMsg(m interface{}) error {
+	return nil
+}
+
+func TestReceive(t *testing.T) {
+	tests := []struct {
+		name      string
+		migrated  string
+		resume    bool
+		wantCode  codes.Code
+		wantAbort bool
+	}{
+		{name: "dataset received by a migration", migrated: "true\tlocal", wantAbort: true},
+		{name: "resumed stream", migrated: "true\tlocal", resume: true},
+		{name: "dataset of another application", migrated: "-\t-", wantCode: codes.PermissionDenied},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// The zfs command logs its arguments and receives the stream, zfs get prints the migrated property
+			dir := t.TempDir()
+			script := `#!/bin/sh
+echo "$@" >> "$(dirname "$0")/zfs.log"
+case "$1" in
+get)
+	printf '%s\n' "$FAKE_ZFS_MIGRATED"
+	;;
+receive)
+	[ "$2" = -A ] && exit 1
+	cat > /dev/null
+	;;
+esac
+`
+			if err := os.WriteFile(filepath.Join(dir, "zfs"), []byte(script), 0755); err != nil {
+				t.Fatal(err)
+			}
+			t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+			t.Setenv("FAKE_ZFS_MIGRATED", tt.migrated)
+
+			s := &Server{Log: logr.Discard()}
+			stream := &fakeReceiveStream{request: &ReceiveRequest{Pool: "pool", Dataset: "pvc-1", Resume: tt.resume}}
+			if err := s.Receive(&ReceiveStream{stream}); status.Code(err) != tt.wantCode {
+				t.Fatalf("Receive() = %v, want code %v", err, tt.wantCode)
+			}
+			log, err := os.ReadFile(filepath.Join(dir, "zfs.log"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if aborted := strings.Contains(string(log), "receive -A pool/pvc-1"); aborted != tt.wantAbort {
+				t.Errorf("zfs calls = %q, want the partial receive aborted %t", log, tt.wantAbort)
+			}
+		})
+	}
+}
@@ -0,0 +1,156 @@
+/*
+Copyright 2023 thehamdiaz.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package agent
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// AgentIdentity is the common name of the certificate of the node agents, they are reached on the node
+	// addresses so it is also the name their certificate is verified against
+	AgentIdentity = "node-agent"
+	// ManagerIdentity is the common name of the certificate the controller manager calls the node agents with
+	ManagerIdentity = "zfs-volume-migrator-manager"
+)
+
+// agentMethods are the methods a node agent may call on another one, to send a snapshot to it.
+// The other methods are reserved to the controller manager.
+var agentMethods = map[string]bool{
+	fullMethod("Receive"): true,
+	fullMethod("List"):    true,
+}
+
+// TLSFiles are the PEM files of the certificate presented to the peers and of the CA the peers are verified with
+type TLSFiles struct {
+	CertFile string
+	KeyFile  string
+	CAFile   string
+}
+
+// CertDir returns the files of a certificate Secret of cert-manager mounted in dir
+func CertDir(dir string) TLSFiles {
+	return TLSFiles{
+		CertFile: filepath.Join(dir, "tls.crt"),
+		KeyFile:  filepath.Join(dir, "tls.key"),
+		CAFile:   filepath.Join(dir, "ca.crt"),
+	}
+}
+
+// certificate loads the key pair, it is read again on each handshake so that a renewed certificate is picked up
+func (f TLSFiles) certificate() (*tls.Certificate, error) {
+	cert, err := tls.LoadX509KeyPair(f.CertFile, f.KeyFile)
+	if err != nil {
+		return nil, err
+	}
+	return &cert, nil
+}
+
+func (f TLSFiles) certPool() (*x509.CertPool, error) {
+	ca, err := os.ReadFile(f.CAFile)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(ca) {
+		return nil, fmt.Errorf("no certificate found in %s", f.CAFile)
+	}
+	return pool, nil
+}
+
+// ServerCredentials returns the credentials of the node agent API, the clients must present a certificate issued by the CA
+func (f TLSFiles) ServerCredentials() (credentials.TransportCredentials, error) {
+	pool, err := f.certPool()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := f.certificate(); err != nil {
+		return nil, err
+	}
+	return credentials.NewTLS(&tls.Config{
+		MinVersion: tls.VersionTLS12,
+		ClientAuth: tls.RequireAndVerifyClientCert,
+		ClientCAs:  pool,
+		GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			return f.certificate()
+		},
+	}), nil
+}
+
+// ClientCredentials returns the credentials the node agents are called with, their certificate is verified against the CA
+func (f TLSFiles) ClientCredentials() (credentials.TransportCredentials, error) {
+	pool, err := f.certPool()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := f.certificate(); err != nil {
+		return nil, err
+	}
+	return credentials.NewTLS(&tls.Config{
+		MinVersion: tls.VersionTLS12,
+		ServerName: AgentIdentity,
+		RootCAs:    pool,
+		GetClientCertificate: func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			return f.certificate()
+		},
+	}), nil
+}
+
+// authorize checks that the verified certificate of the caller may call the method
+func authorize(ctx context.Context, method string) error {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return status.Error(codes.Unauthenticated, "no peer")
+	}
+	tlsInfo, ok := p.AuthInfo.(credentials.TLSInfo)
+	if !ok || len(tlsInfo.State.VerifiedChains) == 0 || len(tlsInfo.State.VerifiedChains[0]) == 0 {
+		return status.Error(codes.Unauthenticated, "a verified client certificate is required")
+	}
+	switch identity := tlsInfo.State.VerifiedChains[0][0].Subject.CommonName; {
+	case identity == ManagerIdentity:
+		return nil
+	case identity == AgentIdentity && agentMethods[method]:
+		return nil
+	default:
+		return status.Errorf(codes.PermissionDenied, "%s may not call %s", identity, method)
+	}
+}
+
+func unaryAuthorizer(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	if err := authorize(ctx, info.FullMethod); err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+func streamAuthorizer(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	if err := authorize(stream.Context(), info.FullMethod); err != nil {
+		return err
+	}
+	return handler(srv, stream)
+}
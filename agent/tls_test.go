@@ -0,0 +1,104 @@
+/*
+Copyright 2023 thehamdiaz.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package agent
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// peerContext returns the context of a call made with a verified certificate of the given common name
+func peerContext(commonName string) context.Context {
+	var state tls.ConnectionState
+	if commonName != "" {
+		state.VerifiedChains = [][]*x509.Certificate{{{Subject: pkix.Name{CommonName: commonName}}}}
+	}
+	return peer.NewContext(context.Background(), &peer.Peer{AuthInfo: credentials.TLSInfo{State: state}})
+}
+
+func TestAuthorize(t *testing.T) {
+	tests := []struct {
+		name   string
+		ctx    context.Context
+		method string
+		want   codes.Code
+	}{
+		{
+			name:   "manager may destroy",
+			ctx:    peerContext(ManagerIdentity),
+			method: fullMethod("Destroy"),
+			want:   codes.OK,
+		},
+		{
+			name:   "agent may receive",
+			ctx:    peerContext(AgentIdentity),
+			method: fullMethod("Receive"),
+			want:   codes.OK,
+		},
+		{
+			name:   "agent may list",
+			ctx:    peerContext(AgentIdentity),
+			method: fullMethod("List"),
+			want:   codes.OK,
+		},
+		{
+			name:   "agent may not destroy",
+			ctx:    peerContext(AgentIdentity),
+			method: fullMethod("Destroy"),
+			want:   codes.PermissionDenied,
+		},
+		{
+			name:   "agent may not authorize keys",
+			ctx:    peerContext(AgentIdentity),
+			method: fullMethod("AuthorizeKey"),
+			want:   codes.PermissionDenied,
+		},
+		{
+			name:   "other identities may not call",
+			ctx:    peerContext("someone"),
+			method: fullMethod("List"),
+			want:   codes.PermissionDenied,
+		},
+		{
+			name:   "unverified certificate",
+			ctx:    peerContext(""),
+			method: fullMethod("List"),
+			want:   codes.Unauthenticated,
+		},
+		{
+			name:   "no peer",
+			ctx:    context.Background(),
+			method: fullMethod("List"),
+			want:   codes.Unauthenticated,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := status.Code(authorize(tt.ctx, tt.method)); got != tt.want {
+				t.Errorf("authorize() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,182 @@
+/*
+Copyright 2023 thehamdiaz.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package agent
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// migratedProperty is the user property set on the datasets received by the migrations,
+// the agent only destroys and changes those
+const migratedProperty = "zfs-volume-migrator:migrated"
+
+// commandError is the failure of a command, with what the command printed on stderr
+type commandError struct {
+	command  string
+	exitCode int
+	stderr   string
+}
+
+func (e *commandError) Error() string {
+	if e.stderr == "" {
+		return fmt.Sprintf("%s exited with code %d", e.command, e.exitCode)
+	}
+	return fmt.Sprintf("%s: %s", e.command, e.stderr)
+}
+
+// output runs a command and returns its standard output
+func output(cmd *exec.Cmd) (string, error) {
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	return string(out), commandResult(cmd, err, &stderr)
+}
+
+// commandResult adds what the command printed on stderr to the error of a failed command
+func commandResult(cmd *exec.Cmd, err error, stderr *bytes.Buffer) error {
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		name := cmd.Args[0]
+		if len(cmd.Args) > 1 {
+			name += " " + cmd.Args[1]
+		}
+		return &commandError{
+			command:  name,
+			exitCode: exitErr.ExitCode(),
+			stderr:   strings.TrimSpace(stderr.String()),
+		}
+	}
+	return err
+}
+
+func zfs(ctx context.Context, args ...string) (string, error) {
+	return output(exec.CommandContext(ctx, "zfs", args...))
+}
+
+// notExist tells whether a zfs command failed because the dataset doesn't exist
+func notExist(err error) bool {
+	cmdErr, ok := err.(*commandError)
+	return ok && strings.Contains(cmdErr.stderr, "does not exist")
+}
+
+// checkMigrated returns PermissionDenied unless the dataset was received by a migration, NotFound when it doesn't exist
+func checkMigrated(ctx context.Context, dataset string) error {
+	out, err := zfs(ctx, "get", "-H", "-o", "value,source", migratedProperty, dataset)
+	if err != nil {
+		return zfsStatus(err)
+	}
+	// The property is set on the dataset itself when receiving, it isn't inherited
+	if fields := strings.Fields(out); len(fields) != 2 || fields[0] != "true" || fields[1] != "local" {
+		return status.Errorf(codes.PermissionDenied, "dataset %s wasn't received by a migration", dataset)
+	}
+	return nil
+}
+
+// sendArgs returns the arguments of zfs send for a request, without the verbosity flags
+func sendArgs(request *SendRequest) []string {
+	if request.ResumeToken != "" {
+		// The token carries the flags of the interrupted stream
+		return []string{"-t", request.ResumeToken}
+	}
+
+	var args []string
+	for _, flag := range sendFlags(request.Options) {
+		args = append(args, flag.flag)
+	}
+	if request.Base != "" {
+		args = append(args, "-i", request.Base)
+	}
+	return append(args, request.Snapshot)
+}
+
+// sendFlag is a zfs send flag and the pool feature the destination needs to receive it
+type sendFlag struct {
+	flag    string
+	feature string
+}
+
+func sendFlags(options SendOptions) []sendFlag {
+	var flags []sendFlag
+	if options.Compressed {
+		flags = append(flags, sendFlag{"-c", "lz4_compress"})
+	}
+	if options.LargeBlock {
+		flags = append(flags, sendFlag{"-L", "large_blocks"})
+	}
+	if options.Embedded {
+		flags = append(flags, sendFlag{"-e", "embedded_data"})
+	}
+	if options.Raw {
+		flags = append(flags, sendFlag{"-w", "encryption"})
+	}
+	if options.Properties {
+		flags = append(flags, sendFlag{"-p", ""})
+	}
+	return flags
+}
+
+// unsupportedFeatureError is returned when the destination pool can't receive a stream sent with some flag
+type unsupportedFeatureError struct {
+	flag    string
+	feature string
+	pool    string
+}
+
+func (e *unsupportedFeatureError) Error() string {
+	return fmt.Sprintf("zfs send %s requires the %s feature which is not enabled on the destination pool %s", e.flag, e.feature, e.pool)
+}
+
+// checkPoolFeatures verifies that the pool has the features the send options rely on,
+// poolFeature returns the state of a feature as printed by zpool get
+func checkPoolFeatures(pool string, options SendOptions, poolFeature func(feature string) (string, error)) error {
+	for _, flag := range sendFlags(options) {
+		if flag.feature == "" {
+			continue
+		}
+		state, err := poolFeature(flag.feature)
+		if cmdErr, ok := err.(*commandError); ok && cmdErr.exitCode != sshConnectionFailed {
+			// zpool doesn't know the feature at all
+			state = ""
+		} else if err != nil {
+			return err
+		}
+		state = strings.TrimSpace(state)
+		if state != "enabled" && state != "active" {
+			return &unsupportedFeatureError{flag: flag.flag, feature: flag.feature, pool: pool}
+		}
+	}
+	return nil
+}
+
+// estimatedSize parses the total size printed by zfs send -nvP
+func estimatedSize(out string) int64 {
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 2 && fields[0] == "size" {
+			size, _ := strconv.ParseInt(fields[1], 10, 64)
+			return size
+		}
+	}
+	return 0
+}
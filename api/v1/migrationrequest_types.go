@@ -17,6 +17,9 @@ limitations under the License.
 package v1
 
 import (
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
@@ -35,6 +38,177 @@ type MigrationRequestSpec struct {
 	SnapInterval            int            `json:"snapInterval,omitempty"`
 	Destination             DestinationDef `json:"destination,omitempty"`
 	VolumeSnapshotClassName string         `json:"volumeSnapshotClassName,omitempty"`
+
+	// TargetName references the MigrationTarget providing the destination node, pool, transport, credentials and cluster.
+	// Destination.RemoteDataset is then appended to the dataset prefix of the target and the other Destination fields are ignored.
+	// +optional
+	TargetName string `json:"targetName,omitempty"`
+
+	// BandwidthLimit caps the rate of the snapshot streams in bytes per second (e.g. 100Mi).
+	// The operator-wide default applies when it is unset, and it can be changed while a snapshot is being sent.
+	BandwidthLimit *resource.Quantity `json:"bandwidthLimit,omitempty"`
+
+	// SendOptions are the zfs send flags used for the snapshot streams
+	SendOptions SendOptions `json:"sendOptions,omitempty"`
+
+	// Convergence cuts over once the incremental snapshots are small enough instead of after DesiredSnapshotCount snapshots,
+	// which is then ignored
+	// +optional
+	Convergence *ConvergencePolicy `json:"convergence,omitempty"`
+
+	// Hooks run commands in the source pod around the VolumeSnapshots taken while it runs, to make them
+	// consistent for the application. The final snapshot is taken once the pod is stopped and needs none.
+	// +optional
+	Hooks *SnapshotHooks `json:"hooks,omitempty"`
+
+	// MaxDowntime bounds the downtime of the cutover. The pod is only stopped once the estimated time to send
+	// the final snapshot fits it, until then incremental snapshots keep being sent. The estimate doesn't include
+	// the restore and the start of the migrated pod, the budget should leave room for them.
+	// +optional
+	MaxDowntime *metav1.Duration `json:"maxDowntime,omitempty"`
+
+	// Suspend holds the migration at the next safe point: no VolumeSnapshot is taken and no send is started
+	// until it is unset, a running send is let finish. The migration continues from where it stopped.
+	// Once the source pod is stopped for the cutover, the migration isn't held so that the downtime isn't extended.
+	// +optional
+	Suspend bool `json:"suspend,omitempty"`
+
+	// Workload is the Deployment or StatefulSet controlling the source pod. It is scaled to zero for the cutover instead
+	// of deleting the pod, which it would recreate, then its claims are pointed to the restored PersistentVolumeClaims
+	// and it is scaled back up, in the destination cluster when it is another one. No migrated pod is created.
+	// +optional
+	Workload *WorkloadReference `json:"workload,omitempty"`
+
+	// KeepNames restores the volumes under the names of the source PersistentVolumeClaims and starts the migrated pod
+	// under the name of the source pod, so that the manifests referencing them need no change. In the same cluster
+	// the source claims are deleted once the final snapshot is sent, their PersistentVolumes are retained for a rollback.
+	// +optional
+	KeepNames bool `json:"keepNames,omitempty"`
+
+	// Consumers tells what happens at the cutover to the other pods mounting the migrated claims, which would keep
+	// writing to the source volumes after the final snapshot. Refuse by default.
+	// +optional
+	Consumers ConsumerPolicy `json:"consumers,omitempty"`
+
+	// Abort cancels the migration and rolls it back: the running send is stopped, the partially received dataset
+	// is destroyed and the source pod is recreated on the source node if it was stopped. It can't be undone, and
+	// a migration can't be aborted once the restore started. Deleting an unfinished migration rolls it back too.
+	// +optional
+	Abort bool `json:"abort,omitempty"`
+}
+
+// SendOptions maps to zfs send flags. The node agent checks that the destination pool
+// has the features each flag relies on before the first byte is sent.
+type SendOptions struct {
+	// Compressed sends the blocks compressed as they are on disk instead of decompressing them (-c)
+	Compressed bool `json:"compressed,omitempty"`
+	// LargeBlock keeps blocks larger than 128KiB intact, requires large_blocks on the destination (-L)
+	LargeBlock bool `json:"largeBlock,omitempty"`
+	// Embedded keeps WRITE_EMBEDDED records, requires embedded_data on the destination (-e)
+	Embedded bool `json:"embedded,omitempty"`
+	// Raw sends encrypted datasets without decrypting them, requires encryption on the destination (-w)
+	Raw bool `json:"raw,omitempty"`
+	// Properties includes the dataset properties in the stream (-p)
+	Properties bool `json:"properties,omitempty"`
+}
+
+// SnapshotHooks quiesce the application of the source pod while a VolumeSnapshot is taken
+type SnapshotHooks struct {
+	// Pre hooks run in order before a VolumeSnapshot is created, for instance to flush and freeze the application
+	// +optional
+	Pre []ExecHook `json:"pre,omitempty"`
+	// Post hooks run in order once the snapshot is taken, for instance to thaw the application.
+	// They also run when a pre hook failed, to undo what the previous ones did.
+	// +optional
+	Post []ExecHook `json:"post,omitempty"`
+}
+
+// HookErrorPolicy tells what happens when a hook fails or times out
+// +kubebuilder:validation:Enum=Fail;Continue
+type HookErrorPolicy string
+
+const (
+	// HookErrorFail fails the migration
+	HookErrorFail HookErrorPolicy = "Fail"
+	// HookErrorContinue goes on with the snapshot, the failure is reported in the Quiesced condition
+	HookErrorContinue HookErrorPolicy = "Continue"
+)
+
+// ExecHook runs a command in a container of the source pod
+type ExecHook struct {
+	// Container to run the command in, the first container of the pod when empty
+	// +optional
+	Container string `json:"container,omitempty"`
+	// Command is run without a shell, wrap it in sh -c to use one
+	// +kubebuilder:validation:MinItems=1
+	Command []string `json:"command"`
+	// Timeout of the command, 30s by default
+	// +optional
+	Timeout *metav1.Duration `json:"timeout,omitempty"`
+	// OnError tells what happens when the command fails or times out, Fail by default
+	// +optional
+	OnError HookErrorPolicy `json:"onError,omitempty"`
+}
+
+// WorkloadKind is the kind of a workload controlling the source pod
+// +kubebuilder:validation:Enum=Deployment;StatefulSet
+type WorkloadKind string
+
+const (
+	WorkloadKindDeployment  WorkloadKind = "Deployment"
+	WorkloadKindStatefulSet WorkloadKind = "StatefulSet"
+)
+
+// WorkloadStopMode tells how a workload is stopped for the cutover
+// +kubebuilder:validation:Enum=ScaleToZero;DeletePod
+type WorkloadStopMode string
+
+const (
+	// WorkloadStopScaleToZero scales the workload to zero and back up once the volumes are restored
+	WorkloadStopScaleToZero WorkloadStopMode = "ScaleToZero"
+	// WorkloadStopDeletePod deletes the source pod alone, the other pods of the workload keep running. The pods mounting
+	// the migrated claims are refused until the migration completes, then the StatefulSet recreates the pod with the
+	// restored claims. It requires a StatefulSet whose migrated claims come from its volumeClaimTemplates, in the same cluster.
+	WorkloadStopDeletePod WorkloadStopMode = "DeletePod"
+)
+
+// ConsumerPolicy tells what happens to the pods other than the source pod and its workload that mount the migrated claims
+// +kubebuilder:validation:Enum=Refuse;Delete
+type ConsumerPolicy string
+
+const (
+	// ConsumerPolicyRefuse holds the cutover until no other pod mounts the migrated claims, the source pod keeps running
+	ConsumerPolicyRefuse ConsumerPolicy = "Refuse"
+	// ConsumerPolicyDelete deletes the other pods with the source pod. The pods mounting the migrated claims are refused
+	// until the migration completes, their controllers recreate them with the source claims afterwards.
+	ConsumerPolicyDelete ConsumerPolicy = "Delete"
+)
+
+// WorkloadReference references a workload in the namespace of the MigrationRequest
+type WorkloadReference struct {
+	Kind WorkloadKind `json:"kind"`
+	Name string       `json:"name"`
+	// Stop tells how the workload is stopped for the cutover. A Deployment is scaled to zero by default. The pod of a
+	// StatefulSet is deleted alone by default when its migrated claims come from the volumeClaimTemplates and the
+	// destination is in the same cluster, so that the other replicas keep running. Otherwise a StatefulSet is scaled
+	// to zero, which is refused with more than one replica unless ScaleToZero is set explicitly.
+	// +optional
+	Stop WorkloadStopMode `json:"stop,omitempty"`
+}
+
+// ConvergencePolicy decides when to cut over from the incremental snapshots sent so far. Snapshots are sent every
+// SnapInterval until the last incremental stream fits one of the budgets, then the pod is stopped and the final snapshot is sent.
+type ConvergencePolicy struct {
+	// MaxDeltaSize is the largest estimated size (zfs send -nvP -i) of the last incremental stream to cut over after
+	// +optional
+	MaxDeltaSize *resource.Quantity `json:"maxDeltaSize,omitempty"`
+	// MaxDeltaDuration is the longest time the last incremental stream may have taken to send to cut over after
+	// +optional
+	MaxDeltaDuration *metav1.Duration `json:"maxDeltaDuration,omitempty"`
+	// MaxRounds is the number of snapshots after which the migration cuts over even if it didn't converge
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	MaxRounds int `json:"maxRounds,omitempty"`
 }
 
 type DestinationDef struct {
@@ -43,21 +217,326 @@ type DestinationDef struct {
 	RemoteDataset  string `json:"remoteDataset,omitempty"`
 	RemoteHostIP   string `json:"remoteHostIP,omitempty"`
 	RemoteHostName string `json:"remoteHostName,omitempty"`
+
+	// CredentialsSecretName is a Secret in the namespace of the MigrationRequest holding the ssh identity
+	// used to log in to the destination under ssh-privatekey, and the known_hosts entries of the destination under known_hosts.
+	// The host key of the destination is verified against known_hosts, the send is refused without it unless
+	// InsecureSkipHostKeyVerification is set. A key pair is generated for the migration and authorized on the
+	// destination when ssh-privatekey isn't set.
+	CredentialsSecretName string `json:"credentialsSecretName,omitempty"`
+
+	// InsecureSkipHostKeyVerification sends over ssh without known_hosts entries, accepting any host key of
+	// the destination. Anyone able to intercept the connection receives the volumes.
+	// +optional
+	InsecureSkipHostKeyVerification bool `json:"insecureSkipHostKeyVerification,omitempty"`
+
+	// KubeconfigSecretName is a Secret in the namespace of the MigrationRequest holding the kubeconfig of the
+	// destination cluster under kubeconfig. The RestoreRequest and the migrated pod are created in that cluster,
+	// which runs the operator too, and RemoteHostName is a node of that cluster.
+	// The RestoreRequest reports back to the MigrationRequest with the kubeconfig stored under sourceKubeconfig,
+	// otherwise the MigrationRequest polls the RestoreRequest.
+	KubeconfigSecretName string `json:"kubeconfigSecretName,omitempty"`
+}
+
+// ResolvedDestination is the destination of a migration once its MigrationTarget, if any, is resolved
+type ResolvedDestination struct {
+	DestinationDef `json:",inline"`
+	// CredentialsSecretNamespace and KubeconfigSecretNamespace are the namespaces of the referenced Secrets
+	CredentialsSecretNamespace string `json:"credentialsSecretNamespace,omitempty"`
+	KubeconfigSecretNamespace  string `json:"kubeconfigSecretNamespace,omitempty"`
+}
+
+// KnownHostsKey is the key of the known_hosts entries in the credentials Secret of a destination
+const KnownHostsKey = "known_hosts"
+
+const (
+	// KubeconfigKey is the key of the kubeconfig in a kubeconfig Secret
+	KubeconfigKey = "kubeconfig"
+	// SourceKubeconfigKey is the key of the kubeconfig the destination cluster reaches the source cluster with
+	SourceKubeconfigKey = "sourceKubeconfig"
+)
+
+// MigrationRequestAnnotation is set on the migrated pod to the name of its MigrationRequest, the pod webhook
+// lets it mount the claims the migration locks
+const MigrationRequestAnnotation = "api.k8s.zfs-volume-migrator.io/migration-request"
+
+// The condition types of a MigrationRequest
+const (
+	// MigrationConditionSnapshotReady is True once the current VolumeSnapshot is ready to be sent
+	MigrationConditionSnapshotReady = "SnapshotReady"
+	// MigrationConditionSnapshotsSent is True once the destination received all the snapshots
+	MigrationConditionSnapshotsSent = "SnapshotsSent"
+	// MigrationConditionPodStopped is True once the source pod is stopped for the cutover
+	MigrationConditionPodStopped = "PodStopped"
+	// MigrationConditionRestored is True once the RestoreRequest recreated the volume on the destination
+	MigrationConditionRestored = "Restored"
+	// MigrationConditionCompleted is True once the migration succeeded
+	MigrationConditionCompleted = "Completed"
+	// MigrationConditionFailed is True once the migration failed
+	MigrationConditionFailed = "Failed"
+	// MigrationConditionHostKeyVerified tells whether the host key of the destination matched its known_hosts entries
+	MigrationConditionHostKeyVerified = "HostKeyVerified"
+	// MigrationConditionAborted is True once an aborted migration is rolled back
+	MigrationConditionAborted = "Aborted"
+	// MigrationConditionSuspended is True while a suspended migration is held
+	MigrationConditionSuspended = "Suspended"
+	// MigrationConditionConverged is True once the incremental snapshots are small enough to cut over
+	MigrationConditionConverged = "Converged"
+	// MigrationConditionQuiesced tells whether the hooks around the last VolumeSnapshot succeeded
+	MigrationConditionQuiesced = "Quiesced"
+	// MigrationConditionDowntimeWithinBudget tells whether the estimated downtime of the cutover fits MaxDowntime
+	MigrationConditionDowntimeWithinBudget = "DowntimeWithinBudget"
+	// MigrationConditionConsumersStopped is True once no pod other than the source pod mounts the migrated claims
+	MigrationConditionConsumersStopped = "ConsumersStopped"
+)
+
+// The reasons of the MigrationRequest conditions
+const (
+	ReasonInProgress         = "InProgress"
+	ReasonSnapshotPending    = "SnapshotPending"
+	ReasonSnapshotReady      = "SnapshotReady"
+	ReasonSending            = "Sending"
+	ReasonSendRetrying       = "SendRetrying"
+	ReasonSnapshotsSent      = "SnapshotsSent"
+	ReasonPodStopping        = "PodStopping"
+	ReasonPodStopped         = "PodStopped"
+	ReasonRestoring          = "Restoring"
+	ReasonRestored           = "Restored"
+	ReasonCompleted          = "Completed"
+	ReasonFailed             = "Failed"
+	ReasonHostKeyMatched     = "HostKeyMatched"
+	ReasonHostKeyMismatch    = "HostKeyMismatch"
+	ReasonRollingBack        = "RollingBack"
+	ReasonRolledBack         = "RolledBack"
+	ReasonAborted            = "Aborted"
+	ReasonSuspended          = "Suspended"
+	ReasonResumed            = "Resumed"
+	ReasonConverging         = "Converging"
+	ReasonDeltaInBudget      = "DeltaWithinBudget"
+	ReasonMaxRounds          = "MaxRoundsReached"
+	ReasonWithinBudget       = "WithinBudget"
+	ReasonOverBudget         = "OverBudget"
+	ReasonNoTransferRate     = "NoTransferRate"
+	ReasonQuiescing          = "Quiescing"
+	ReasonHooksSucceeded     = "HooksSucceeded"
+	ReasonHookFailed         = "HookFailed"
+	ReasonUnmanagedConsumers = "UnmanagedConsumers"
+	ReasonConsumersStopping  = "ConsumersStopping"
+	ReasonConsumersStopped   = "ConsumersStopped"
+)
+
+// MigrationPhase is the step of the migration the controller is currently working on
+type MigrationPhase string
+
+const (
+	// MigrationPhasePending is the phase of a MigrationRequest that has not been picked up yet
+	MigrationPhasePending MigrationPhase = "Pending"
+	// MigrationPhasePreparing resolves the source objects and creates the sender configuration
+	MigrationPhasePreparing MigrationPhase = "Preparing"
+	// MigrationPhaseSnapshotting waits for a VolumeSnapshot of the source volume to be ready
+	MigrationPhaseSnapshotting MigrationPhase = "Snapshotting"
+	// MigrationPhaseSending waits for the sender Job to ship the current snapshot
+	MigrationPhaseSending MigrationPhase = "Sending"
+	// MigrationPhaseCuttingOver stops the source pod before the final snapshot is taken
+	MigrationPhaseCuttingOver MigrationPhase = "CuttingOver"
+	// MigrationPhaseRestoring waits for the RestoreRequest to recreate the volume on the destination
+	MigrationPhaseRestoring MigrationPhase = "Restoring"
+	// MigrationPhaseCompleted is the terminal phase of a successful migration
+	MigrationPhaseCompleted MigrationPhase = "Completed"
+	// MigrationPhaseFailed is the terminal phase of a migration that cannot make progress
+	MigrationPhaseFailed MigrationPhase = "Failed"
+	// MigrationPhaseAborting rolls back an aborted migration
+	MigrationPhaseAborting MigrationPhase = "Aborting"
+	// MigrationPhaseAborted is the terminal phase of a migration that was rolled back
+	MigrationPhaseAborted MigrationPhase = "Aborted"
+)
+
+// Abortable tells whether a migration in the phase can still be rolled back,
+// which is no longer the case once the volume is being restored on the destination
+func (p MigrationPhase) Abortable() bool {
+	switch p {
+	case MigrationPhaseRestoring, MigrationPhaseCompleted, MigrationPhaseAborting, MigrationPhaseAborted:
+		return false
+	}
+	return true
+}
+
+// Abortable tells whether the migration can still be rolled back. A failed migration can be if it failed in an
+// abortable phase, one that failed while restoring on the destination may already have released its source volumes.
+func (r *MigrationRequest) Abortable() bool {
+	if r.Status.Phase == MigrationPhaseFailed {
+		return r.Status.FailedPhase != "" && r.Status.FailedPhase.Abortable()
+	}
+	return r.Status.Phase.Abortable()
+}
+
+// ClaimsLocked tells whether the pods mounting the migrated claims are refused, which is the case from the source pod
+// being stopped for the cutover until the migration ends
+func (r *MigrationRequest) ClaimsLocked() bool {
+	if meta.FindStatusCondition(r.Status.Conditions, MigrationConditionPodStopped) == nil {
+		return false
+	}
+	switch r.Status.Phase {
+	case MigrationPhaseCompleted, MigrationPhaseFailed, MigrationPhaseAborting, MigrationPhaseAborted:
+		return false
+	}
+	return true
+}
+
+// SourceResources records the objects resolved and created when the migration was prepared
+type SourceResources struct {
+	NodeName                string `json:"nodeName,omitempty"`
+	VolumeSnapshotClassName string `json:"volumeSnapshotClassName,omitempty"`
+	SecretName              string `json:"secretName,omitempty"`
+
+	// Workload is the workload controlling the source pod, set when spec.workload is
+	Workload *SourceWorkload `json:"workload,omitempty"`
+
+	// Pod is a copy of the source pod, it is used to recreate the workload once the original has been stopped
+	// +kubebuilder:validation:Schemaless
+	// +kubebuilder:validation:Type=object
+	// +kubebuilder:pruning:PreserveUnknownFields
+	Pod *corev1.PodTemplateSpec `json:"pod,omitempty"`
+}
+
+// SourceWorkload records the workload scaled down for the cutover
+type SourceWorkload struct {
+	WorkloadReference `json:",inline"`
+	// Replicas is the number of replicas of the workload before it was scaled to zero, it is scaled back to it
+	Replicas *int32 `json:"replicas,omitempty"`
+}
+
+// MigratedVolume is a ZFS-LocalPV volume of the source pod, the other volumes of the pod are left as they are
+type MigratedVolume struct {
+	// Name of the volume in the source pod
+	Name                      string `json:"name"`
+	PersistentVolumeClaimName string `json:"persistentVolumeClaimName"`
+	PersistentVolumeName      string `json:"persistentVolumeName"`
+	StorageClassName          string `json:"storageClassName,omitempty"`
+	PoolName                  string `json:"poolName"`
+	// RestoredClaimName is the name of the restored PersistentVolumeClaim. It is the name of the source claim when
+	// the claim comes from a volumeClaimTemplate of the StatefulSet, which only finds its claims by name, or with KeepNames.
+	RestoredClaimName string `json:"restoredClaimName"`
+	// RemoteDataset is the dataset of the destination pool the volume is received into
+	RemoteDataset string `json:"remoteDataset"`
+	// SentSnapshots lists the handles of the snapshots of the volume received by the destination, in order
+	SentSnapshots []string `json:"sentSnapshots,omitempty"`
+	// IncrementalBase is the last snapshot of the volume received by the destination, the next one is sent incrementally from it
+	IncrementalBase    string `json:"incrementalBase,omitempty"`
+	RestoreRequestName string `json:"restoreRequestName,omitempty"`
+}
+
+// SnapshotRef identifies the snapshot currently being taken or sent, made of a VolumeSnapshot per migrated volume
+type SnapshotRef struct {
+	// Name of the snapshot, the VolumeSnapshot of a volume is named after it and the volume
+	Name string `json:"name"`
+	// Handles are the ZFS snapshots (pool/dataset@snapshot) of the volumes, in the order of status.volumes,
+	// once all the VolumeSnapshots are ready
+	Handles []string `json:"handles,omitempty"`
+	// SentVolumes counts the volumes whose snapshot the destination received, they are sent one at a time in order
+	SentVolumes int `json:"sentVolumes,omitempty"`
+	// Delta sums the incremental streams of the volumes sent so far
+	Delta *DeltaEstimate `json:"delta,omitempty"`
+	// Quiescing is true from the pre-snapshot hooks running until the post-snapshot hooks ran
+	Quiescing bool `json:"quiescing,omitempty"`
+}
+
+// RollbackStatus records the rollback of an aborted migration
+type RollbackStatus struct {
+	// FromPhase is the phase the migration was in when it was aborted
+	FromPhase      MigrationPhase `json:"fromPhase,omitempty"`
+	StartTime      *metav1.Time   `json:"startTime,omitempty"`
+	CompletionTime *metav1.Time   `json:"completionTime,omitempty"`
+	// SendCanceled is set once the send that was running is stopped
+	SendCanceled bool `json:"sendCanceled,omitempty"`
+	// DestinationCleaned is set once what the destination received is destroyed
+	DestinationCleaned bool `json:"destinationCleaned,omitempty"`
+	// RecreatedPod is the source pod recreated on the source node, empty when it was never stopped
+	RecreatedPod string `json:"recreatedPod,omitempty"`
+}
+
+// DeltaEstimate is the size of an incremental stream and the time it took to send
+type DeltaEstimate struct {
+	Bytes    int64            `json:"bytes"`
+	Duration *metav1.Duration `json:"duration,omitempty"`
+}
+
+// DowntimeStatus measures the downtime of the cutover, from the source pod being stopped to the migrated pod being ready
+type DowntimeStatus struct {
+	// Estimated is the estimated time to send the final snapshot when the pod was stopped
+	Estimated *metav1.Duration `json:"estimated,omitempty"`
+	StartTime *metav1.Time     `json:"startTime,omitempty"`
+	EndTime   *metav1.Time     `json:"endTime,omitempty"`
+	// Actual is the measured downtime, set once the migrated pod is ready
+	Actual *metav1.Duration `json:"actual,omitempty"`
+}
+
+// TransferProgress reports how far the send of the current snapshot is
+type TransferProgress struct {
+	// EstimatedBytes is the size of the stream reported by zfs send -nvP
+	EstimatedBytes int64 `json:"estimatedBytes,omitempty"`
+	BytesSent      int64 `json:"bytesSent,omitempty"`
+	BytesPerSecond int64 `json:"bytesPerSecond,omitempty"`
+	// Percentage, Rate and ETA are human readable forms of the fields above
+	Percentage     string       `json:"percentage,omitempty"`
+	Rate           string       `json:"rate,omitempty"`
+	ETA            string       `json:"eta,omitempty"`
+	LastUpdateTime *metav1.Time `json:"lastUpdateTime,omitempty"`
 }
 
 // MigrationRequestStatus defines the observed state of MigrationRequest
 type MigrationRequestStatus struct {
 	// INSERT ADDITIONAL STATUS FIELD - define observed state of cluster
 	// Important: Run "make" to regenerate code after modifying this file
-	SnapshotCount          int    `json:"snapshotCreated,omitempty"`
-	ConfirmedSnapshotCount int    `json:"confirmedSnapshotCreated,omitempty"`
-	AllSnapshotsSent       string `json:"allSnapshotSent,omitempty"`
-	RestorationCompleted   string `json:"restorationComplete,omitempty"`
-	MigrationCompleted     string `json:"migrationComplete,omitempty"`
+	Phase   MigrationPhase `json:"phase,omitempty"`
+	Message string         `json:"message,omitempty"`
+	// FailedPhase is the phase the migration was in when it failed
+	FailedPhase MigrationPhase   `json:"failedPhase,omitempty"`
+	Source      *SourceResources `json:"source,omitempty"`
+	// Destination is the destination resolved when the migration was prepared, the later phases use it instead of the spec
+	Destination            *ResolvedDestination `json:"destination,omitempty"`
+	SnapshotCount          int                  `json:"snapshotCreated,omitempty"`
+	ConfirmedSnapshotCount int                  `json:"confirmedSnapshotCreated,omitempty"`
+	LastSnapshotTime       *metav1.Time         `json:"lastSnapshotTime,omitempty"`
+	CurrentSnapshot        *SnapshotRef         `json:"currentSnapshot,omitempty"`
+	// Volumes are the volumes of the source pod backed by ZFS-LocalPV, they are snapshotted, sent and restored together
+	Volumes []MigratedVolume `json:"volumes,omitempty"`
+	// ResumeToken is the receive_resume_token of the destination after an interrupted send of the current volume
+	ResumeToken string `json:"resumeToken,omitempty"`
+	// SendAttempt counts the failed sends of the current volume, each attempt is a distinct send of the node agent
+	SendAttempt int32 `json:"sendAttempt,omitempty"`
+	// AuthorizedKey is the ID of the migration key installed on the destination, it is cleared once the key is revoked
+	AuthorizedKey string `json:"authorizedKey,omitempty"`
+	// Progress of the send of the current snapshot
+	Progress *TransferProgress `json:"progress,omitempty"`
+	// LastDelta sums the incremental streams of the volumes for the last snapshot sent, the convergence of the migration is decided from it
+	LastDelta *DeltaEstimate `json:"lastDelta,omitempty"`
+	// LastSendRate is the rate in bytes per second of the last snapshot sent, the downtime is estimated from it
+	LastSendRate int64 `json:"lastSendRate,omitempty"`
+	// Downtime of the cutover, set once the source pod is stopped
+	Downtime *DowntimeStatus `json:"downtime,omitempty"`
+	// Rollback is set once the migration is aborted
+	Rollback *RollbackStatus `json:"rollback,omitempty"`
+
+	// Conditions are the latest observations of the migration, see the MigrationCondition constants
+	// +listType=map
+	// +listMapKey=type
+	// +optional
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
 }
 
 //+kubebuilder:object:root=true
 //+kubebuilder:subresource:status
+//+kubebuilder:printcolumn:name="Phase",type=string,JSONPath=`.status.phase`
+//+kubebuilder:printcolumn:name="Sent",type=integer,JSONPath=`.status.confirmedSnapshotCreated`
+//+kubebuilder:printcolumn:name="Progress",type=string,JSONPath=`.status.progress.percentage`
+//+kubebuilder:printcolumn:name="Rate",type=string,JSONPath=`.status.progress.rate`
+//+kubebuilder:printcolumn:name="ETA",type=string,JSONPath=`.status.progress.eta`
+//+kubebuilder:printcolumn:name="Suspended",type=boolean,JSONPath=`.spec.suspend`
+//+kubebuilder:printcolumn:name="Downtime",type=string,JSONPath=`.status.downtime.actual`
+//+kubebuilder:printcolumn:name="Completed",type=string,JSONPath=`.status.conditions[?(@.type=="Completed")].status`
+//+kubebuilder:printcolumn:name="Message",type=string,JSONPath=`.status.message`,priority=1
+//+kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
 
 // MigrationRequest is the Schema for the migrationrequests API
 type MigrationRequest struct {
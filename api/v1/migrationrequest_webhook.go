@@ -0,0 +1,357 @@
+/*
+Copyright 2023 thehamdiaz.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+)
+
+// log is for logging in this package.
+var migrationrequestlog = logf.Log.WithName("migrationrequest-resource")
+
+// The defaults of the MigrationRequest spec
+const (
+	DefaultDesiredSnapshotCount    = 3
+	DefaultSnapInterval            = 60
+	DefaultVolumeSnapshotClassName = "migration-vsc"
+	DefaultConvergenceMaxRounds    = 10
+	DefaultHookTimeout             = 30 * time.Second
+)
+
+// SetupWebhookWithManager registers the defaulting and validating webhooks of the MigrationRequests
+func (r *MigrationRequest) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	// The referenced objects are read from the API server, not to cache every pod of the cluster
+	hook := &migrationRequestWebhook{client: mgr.GetAPIReader()}
+	return ctrl.NewWebhookManagedBy(mgr).
+		For(r).
+		WithDefaulter(hook).
+		WithValidator(hook).
+		Complete()
+}
+
+//+kubebuilder:webhook:path=/mutate-api-k8s-zfs-volume-migrator-io-v1-migrationrequest,mutating=true,failurePolicy=fail,sideEffects=None,groups=api.k8s.zfs-volume-migrator.io,resources=migrationrequests,verbs=create;update,versions=v1,name=mmigrationrequest.kb.io,admissionReviewVersions=v1
+//+kubebuilder:webhook:path=/validate-api-k8s-zfs-volume-migrator-io-v1-migrationrequest,mutating=false,failurePolicy=fail,sideEffects=None,groups=api.k8s.zfs-volume-migrator.io,resources=migrationrequests,verbs=create;update,versions=v1,name=vmigrationrequest.kb.io,admissionReviewVersions=v1
+
+type migrationRequestWebhook struct {
+	client client.Reader
+}
+
+var _ webhook.CustomDefaulter = &migrationRequestWebhook{}
+var _ webhook.CustomValidator = &migrationRequestWebhook{}
+
+// Default implements webhook.CustomDefaulter so a webhook will be registered for the type
+func (w *migrationRequestWebhook) Default(ctx context.Context, obj runtime.Object) error {
+	migrationRequest, ok := obj.(*MigrationRequest)
+	if !ok {
+		return fmt.Errorf("expected a MigrationRequest but got a %T", obj)
+	}
+	migrationrequestlog.Info("default", "name", migrationRequest.Name)
+
+	defaultMigrationRequestSpec(&migrationRequest.Spec)
+	return nil
+}
+
+// defaultMigrationRequestSpec sets the defaults of a MigrationRequest spec, or of a template of one
+func defaultMigrationRequestSpec(spec *MigrationRequestSpec) {
+	if spec.DesiredSnapshotCount == 0 {
+		spec.DesiredSnapshotCount = DefaultDesiredSnapshotCount
+	}
+	if spec.SnapInterval == 0 {
+		spec.SnapInterval = DefaultSnapInterval
+	}
+	if spec.VolumeSnapshotClassName == "" {
+		spec.VolumeSnapshotClassName = DefaultVolumeSnapshotClassName
+	}
+	if spec.Convergence != nil && spec.Convergence.MaxRounds == 0 {
+		spec.Convergence.MaxRounds = DefaultConvergenceMaxRounds
+	}
+	if spec.Hooks != nil {
+		for _, hooks := range [][]ExecHook{spec.Hooks.Pre, spec.Hooks.Post} {
+			for i := range hooks {
+				if hooks[i].Timeout == nil {
+					hooks[i].Timeout = &metav1.Duration{Duration: DefaultHookTimeout}
+				}
+				if hooks[i].OnError == "" {
+					hooks[i].OnError = HookErrorFail
+				}
+			}
+		}
+	}
+	if spec.Consumers == "" {
+		spec.Consumers = ConsumerPolicyRefuse
+	}
+	// The stop mode of a StatefulSet depends on its claims and replicas, the controller picks it
+	if spec.Workload != nil && spec.Workload.Kind == WorkloadKindDeployment && spec.Workload.Stop == "" {
+		spec.Workload.Stop = WorkloadStopScaleToZero
+	}
+}
+
+// ValidateCreate implements webhook.CustomValidator so a webhook will be registered for the type
+func (w *migrationRequestWebhook) ValidateCreate(ctx context.Context, obj runtime.Object) error {
+	migrationRequest, ok := obj.(*MigrationRequest)
+	if !ok {
+		return fmt.Errorf("expected a MigrationRequest but got a %T", obj)
+	}
+	migrationrequestlog.Info("validate create", "name", migrationRequest.Name)
+
+	allErrs := validateMigrationRequestSpec(&migrationRequest.Spec)
+	if len(allErrs) == 0 {
+		allErrs = w.validateReferences(ctx, migrationRequest)
+	}
+	return invalidMigrationRequest(migrationRequest, allErrs)
+}
+
+// ValidateUpdate implements webhook.CustomValidator so a webhook will be registered for the type
+func (w *migrationRequestWebhook) ValidateUpdate(ctx context.Context, oldObj, newObj runtime.Object) error {
+	oldMigrationRequest, ok := oldObj.(*MigrationRequest)
+	if !ok {
+		return fmt.Errorf("expected a MigrationRequest but got a %T", oldObj)
+	}
+	migrationRequest, ok := newObj.(*MigrationRequest)
+	if !ok {
+		return fmt.Errorf("expected a MigrationRequest but got a %T", newObj)
+	}
+	migrationrequestlog.Info("validate update", "name", migrationRequest.Name)
+
+	allErrs := validateMigrationRequestSpec(&migrationRequest.Spec)
+	if migrationStarted(oldMigrationRequest) &&
+		!equality.Semantic.DeepEqual(immutableSpec(oldMigrationRequest.Spec), immutableSpec(migrationRequest.Spec)) {
+		allErrs = append(allErrs, field.Forbidden(field.NewPath("spec"), "only bandwidthLimit, maxDowntime, suspend, consumers and abort can change once the migration has started"))
+	}
+	abortPath := field.NewPath("spec", "abort")
+	if oldMigrationRequest.Spec.Abort && !migrationRequest.Spec.Abort {
+		allErrs = append(allErrs, field.Forbidden(abortPath, "an abort can't be undone"))
+	}
+	if !oldMigrationRequest.Spec.Abort && migrationRequest.Spec.Abort && !oldMigrationRequest.Abortable() {
+		allErrs = append(allErrs, field.Forbidden(abortPath, fmt.Sprintf("a migration can't be aborted in the %s phase", oldMigrationRequest.Status.Phase)))
+	}
+	return invalidMigrationRequest(migrationRequest, allErrs)
+}
+
+// ValidateDelete implements webhook.CustomValidator so a webhook will be registered for the type
+func (w *migrationRequestWebhook) ValidateDelete(ctx context.Context, obj runtime.Object) error {
+	return nil
+}
+
+// migrationStarted tells whether the controller already acted on the spec of the migration
+func migrationStarted(migrationRequest *MigrationRequest) bool {
+	return migrationRequest.Status.Phase != "" && migrationRequest.Status.Phase != MigrationPhasePending
+}
+
+// immutableSpec returns the spec without the fields that can change during a migration
+func immutableSpec(spec MigrationRequestSpec) MigrationRequestSpec {
+	spec.BandwidthLimit = nil
+	spec.MaxDowntime = nil
+	spec.Suspend = false
+	spec.Consumers = ""
+	spec.Abort = false
+	return spec
+}
+
+func validateMigrationRequestSpec(spec *MigrationRequestSpec) field.ErrorList {
+	var allErrs field.ErrorList
+	specPath := field.NewPath("spec")
+
+	if spec.PodName == "" {
+		allErrs = append(allErrs, field.Required(specPath.Child("podName"), ""))
+	}
+	if workload := spec.Workload; workload != nil {
+		workloadPath := specPath.Child("workload")
+		if workload.Name == "" {
+			allErrs = append(allErrs, field.Required(workloadPath.Child("name"), ""))
+		}
+		if workload.Stop == WorkloadStopDeletePod && workload.Kind != WorkloadKindStatefulSet {
+			allErrs = append(allErrs, field.Invalid(workloadPath.Child("stop"), workload.Stop, "only the pods of a StatefulSet can be deleted alone"))
+		}
+		if workload.Stop == WorkloadStopDeletePod && spec.Destination.KubeconfigSecretName != "" {
+			allErrs = append(allErrs, field.Invalid(workloadPath.Child("stop"), workload.Stop, "the StatefulSet can't recreate the pod in another cluster"))
+		}
+	}
+	return append(allErrs, validateMigrationSettings(specPath, spec)...)
+}
+
+// validateMigrationSettings validates the fields of a MigrationRequest spec that don't depend on the migrated pod,
+// they are shared with the templates of MigrationRequests
+func validateMigrationSettings(specPath *field.Path, spec *MigrationRequestSpec) field.ErrorList {
+	var allErrs field.ErrorList
+	if spec.DesiredSnapshotCount < 1 {
+		allErrs = append(allErrs, field.Invalid(specPath.Child("desiredSnapshotCount"), spec.DesiredSnapshotCount, "must be at least 1"))
+	}
+	if spec.SnapInterval < 0 {
+		allErrs = append(allErrs, field.Invalid(specPath.Child("snapInterval"), spec.SnapInterval, "must not be negative"))
+	}
+	if convergence := spec.Convergence; convergence != nil {
+		convergencePath := specPath.Child("convergence")
+		if convergence.MaxDeltaSize == nil && convergence.MaxDeltaDuration == nil {
+			allErrs = append(allErrs, field.Required(convergencePath, "one of maxDeltaSize and maxDeltaDuration is required"))
+		}
+		if convergence.MaxDeltaSize != nil && convergence.MaxDeltaSize.Sign() <= 0 {
+			allErrs = append(allErrs, field.Invalid(convergencePath.Child("maxDeltaSize"), convergence.MaxDeltaSize.String(), "must be greater than zero"))
+		}
+		if convergence.MaxDeltaDuration != nil && convergence.MaxDeltaDuration.Duration <= 0 {
+			allErrs = append(allErrs, field.Invalid(convergencePath.Child("maxDeltaDuration"), convergence.MaxDeltaDuration.String(), "must be greater than zero"))
+		}
+		if convergence.MaxRounds < 1 {
+			allErrs = append(allErrs, field.Invalid(convergencePath.Child("maxRounds"), convergence.MaxRounds, "must be at least 1"))
+		}
+	}
+	if spec.Hooks != nil {
+		hooksPath := specPath.Child("hooks")
+		allErrs = append(allErrs, validateExecHooks(hooksPath.Child("pre"), spec.Hooks.Pre)...)
+		allErrs = append(allErrs, validateExecHooks(hooksPath.Child("post"), spec.Hooks.Post)...)
+	}
+	if spec.MaxDowntime != nil && spec.MaxDowntime.Duration <= 0 {
+		allErrs = append(allErrs, field.Invalid(specPath.Child("maxDowntime"), spec.MaxDowntime.String(), "must be greater than zero"))
+	}
+	if spec.BandwidthLimit != nil && spec.BandwidthLimit.Sign() < 0 {
+		allErrs = append(allErrs, field.Invalid(specPath.Child("bandwidthLimit"), spec.BandwidthLimit.String(), "must not be negative"))
+	}
+
+	destination := spec.Destination
+	destinationPath := specPath.Child("destination")
+	if destination.RemoteDataset == "" {
+		allErrs = append(allErrs, field.Required(destinationPath.Child("remoteDataset"), ""))
+	} else if errs := DatasetNameErrors(destination.RemoteDataset); len(errs) > 0 {
+		allErrs = append(allErrs, field.Invalid(destinationPath.Child("remoteDataset"), destination.RemoteDataset, strings.Join(errs, ", ")))
+	}
+	if spec.TargetName != "" {
+		// The rest of the destination comes from the MigrationTarget
+		return allErrs
+	}
+	if destination.RemotePool == "" {
+		allErrs = append(allErrs, field.Required(destinationPath.Child("remotePool"), ""))
+	}
+	if destination.RemoteHostName == "" {
+		allErrs = append(allErrs, field.Required(destinationPath.Child("remoteHostName"), ""))
+	}
+	if destination.User != "" && destination.RemoteHostIP == "" {
+		allErrs = append(allErrs, field.Required(destinationPath.Child("remoteHostIP"), "the ssh transport requires the IP of the destination"))
+	}
+	return allErrs
+}
+
+// validateExecHooks checks the commands and timeouts of the hooks
+func validateExecHooks(path *field.Path, hooks []ExecHook) field.ErrorList {
+	var allErrs field.ErrorList
+	for i, hook := range hooks {
+		if len(hook.Command) == 0 {
+			allErrs = append(allErrs, field.Required(path.Index(i).Child("command"), ""))
+		}
+		if hook.Timeout != nil && hook.Timeout.Duration <= 0 {
+			allErrs = append(allErrs, field.Invalid(path.Index(i).Child("timeout"), hook.Timeout.String(), "must be greater than zero"))
+		}
+	}
+	return allErrs
+}
+
+// validateReferences checks that the objects the migration starts from exist
+func (w *migrationRequestWebhook) validateReferences(ctx context.Context, migrationRequest *MigrationRequest) field.ErrorList {
+	var allErrs field.ErrorList
+	specPath := field.NewPath("spec")
+	spec := migrationRequest.Spec
+
+	if spec.TargetName != "" {
+		if err := w.client.Get(ctx, types.NamespacedName{Name: spec.TargetName}, &MigrationTarget{}); err != nil {
+			allErrs = append(allErrs, referenceError(specPath.Child("targetName"), spec.TargetName, err))
+		}
+	}
+
+	if spec.Workload != nil {
+		var workload client.Object = &appsv1.Deployment{}
+		if spec.Workload.Kind == WorkloadKindStatefulSet {
+			workload = &appsv1.StatefulSet{}
+		}
+		if err := w.client.Get(ctx, types.NamespacedName{Namespace: migrationRequest.Namespace, Name: spec.Workload.Name}, workload); err != nil {
+			allErrs = append(allErrs, referenceError(specPath.Child("workload", "name"), spec.Workload.Name, err))
+		}
+	}
+
+	pod := &corev1.Pod{}
+	podPath := specPath.Child("podName")
+	if err := w.client.Get(ctx, types.NamespacedName{Namespace: migrationRequest.Namespace, Name: spec.PodName}, pod); err != nil {
+		return append(allErrs, referenceError(podPath, spec.PodName, err))
+	}
+	var claimNames []string
+	for _, volume := range pod.Spec.Volumes {
+		if volume.PersistentVolumeClaim != nil {
+			claimNames = append(claimNames, volume.PersistentVolumeClaim.ClaimName)
+		}
+	}
+	if len(claimNames) == 0 {
+		return append(allErrs, field.Invalid(podPath, spec.PodName, "the pod must have a PersistentVolumeClaim volume"))
+	}
+	if spec.Hooks != nil {
+		hooksPath := specPath.Child("hooks")
+		allErrs = append(allErrs, validateHookContainers(hooksPath.Child("pre"), spec.Hooks.Pre, pod)...)
+		allErrs = append(allErrs, validateHookContainers(hooksPath.Child("post"), spec.Hooks.Post, pod)...)
+	}
+	for _, claimName := range claimNames {
+		if err := w.client.Get(ctx, types.NamespacedName{Namespace: migrationRequest.Namespace, Name: claimName}, &corev1.PersistentVolumeClaim{}); err != nil {
+			allErrs = append(allErrs, referenceError(podPath, spec.PodName, fmt.Errorf("PersistentVolumeClaim %s: %w", claimName, err)))
+		}
+	}
+	return allErrs
+}
+
+// validateHookContainers checks that the hooks run in containers of the source pod
+func validateHookContainers(path *field.Path, hooks []ExecHook, pod *corev1.Pod) field.ErrorList {
+	var allErrs field.ErrorList
+	for i, hook := range hooks {
+		if hook.Container == "" {
+			continue
+		}
+		found := false
+		for _, container := range pod.Spec.Containers {
+			found = found || container.Name == hook.Container
+		}
+		if !found {
+			allErrs = append(allErrs, field.NotFound(path.Index(i).Child("container"), hook.Container))
+		}
+	}
+	return allErrs
+}
+
+// referenceError reports a referenced object that can't be fetched
+func referenceError(path *field.Path, value string, err error) *field.Error {
+	if apierrors.IsNotFound(err) {
+		return field.NotFound(path, value)
+	}
+	return field.InternalError(path, err)
+}
+
+func invalidMigrationRequest(migrationRequest *MigrationRequest, allErrs field.ErrorList) error {
+	if len(allErrs) == 0 {
+		return nil
+	}
+	return apierrors.NewInvalid(GroupVersion.WithKind("MigrationRequest").GroupKind(), migrationRequest.Name, allErrs)
+}
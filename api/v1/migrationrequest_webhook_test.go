@@ -0,0 +1,381 @@
+/*
+Copyright 2023 thehamdiaz.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+// invalidFields returns the sorted fields reported by a validation error, nil when err is nil
+func invalidFields(t *testing.T, err error) []string {
+	t.Helper()
+	if err == nil {
+		return nil
+	}
+	statusErr, ok := err.(*apierrors.StatusError)
+	if !ok || !apierrors.IsInvalid(err) || statusErr.ErrStatus.Details == nil {
+		t.Fatalf("expected an Invalid error, got %v", err)
+	}
+	fields := []string{}
+	for _, cause := range statusErr.ErrStatus.Details.Causes {
+		fields = append(fields, cause.Field)
+	}
+	sort.Strings(fields)
+	return fields
+}
+
+// fakeClient returns a client serving the given objects, the webhooks read the referenced objects with it
+func fakeClient(t *testing.T, objects ...client.Object) client.Reader {
+	t.Helper()
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	if err := AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	return fake.NewClientBuilder().WithScheme(scheme).WithObjects(objects...).Build()
+}
+
+func validMigrationRequest() *MigrationRequest {
+	return &MigrationRequest{
+		ObjectMeta: metav1.ObjectMeta{Name: "migration", Namespace: "apps"},
+		Spec: MigrationRequestSpec{
+			PodName:                 "db-0",
+			DesiredSnapshotCount:    DefaultDesiredSnapshotCount,
+			SnapInterval:            DefaultSnapInterval,
+			VolumeSnapshotClassName: DefaultVolumeSnapshotClassName,
+			Destination: DestinationDef{
+				RemotePool:     "pool",
+				RemoteDataset:  "migrated",
+				RemoteHostName: "node-2",
+			},
+		},
+	}
+}
+
+func TestDefaultMigrationRequest(t *testing.T) {
+	size := resource.MustParse("1Gi")
+	migrationRequest := &MigrationRequest{Spec: MigrationRequestSpec{
+		Convergence: &ConvergencePolicy{MaxDeltaSize: &size},
+		Hooks:       &SnapshotHooks{Pre: []ExecHook{{Command: []string{"sync"}}}},
+		Workload:    &WorkloadReference{Kind: WorkloadKindDeployment, Name: "app"},
+	}}
+	if err := (&migrationRequestWebhook{}).Default(context.Background(), migrationRequest); err != nil {
+		t.Fatal(err)
+	}
+
+	spec := migrationRequest.Spec
+	if spec.DesiredSnapshotCount != DefaultDesiredSnapshotCount || spec.SnapInterval != DefaultSnapInterval ||
+		spec.VolumeSnapshotClassName != DefaultVolumeSnapshotClassName {
+		t.Errorf("defaults not set: %+v", spec)
+	}
+	if spec.Convergence.MaxRounds != DefaultConvergenceMaxRounds {
+		t.Errorf("convergence.maxRounds = %d, want %d", spec.Convergence.MaxRounds, DefaultConvergenceMaxRounds)
+	}
+	if hook := spec.Hooks.Pre[0]; hook.Timeout.Duration != DefaultHookTimeout || hook.OnError != HookErrorFail {
+		t.Errorf("hook = %+v, want the default timeout and onError", hook)
+	}
+	if spec.Consumers != ConsumerPolicyRefuse {
+		t.Errorf("consumers = %q, want %q", spec.Consumers, ConsumerPolicyRefuse)
+	}
+	if spec.Workload.Stop != WorkloadStopScaleToZero {
+		t.Errorf("workload.stop = %q, want %q", spec.Workload.Stop, WorkloadStopScaleToZero)
+	}
+
+	// The controller picks how a StatefulSet is stopped
+	spec.Workload = &WorkloadReference{Kind: WorkloadKindStatefulSet, Name: "db"}
+	defaultMigrationRequestSpec(&spec)
+	if spec.Workload.Stop != "" {
+		t.Errorf("workload.stop = %q, want it unset for a StatefulSet", spec.Workload.Stop)
+	}
+}
+
+func TestValidateMigrationRequestCreate(t *testing.T) {
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "db-0", Namespace: "apps"},
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{{Name: "db"}},
+			Volumes: []corev1.Volume{{Name: "data", VolumeSource: corev1.VolumeSource{
+				PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{ClaimName: "data-db-0"},
+			}}},
+		},
+	}
+	podWithoutClaims := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "apps"}}
+	claim := &corev1.PersistentVolumeClaim{ObjectMeta: metav1.ObjectMeta{Name: "data-db-0", Namespace: "apps"}}
+	target := &MigrationTarget{ObjectMeta: metav1.ObjectMeta{Name: "node-2"}}
+	statefulSet := &appsv1.StatefulSet{ObjectMeta: metav1.ObjectMeta{Name: "db", Namespace: "apps"}}
+	zero := resource.MustParse("0")
+	negative := resource.MustParse("-1")
+	size := resource.MustParse("1Gi")
+
+	tests := []struct {
+		name   string
+		modify func(*MigrationRequest)
+		want   []string
+	}{
+		{
+			name:   "valid",
+			modify: func(r *MigrationRequest) {},
+		},
+		{
+			name: "missing pod name and destination",
+			modify: func(r *MigrationRequest) {
+				r.Spec.PodName = ""
+				r.Spec.Destination = DestinationDef{}
+			},
+			want: []string{"spec.destination.remoteDataset", "spec.destination.remoteHostName", "spec.destination.remotePool", "spec.podName"},
+		},
+		{
+			name: "destination from a target",
+			modify: func(r *MigrationRequest) {
+				r.Spec.TargetName = "node-2"
+				r.Spec.Destination = DestinationDef{RemoteDataset: "migrated"}
+			},
+		},
+		{
+			name:   "dataset path",
+			modify: func(r *MigrationRequest) { r.Spec.Destination.RemoteDataset = "migrated/db" },
+			want:   []string{"spec.destination.remoteDataset"},
+		},
+		{
+			name: "dataset path from a target",
+			modify: func(r *MigrationRequest) {
+				r.Spec.TargetName = "node-2"
+				r.Spec.Destination = DestinationDef{RemoteDataset: "Migrated_DB"}
+			},
+			want: []string{"spec.destination.remoteDataset"},
+		},
+		{
+			name:   "ssh without the IP of the destination",
+			modify: func(r *MigrationRequest) { r.Spec.Destination.User = "migration" },
+			want:   []string{"spec.destination.remoteHostIP"},
+		},
+		{
+			name: "invalid settings",
+			modify: func(r *MigrationRequest) {
+				r.Spec.DesiredSnapshotCount = 0
+				r.Spec.SnapInterval = -1
+				r.Spec.MaxDowntime = &metav1.Duration{}
+				r.Spec.BandwidthLimit = &negative
+			},
+			want: []string{"spec.bandwidthLimit", "spec.desiredSnapshotCount", "spec.maxDowntime", "spec.snapInterval"},
+		},
+		{
+			name:   "convergence without a budget",
+			modify: func(r *MigrationRequest) { r.Spec.Convergence = &ConvergencePolicy{MaxRounds: 3} },
+			want:   []string{"spec.convergence"},
+		},
+		{
+			name: "convergence with empty budgets",
+			modify: func(r *MigrationRequest) {
+				r.Spec.Convergence = &ConvergencePolicy{MaxDeltaSize: &zero, MaxDeltaDuration: &metav1.Duration{}}
+			},
+			want: []string{"spec.convergence.maxDeltaDuration", "spec.convergence.maxDeltaSize", "spec.convergence.maxRounds"},
+		},
+		{
+			name: "convergence",
+			modify: func(r *MigrationRequest) {
+				r.Spec.Convergence = &ConvergencePolicy{MaxDeltaSize: &size, MaxRounds: 3}
+			},
+		},
+		{
+			name: "invalid hooks",
+			modify: func(r *MigrationRequest) {
+				r.Spec.Hooks = &SnapshotHooks{
+					Pre:  []ExecHook{{Container: "db", Command: []string{"sync"}}, {}},
+					Post: []ExecHook{{Command: []string{"true"}, Timeout: &metav1.Duration{Duration: -time.Second}}},
+				}
+			},
+			want: []string{"spec.hooks.post[0].timeout", "spec.hooks.pre[1].command"},
+		},
+		{
+			name: "hook in a missing container",
+			modify: func(r *MigrationRequest) {
+				r.Spec.Hooks = &SnapshotHooks{Pre: []ExecHook{{Container: "sidecar", Command: []string{"sync"}}}}
+			},
+			want: []string{"spec.hooks.pre[0].container"},
+		},
+		{
+			name: "workload",
+			modify: func(r *MigrationRequest) {
+				r.Spec.Workload = &WorkloadReference{Kind: WorkloadKindStatefulSet, Name: "db"}
+			},
+		},
+		{
+			name: "missing workload",
+			modify: func(r *MigrationRequest) {
+				r.Spec.Workload = &WorkloadReference{Kind: WorkloadKindDeployment, Name: "db"}
+			},
+			want: []string{"spec.workload.name"},
+		},
+		{
+			name: "pod of a Deployment deleted alone",
+			modify: func(r *MigrationRequest) {
+				r.Spec.Workload = &WorkloadReference{Kind: WorkloadKindDeployment, Name: "db", Stop: WorkloadStopDeletePod}
+			},
+			want: []string{"spec.workload.stop"},
+		},
+		{
+			name: "pod of a StatefulSet deleted alone for another cluster",
+			modify: func(r *MigrationRequest) {
+				r.Spec.Workload = &WorkloadReference{Kind: WorkloadKindStatefulSet, Name: "db", Stop: WorkloadStopDeletePod}
+				r.Spec.Destination.KubeconfigSecretName = "destination"
+			},
+			want: []string{"spec.workload.stop"},
+		},
+		{
+			name:   "workload without a name",
+			modify: func(r *MigrationRequest) { r.Spec.Workload = &WorkloadReference{Kind: WorkloadKindStatefulSet} },
+			want:   []string{"spec.workload.name"},
+		},
+		{
+			name:   "missing target",
+			modify: func(r *MigrationRequest) { r.Spec.TargetName = "node-3" },
+			want:   []string{"spec.targetName"},
+		},
+		{
+			name:   "missing pod",
+			modify: func(r *MigrationRequest) { r.Spec.PodName = "db-1" },
+			want:   []string{"spec.podName"},
+		},
+		{
+			name:   "pod in another namespace",
+			modify: func(r *MigrationRequest) { r.Namespace = "default" },
+			want:   []string{"spec.podName"},
+		},
+		{
+			name:   "pod without claims",
+			modify: func(r *MigrationRequest) { r.Spec.PodName = "web" },
+			want:   []string{"spec.podName"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := &migrationRequestWebhook{client: fakeClient(t, pod, podWithoutClaims, claim, statefulSet, target)}
+			migrationRequest := validMigrationRequest()
+			tt.modify(migrationRequest)
+
+			err := w.ValidateCreate(context.Background(), migrationRequest)
+			if got := invalidFields(t, err); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ValidateCreate() fields = %v, want %v (%v)", got, tt.want, err)
+			}
+		})
+	}
+}
+
+func TestValidateMigrationRequestUpdate(t *testing.T) {
+	limit := resource.MustParse("10Mi")
+
+	tests := []struct {
+		name        string
+		phase       MigrationPhase
+		failedPhase MigrationPhase
+		oldAbort    bool
+		modify      func(*MigrationRequest)
+		want        []string
+	}{
+		{
+			name:   "spec changed before the migration started",
+			phase:  MigrationPhasePending,
+			modify: func(r *MigrationRequest) { r.Spec.DesiredSnapshotCount = 5 },
+		},
+		{
+			name:   "spec changed once the migration started",
+			phase:  MigrationPhaseSending,
+			modify: func(r *MigrationRequest) { r.Spec.DesiredSnapshotCount = 5 },
+			want:   []string{"spec"},
+		},
+		{
+			name:  "mutable fields changed once the migration started",
+			phase: MigrationPhaseSending,
+			modify: func(r *MigrationRequest) {
+				r.Spec.BandwidthLimit = &limit
+				r.Spec.MaxDowntime = &metav1.Duration{Duration: time.Minute}
+				r.Spec.Suspend = true
+				r.Spec.Consumers = ConsumerPolicyDelete
+			},
+		},
+		{
+			name:   "abort while sending",
+			phase:  MigrationPhaseSending,
+			modify: func(r *MigrationRequest) { r.Spec.Abort = true },
+		},
+		{
+			name:   "abort while restoring",
+			phase:  MigrationPhaseRestoring,
+			modify: func(r *MigrationRequest) { r.Spec.Abort = true },
+			want:   []string{"spec.abort"},
+		},
+		{
+			name:        "abort of a migration failed while sending",
+			phase:       MigrationPhaseFailed,
+			failedPhase: MigrationPhaseSending,
+			modify:      func(r *MigrationRequest) { r.Spec.Abort = true },
+		},
+		{
+			name:        "abort of a migration failed while restoring",
+			phase:       MigrationPhaseFailed,
+			failedPhase: MigrationPhaseRestoring,
+			modify:      func(r *MigrationRequest) { r.Spec.Abort = true },
+			want:        []string{"spec.abort"},
+		},
+		{
+			name:   "abort of a migration failed in an unknown phase",
+			phase:  MigrationPhaseFailed,
+			modify: func(r *MigrationRequest) { r.Spec.Abort = true },
+			want:   []string{"spec.abort"},
+		},
+		{
+			name:     "abort undone",
+			phase:    MigrationPhaseAborting,
+			oldAbort: true,
+			modify:   func(r *MigrationRequest) { r.Spec.Abort = false },
+			want:     []string{"spec.abort"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := &migrationRequestWebhook{client: fakeClient(t)}
+			oldMigrationRequest := validMigrationRequest()
+			oldMigrationRequest.Spec.Abort = tt.oldAbort
+			oldMigrationRequest.Status.Phase = tt.phase
+			oldMigrationRequest.Status.FailedPhase = tt.failedPhase
+			migrationRequest := oldMigrationRequest.DeepCopy()
+			tt.modify(migrationRequest)
+
+			err := w.ValidateUpdate(context.Background(), oldMigrationRequest, migrationRequest)
+			if got := invalidFields(t, err); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ValidateUpdate() fields = %v, want %v (%v)", got, tt.want, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,143 @@
+/*
+Copyright 2023 thehamdiaz.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// TargetTransport is how the snapshots reach the destination node
+type TargetTransport string
+
+const (
+	// TransportAgent streams the snapshots to the node agent of the destination node
+	TransportAgent TargetTransport = "Agent"
+	// TransportSSH runs zfs receive on the destination node over ssh
+	TransportSSH TargetTransport = "SSH"
+)
+
+// MigrationTargetSpec describes a destination the MigrationRequests can reference by name
+type MigrationTargetSpec struct {
+	// NodeName is the destination node, a node of the destination cluster when Cluster is set
+	NodeName string `json:"nodeName"`
+	// Pool is the ZFS pool the volumes are received in
+	Pool string `json:"pool"`
+	// DatasetPrefix is prepended to the dataset names of the MigrationRequests, e.g. migrated-.
+	// The datasets are received directly under the pool, the prefix can't hold a /.
+	// +optional
+	DatasetPrefix string `json:"datasetPrefix,omitempty"`
+
+	// Transport is how the snapshots reach the destination node
+	// +kubebuilder:validation:Enum=Agent;SSH
+	// +kubebuilder:default=Agent
+	// +optional
+	Transport TargetTransport `json:"transport,omitempty"`
+	// SSH configures the SSH transport, it is required by it
+	// +optional
+	SSH *SSHTarget `json:"ssh,omitempty"`
+
+	// Cluster is the cluster the destination node belongs to, the local cluster when unset
+	// +optional
+	Cluster *TargetCluster `json:"cluster,omitempty"`
+}
+
+// DatasetNameErrors returns why a dataset can't be received into, none when it can. The dataset is received directly
+// under the pool and names the ZFSVolume and the volume handle of the restored volume: it must be a DNS-1123 subdomain,
+// which is a single component of a ZFS path.
+func DatasetNameErrors(name string) []string {
+	return validation.IsDNS1123Subdomain(name)
+}
+
+// DatasetPrefixErrors returns why a DatasetPrefix can't be prepended to the dataset names, none when it can
+func DatasetPrefixErrors(prefix string) []string {
+	// The prefix is followed by the name of a dataset, which starts with an alphanumeric character
+	return validation.IsDNS1123Subdomain(prefix + "0")
+}
+
+// SSHTarget is the ssh login on the destination node
+type SSHTarget struct {
+	User   string `json:"user"`
+	HostIP string `json:"hostIP"`
+	// CredentialsSecretRef is a Secret holding the ssh identity under ssh-privatekey and the known_hosts entries
+	// of the destination under known_hosts, like DestinationDef.CredentialsSecretName
+	// +optional
+	CredentialsSecretRef *corev1.SecretReference `json:"credentialsSecretRef,omitempty"`
+	// InsecureSkipHostKeyVerification accepts any host key of the destination, like DestinationDef.InsecureSkipHostKeyVerification
+	// +optional
+	InsecureSkipHostKeyVerification bool `json:"insecureSkipHostKeyVerification,omitempty"`
+}
+
+// TargetCluster is a remote cluster
+type TargetCluster struct {
+	// KubeconfigSecretRef is a Secret holding the kubeconfig of the cluster, like DestinationDef.KubeconfigSecretName
+	KubeconfigSecretRef corev1.SecretReference `json:"kubeconfigSecretRef"`
+}
+
+// The condition types of a MigrationTarget
+const (
+	// TargetConditionValid tells whether the referenced node, pool and Secrets exist
+	TargetConditionValid = "Valid"
+	// TargetConditionReachable tells whether the node agent of the destination node answered the last check
+	TargetConditionReachable = "Reachable"
+)
+
+// MigrationTargetStatus defines the observed state of MigrationTarget
+type MigrationTargetStatus struct {
+	// Reachable mirrors the Reachable condition
+	Reachable bool `json:"reachable,omitempty"`
+	// LastCheckTime is when the destination was last checked
+	LastCheckTime *metav1.Time `json:"lastCheckTime,omitempty"`
+
+	// Conditions are the latest observations of the target
+	// +listType=map
+	// +listMapKey=type
+	// +optional
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:subresource:status
+//+kubebuilder:resource:scope=Cluster
+//+kubebuilder:printcolumn:name="Node",type=string,JSONPath=`.spec.nodeName`
+//+kubebuilder:printcolumn:name="Pool",type=string,JSONPath=`.spec.pool`
+//+kubebuilder:printcolumn:name="Transport",type=string,JSONPath=`.spec.transport`
+//+kubebuilder:printcolumn:name="Reachable",type=boolean,JSONPath=`.status.reachable`
+//+kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+
+// MigrationTarget is the Schema for the migrationtargets API
+type MigrationTarget struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   MigrationTargetSpec   `json:"spec,omitempty"`
+	Status MigrationTargetStatus `json:"status,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// MigrationTargetList contains a list of MigrationTarget
+type MigrationTargetList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []MigrationTarget `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&MigrationTarget{}, &MigrationTargetList{})
+}
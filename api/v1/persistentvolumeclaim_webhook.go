@@ -0,0 +1,77 @@
+/*
+Copyright 2023 thehamdiaz.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	"context"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+)
+
+var persistentvolumeclaimlog = logf.Log.WithName("persistentvolumeclaim-resource")
+
+// SetupPersistentVolumeClaimWebhookWithManager registers the webhook refusing the claims named after the claims of
+// a migration being cut over. A StatefulSet recreates the claims of its pods from its volumeClaimTemplates, and with
+// a dynamic StorageClass the claim would bind to a new empty volume instead of the restored one.
+func SetupPersistentVolumeClaimWebhookWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr).
+		For(&corev1.PersistentVolumeClaim{}).
+		WithValidator(&persistentVolumeClaimWebhook{client: mgr.GetClient()}).
+		Complete()
+}
+
+// The webhook sees the claims of the whole cluster, they aren't refused when it is unavailable
+//+kubebuilder:webhook:path=/validate--v1-persistentvolumeclaim,mutating=false,failurePolicy=ignore,sideEffects=None,groups="",resources=persistentvolumeclaims,verbs=create,versions=v1,name=vpersistentvolumeclaim.kb.io,admissionReviewVersions=v1
+
+type persistentVolumeClaimWebhook struct {
+	client client.Reader
+}
+
+var _ webhook.CustomValidator = &persistentVolumeClaimWebhook{}
+
+// ValidateCreate implements webhook.CustomValidator so a webhook will be registered for the type
+func (w *persistentVolumeClaimWebhook) ValidateCreate(ctx context.Context, obj runtime.Object) error {
+	pvc, ok := obj.(*corev1.PersistentVolumeClaim)
+	if !ok {
+		return fmt.Errorf("expected a PersistentVolumeClaim but got a %T", obj)
+	}
+
+	migrationRequest, _, err := lockingMigration(ctx, w.client, pvc.Namespace, pvc.Annotations, map[string]bool{pvc.Name: true})
+	if err != nil || migrationRequest == nil {
+		return err
+	}
+	persistentvolumeclaimlog.Info("claim refused", "pvc", pvc.Name, "migrationRequest", migrationRequest.Name)
+	return apierrors.NewForbidden(corev1.Resource("persistentvolumeclaims"), pvc.Name,
+		fmt.Errorf("PersistentVolumeClaim %s is being migrated by MigrationRequest %s", pvc.Name, migrationRequest.Name))
+}
+
+// ValidateUpdate implements webhook.CustomValidator so a webhook will be registered for the type
+func (w *persistentVolumeClaimWebhook) ValidateUpdate(ctx context.Context, oldObj, newObj runtime.Object) error {
+	return nil
+}
+
+// ValidateDelete implements webhook.CustomValidator so a webhook will be registered for the type
+func (w *persistentVolumeClaimWebhook) ValidateDelete(ctx context.Context, obj runtime.Object) error {
+	return nil
+}
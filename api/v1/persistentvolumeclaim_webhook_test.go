@@ -0,0 +1,81 @@
+/*
+Copyright 2023 thehamdiaz.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	"context"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestValidatePersistentVolumeClaimCreate(t *testing.T) {
+	migrationRequest := &MigrationRequest{ObjectMeta: metav1.ObjectMeta{Name: "migration", Namespace: "apps"}}
+	migrationRequest.Status.Phase = MigrationPhaseRestoring
+	migrationRequest.Status.Volumes = []MigratedVolume{{Name: "data", PersistentVolumeClaimName: "data-db-0"}}
+	meta.SetStatusCondition(&migrationRequest.Status.Conditions, metav1.Condition{
+		Type: MigrationConditionPodStopped, Status: metav1.ConditionTrue, Reason: ReasonPodStopped,
+	})
+	claim := func(namespace, name, migrationRequestName string) *corev1.PersistentVolumeClaim {
+		pvc := &corev1.PersistentVolumeClaim{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace}}
+		if migrationRequestName != "" {
+			pvc.Annotations = map[string]string{MigrationRequestAnnotation: migrationRequestName}
+		}
+		return pvc
+	}
+
+	tests := []struct {
+		name      string
+		pvc       *corev1.PersistentVolumeClaim
+		forbidden bool
+	}{
+		{
+			name:      "claim recreated from a volumeClaimTemplate",
+			pvc:       claim("apps", "data-db-0", ""),
+			forbidden: true,
+		},
+		{
+			name: "restored claim of the migration",
+			pvc:  claim("apps", "data-db-0", "migration"),
+		},
+		{
+			name:      "claim of another migration",
+			pvc:       claim("apps", "data-db-0", "other"),
+			forbidden: true,
+		},
+		{
+			name: "other claim",
+			pvc:  claim("apps", "data-db-1", ""),
+		},
+		{
+			name: "claim of another namespace",
+			pvc:  claim("default", "data-db-0", ""),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := &persistentVolumeClaimWebhook{client: fakeClient(t, migrationRequest)}
+			err := w.ValidateCreate(context.Background(), tt.pvc)
+			if tt.forbidden != apierrors.IsForbidden(err) || (!tt.forbidden && err != nil) {
+				t.Errorf("ValidateCreate() = %v, want forbidden %t", err, tt.forbidden)
+			}
+		})
+	}
+}
@@ -0,0 +1,107 @@
+/*
+Copyright 2023 thehamdiaz.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	"context"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+)
+
+var podlog = logf.Log.WithName("pod-resource")
+
+// SetupPodWebhookWithManager registers the webhook refusing the pods that mount the claims of a migration being cut over,
+// so that neither the workload of the source pod nor anything else writes to the volumes while the final snapshot is sent
+func SetupPodWebhookWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr).
+		For(&corev1.Pod{}).
+		WithValidator(&podWebhook{client: mgr.GetClient()}).
+		Complete()
+}
+
+// The webhook sees the pods of the whole cluster, they aren't refused when it is unavailable
+//+kubebuilder:webhook:path=/validate--v1-pod,mutating=false,failurePolicy=ignore,sideEffects=None,groups="",resources=pods,verbs=create,versions=v1,name=vpod.kb.io,admissionReviewVersions=v1
+
+type podWebhook struct {
+	client client.Reader
+}
+
+var _ webhook.CustomValidator = &podWebhook{}
+
+// ValidateCreate implements webhook.CustomValidator so a webhook will be registered for the type
+func (w *podWebhook) ValidateCreate(ctx context.Context, obj runtime.Object) error {
+	pod, ok := obj.(*corev1.Pod)
+	if !ok {
+		return fmt.Errorf("expected a Pod but got a %T", obj)
+	}
+
+	claims := map[string]bool{}
+	for _, volume := range pod.Spec.Volumes {
+		if volume.PersistentVolumeClaim != nil {
+			claims[volume.PersistentVolumeClaim.ClaimName] = true
+		}
+	}
+	if len(claims) == 0 {
+		return nil
+	}
+
+	migrationRequest, claimName, err := lockingMigration(ctx, w.client, pod.Namespace, pod.Annotations, claims)
+	if err != nil || migrationRequest == nil {
+		return err
+	}
+	podlog.Info("pod refused", "pod", pod.Name, "generateName", pod.GenerateName, "pvc", claimName)
+	return apierrors.NewForbidden(corev1.Resource("pods"), pod.Name,
+		fmt.Errorf("PersistentVolumeClaim %s is being migrated by MigrationRequest %s", claimName, migrationRequest.Name))
+}
+
+// lockingMigration returns the MigrationRequest locking one of the claims and the name of that claim, nil when none
+// does. The objects annotated with the name of the MigrationRequest are its own and aren't refused.
+func lockingMigration(ctx context.Context, c client.Reader, namespace string, annotations map[string]string, claims map[string]bool) (*MigrationRequest, string, error) {
+	migrationRequests := &MigrationRequestList{}
+	if err := c.List(ctx, migrationRequests, client.InNamespace(namespace)); err != nil {
+		return nil, "", err
+	}
+	for i := range migrationRequests.Items {
+		migrationRequest := &migrationRequests.Items[i]
+		if !migrationRequest.ClaimsLocked() || annotations[MigrationRequestAnnotation] == migrationRequest.Name {
+			continue
+		}
+		for _, volume := range migrationRequest.Status.Volumes {
+			if claims[volume.PersistentVolumeClaimName] {
+				return migrationRequest, volume.PersistentVolumeClaimName, nil
+			}
+		}
+	}
+	return nil, "", nil
+}
+
+// ValidateUpdate implements webhook.CustomValidator so a webhook will be registered for the type
+func (w *podWebhook) ValidateUpdate(ctx context.Context, oldObj, newObj runtime.Object) error {
+	return nil
+}
+
+// ValidateDelete implements webhook.CustomValidator so a webhook will be registered for the type
+func (w *podWebhook) ValidateDelete(ctx context.Context, obj runtime.Object) error {
+	return nil
+}
@@ -0,0 +1,132 @@
+/*
+Copyright 2023 thehamdiaz.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	"context"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestValidatePodCreate(t *testing.T) {
+	// migratingClaim returns a MigrationRequest of the data-db-0 claim in the phase, after the source pod was stopped
+	migratingClaim := func(name string, phase MigrationPhase) *MigrationRequest {
+		migrationRequest := &MigrationRequest{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "apps"}}
+		migrationRequest.Status.Phase = phase
+		migrationRequest.Status.Volumes = []MigratedVolume{{Name: "data", PersistentVolumeClaimName: "data-db-0"}}
+		meta.SetStatusCondition(&migrationRequest.Status.Conditions, metav1.Condition{
+			Type: MigrationConditionPodStopped, Status: metav1.ConditionTrue, Reason: ReasonPodStopped,
+		})
+		return migrationRequest
+	}
+	pod := func(namespace, claimName string) *corev1.Pod {
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: "db-0", Namespace: namespace},
+			Spec: corev1.PodSpec{Volumes: []corev1.Volume{{Name: "data", VolumeSource: corev1.VolumeSource{
+				PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{ClaimName: claimName},
+			}}}},
+		}
+	}
+
+	tests := []struct {
+		name             string
+		migrationRequest *MigrationRequest
+		pod              *corev1.Pod
+		forbidden        bool
+	}{
+		{
+			name:             "claim being cut over",
+			migrationRequest: migratingClaim("migration", MigrationPhaseSnapshotting),
+			pod:              pod("apps", "data-db-0"),
+			forbidden:        true,
+		},
+		{
+			name:             "claim being restored",
+			migrationRequest: migratingClaim("migration", MigrationPhaseRestoring),
+			pod:              pod("apps", "data-db-0"),
+			forbidden:        true,
+		},
+		{
+			name:             "migrated pod of the migration",
+			migrationRequest: migratingClaim("migration", MigrationPhaseRestoring),
+			pod: func() *corev1.Pod {
+				pod := pod("apps", "data-db-0")
+				pod.Annotations = map[string]string{MigrationRequestAnnotation: "migration"}
+				return pod
+			}(),
+		},
+		{
+			name:             "migrated pod of another migration",
+			migrationRequest: migratingClaim("migration", MigrationPhaseRestoring),
+			pod: func() *corev1.Pod {
+				pod := pod("apps", "data-db-0")
+				pod.Annotations = map[string]string{MigrationRequestAnnotation: "other"}
+				return pod
+			}(),
+			forbidden: true,
+		},
+		{
+			name:             "other claim",
+			migrationRequest: migratingClaim("migration", MigrationPhaseSnapshotting),
+			pod:              pod("apps", "data-db-1"),
+		},
+		{
+			name:             "claim of another namespace",
+			migrationRequest: migratingClaim("migration", MigrationPhaseSnapshotting),
+			pod:              pod("default", "data-db-0"),
+		},
+		{
+			name: "source pod still running",
+			migrationRequest: &MigrationRequest{
+				ObjectMeta: metav1.ObjectMeta{Name: "migration", Namespace: "apps"},
+				Status: MigrationRequestStatus{
+					Phase:   MigrationPhaseSending,
+					Volumes: []MigratedVolume{{Name: "data", PersistentVolumeClaimName: "data-db-0"}},
+				},
+			},
+			pod: pod("apps", "data-db-0"),
+		},
+		{
+			name:             "migration completed",
+			migrationRequest: migratingClaim("migration", MigrationPhaseCompleted),
+			pod:              pod("apps", "data-db-0"),
+		},
+		{
+			name:             "migration aborted",
+			migrationRequest: migratingClaim("migration", MigrationPhaseAborted),
+			pod:              pod("apps", "data-db-0"),
+		},
+		{
+			name:             "pod without claims",
+			migrationRequest: migratingClaim("migration", MigrationPhaseSnapshotting),
+			pod:              &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "apps"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := &podWebhook{client: fakeClient(t, tt.migrationRequest)}
+			err := w.ValidateCreate(context.Background(), tt.pod)
+			if tt.forbidden != apierrors.IsForbidden(err) || (!tt.forbidden && err != nil) {
+				t.Errorf("ValidateCreate() = %v, want forbidden %t", err, tt.forbidden)
+			}
+		})
+	}
+}
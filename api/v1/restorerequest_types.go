@@ -33,6 +33,20 @@ type RestoreRequestSpec struct {
 	// Foo is an example field of RestoreRequest. Edit restorerequest_types.go to remove/update
 	Names      Names      `json:"names"`
 	Parameters Parameters `json:"parameters"`
+
+	// Source locates the MigrationRequest when it lives in another cluster
+	// +optional
+	Source *MigrationSource `json:"source,omitempty"`
+}
+
+// MigrationSource is the MigrationRequest of a RestoreRequest created from another cluster
+type MigrationSource struct {
+	// Namespace of the MigrationRequest
+	Namespace string `json:"namespace"`
+	// KubeconfigSecretName is a Secret in the namespace of the RestoreRequest holding the kubeconfig of the source
+	// cluster under kubeconfig. Without it the completion isn't reported, the MigrationRequest polls the RestoreRequest instead.
+	// +optional
+	KubeconfigSecretName string `json:"kubeconfigSecretName,omitempty"`
 }
 
 type Names struct {
@@ -40,9 +54,13 @@ type Names struct {
 	StorageClassName     string `json:"storageClassName"`
 	PVName               string `json:"pvName"`
 	PVCName              string `json:"pvcName"`
-	ZFSDatasetName       string `json:"zfsDatasetName"`
-	ZFSPoolName          string `json:"zfsPoolName"`
-	TargetNodeName       string `json:"targetNodeName"`
+	// PVCNamespace is the namespace of the restored PersistentVolumeClaim, the one of the migrated pod.
+	// It is the namespace of the RestoreRequest when unset.
+	// +optional
+	PVCNamespace   string `json:"pvcNamespace,omitempty"`
+	ZFSDatasetName string `json:"zfsDatasetName"`
+	ZFSPoolName    string `json:"zfsPoolName"`
+	TargetNodeName string `json:"targetNodeName"`
 }
 
 type Parameters struct {
@@ -57,13 +75,40 @@ type RestoreRequestStatus struct {
 	// INSERT ADDITIONAL STATUS FIELD - define observed state of cluster
 	// Important: Run "make" to regenerate code after modifying this file
 	ReceivedSnapshots int64  `json:"receivedSnapshots,omitempty"`
-	DatasetReady      string `json:"datasetReady,omitempty"`
-	Succeeded         string `json:"succeeded,omitempty"`
 	Message           string `json:"message,omitempty"`
+
+	// Conditions are the latest observations of the restore, see the RestoreCondition constants
+	// +listType=map
+	// +listMapKey=type
+	// +optional
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
 }
 
+// The condition types of a RestoreRequest
+const (
+	// RestoreConditionDatasetReady is True once the received dataset is prepared to be mounted by the CSI driver
+	RestoreConditionDatasetReady = "DatasetReady"
+	// RestoreConditionRestored is True once the PersistentVolume, PersistentVolumeClaim and ZFSVolume are created
+	RestoreConditionRestored = "Restored"
+)
+
+// The reasons of the RestoreRequest conditions
+const (
+	ReasonMountpointFailed            = "MountpointFailed"
+	ReasonPersistentVolumeFailed      = "PersistentVolumeFailed"
+	ReasonPersistentVolumeClaimFailed = "PersistentVolumeClaimFailed"
+	ReasonZFSVolumeFailed             = "ZFSVolumeFailed"
+	ReasonDatasetReady                = "DatasetReady"
+)
+
 //+kubebuilder:object:root=true
 //+kubebuilder:subresource:status
+//+kubebuilder:printcolumn:name="Migration",type=string,JSONPath=`.spec.names.migrationRequestName`
+//+kubebuilder:printcolumn:name="Node",type=string,JSONPath=`.spec.names.targetNodeName`
+//+kubebuilder:printcolumn:name="PVC",type=string,JSONPath=`.spec.names.pvcName`
+//+kubebuilder:printcolumn:name="Restored",type=string,JSONPath=`.status.conditions[?(@.type=="Restored")].status`
+//+kubebuilder:printcolumn:name="Message",type=string,JSONPath=`.status.message`,priority=1
+//+kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
 
 // RestoreRequest is the Schema for the restorerequests API
 type RestoreRequest struct {
@@ -74,6 +119,14 @@ type RestoreRequest struct {
 	Status RestoreRequestStatus `json:"status,omitempty"`
 }
 
+// ClaimNamespace returns the namespace of the restored PersistentVolumeClaim
+func (r *RestoreRequest) ClaimNamespace() string {
+	if r.Spec.Names.PVCNamespace != "" {
+		return r.Spec.Names.PVCNamespace
+	}
+	return r.Namespace
+}
+
 //+kubebuilder:object:root=true
 
 // RestoreRequestList contains a list of RestoreRequest
@@ -0,0 +1,151 @@
+/*
+Copyright 2023 thehamdiaz.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	ctrl "sigs.k8s.io/controller-runtime"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+)
+
+// log is for logging in this package.
+var restorerequestlog = logf.Log.WithName("restorerequest-resource")
+
+// SetupWebhookWithManager registers the defaulting and validating webhooks of the RestoreRequests
+func (r *RestoreRequest) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	hook := &restoreRequestWebhook{}
+	return ctrl.NewWebhookManagedBy(mgr).
+		For(r).
+		WithDefaulter(hook).
+		WithValidator(hook).
+		Complete()
+}
+
+//+kubebuilder:webhook:path=/mutate-api-k8s-zfs-volume-migrator-io-v1-restorerequest,mutating=true,failurePolicy=fail,sideEffects=None,groups=api.k8s.zfs-volume-migrator.io,resources=restorerequests,verbs=create;update,versions=v1,name=mrestorerequest.kb.io,admissionReviewVersions=v1
+//+kubebuilder:webhook:path=/validate-api-k8s-zfs-volume-migrator-io-v1-restorerequest,mutating=false,failurePolicy=fail,sideEffects=None,groups=api.k8s.zfs-volume-migrator.io,resources=restorerequests,verbs=create;update,versions=v1,name=vrestorerequest.kb.io,admissionReviewVersions=v1
+
+type restoreRequestWebhook struct{}
+
+var _ webhook.CustomDefaulter = &restoreRequestWebhook{}
+var _ webhook.CustomValidator = &restoreRequestWebhook{}
+
+// Default implements webhook.CustomDefaulter so a webhook will be registered for the type
+func (w *restoreRequestWebhook) Default(ctx context.Context, obj runtime.Object) error {
+	restoreRequest, ok := obj.(*RestoreRequest)
+	if !ok {
+		return fmt.Errorf("expected a RestoreRequest but got a %T", obj)
+	}
+	restorerequestlog.Info("default", "name", restoreRequest.Name)
+
+	defaultRestoreRequestSpec(&restoreRequest.Spec)
+	return nil
+}
+
+// defaultRestoreRequestSpec sets the defaults of a RestoreRequest spec
+func defaultRestoreRequestSpec(spec *RestoreRequestSpec) {
+	if len(spec.Parameters.AccessModes) == 0 {
+		spec.Parameters.AccessModes = []corev1.PersistentVolumeAccessMode{corev1.ReadWriteOnce}
+	}
+	if spec.Parameters.ReclaimPolicy == "" {
+		spec.Parameters.ReclaimPolicy = corev1.PersistentVolumeReclaimRetain
+	}
+}
+
+// ValidateCreate implements webhook.CustomValidator so a webhook will be registered for the type
+func (w *restoreRequestWebhook) ValidateCreate(ctx context.Context, obj runtime.Object) error {
+	restoreRequest, ok := obj.(*RestoreRequest)
+	if !ok {
+		return fmt.Errorf("expected a RestoreRequest but got a %T", obj)
+	}
+	restorerequestlog.Info("validate create", "name", restoreRequest.Name)
+
+	return invalidRestoreRequest(restoreRequest, validateRestoreRequestSpec(&restoreRequest.Spec))
+}
+
+// ValidateUpdate implements webhook.CustomValidator so a webhook will be registered for the type
+func (w *restoreRequestWebhook) ValidateUpdate(ctx context.Context, oldObj, newObj runtime.Object) error {
+	oldRestoreRequest, ok := oldObj.(*RestoreRequest)
+	if !ok {
+		return fmt.Errorf("expected a RestoreRequest but got a %T", oldObj)
+	}
+	restoreRequest, ok := newObj.(*RestoreRequest)
+	if !ok {
+		return fmt.Errorf("expected a RestoreRequest but got a %T", newObj)
+	}
+	restorerequestlog.Info("validate update", "name", restoreRequest.Name)
+
+	allErrs := validateRestoreRequestSpec(&restoreRequest.Spec)
+	if !equality.Semantic.DeepEqual(oldRestoreRequest.Spec, restoreRequest.Spec) {
+		allErrs = append(allErrs, field.Forbidden(field.NewPath("spec"), "the spec of a RestoreRequest is immutable"))
+	}
+	return invalidRestoreRequest(restoreRequest, allErrs)
+}
+
+// ValidateDelete implements webhook.CustomValidator so a webhook will be registered for the type
+func (w *restoreRequestWebhook) ValidateDelete(ctx context.Context, obj runtime.Object) error {
+	return nil
+}
+
+func validateRestoreRequestSpec(spec *RestoreRequestSpec) field.ErrorList {
+	var allErrs field.ErrorList
+	namesPath := field.NewPath("spec", "names")
+	names := spec.Names
+	for _, name := range []struct {
+		field string
+		value string
+	}{
+		{"migrationRequestName", names.MigrationRequestName},
+		{"storageClassName", names.StorageClassName},
+		{"pvName", names.PVName},
+		{"pvcName", names.PVCName},
+		{"zfsDatasetName", names.ZFSDatasetName},
+		{"zfsPoolName", names.ZFSPoolName},
+		{"targetNodeName", names.TargetNodeName},
+	} {
+		if name.value == "" {
+			allErrs = append(allErrs, field.Required(namesPath.Child(name.field), ""))
+		}
+	}
+
+	if names.ZFSDatasetName != "" {
+		if errs := DatasetNameErrors(names.ZFSDatasetName); len(errs) > 0 {
+			allErrs = append(allErrs, field.Invalid(namesPath.Child("zfsDatasetName"), names.ZFSDatasetName, strings.Join(errs, ", ")))
+		}
+	}
+
+	capacity := spec.Parameters.Capacity
+	if capacity.Sign() <= 0 {
+		allErrs = append(allErrs, field.Invalid(field.NewPath("spec", "parameters", "capacity"), capacity.String(), "must be greater than zero"))
+	}
+	return allErrs
+}
+
+func invalidRestoreRequest(restoreRequest *RestoreRequest, allErrs field.ErrorList) error {
+	if len(allErrs) == 0 {
+		return nil
+	}
+	return apierrors.NewInvalid(GroupVersion.WithKind("RestoreRequest").GroupKind(), restoreRequest.Name, allErrs)
+}
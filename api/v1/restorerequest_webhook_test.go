@@ -0,0 +1,135 @@
+/*
+Copyright 2023 thehamdiaz.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func validRestoreRequest() *RestoreRequest {
+	return &RestoreRequest{
+		ObjectMeta: metav1.ObjectMeta{Name: "restore", Namespace: "apps"},
+		Spec: RestoreRequestSpec{
+			Names: Names{
+				MigrationRequestName: "migration",
+				StorageClassName:     "zfs",
+				PVName:               "pv-data",
+				PVCName:              "data",
+				ZFSDatasetName:       "migrated-pvc-1",
+				ZFSPoolName:          "pool",
+				TargetNodeName:       "node-2",
+			},
+			Parameters: Parameters{Capacity: resource.MustParse("1Gi")},
+		},
+	}
+}
+
+func TestDefaultRestoreRequest(t *testing.T) {
+	restoreRequest := validRestoreRequest()
+	if err := (&restoreRequestWebhook{}).Default(context.Background(), restoreRequest); err != nil {
+		t.Fatal(err)
+	}
+	parameters := restoreRequest.Spec.Parameters
+	if !reflect.DeepEqual(parameters.AccessModes, []corev1.PersistentVolumeAccessMode{corev1.ReadWriteOnce}) {
+		t.Errorf("accessModes = %v, want ReadWriteOnce", parameters.AccessModes)
+	}
+	if parameters.ReclaimPolicy != corev1.PersistentVolumeReclaimRetain {
+		t.Errorf("reclaimPolicy = %s, want Retain", parameters.ReclaimPolicy)
+	}
+
+	restoreRequest.Spec.Parameters.AccessModes = []corev1.PersistentVolumeAccessMode{corev1.ReadWriteOncePod}
+	restoreRequest.Spec.Parameters.ReclaimPolicy = corev1.PersistentVolumeReclaimDelete
+	if err := (&restoreRequestWebhook{}).Default(context.Background(), restoreRequest); err != nil {
+		t.Fatal(err)
+	}
+	parameters = restoreRequest.Spec.Parameters
+	if parameters.AccessModes[0] != corev1.ReadWriteOncePod || parameters.ReclaimPolicy != corev1.PersistentVolumeReclaimDelete {
+		t.Errorf("parameters set by the user were replaced: %+v", parameters)
+	}
+}
+
+func TestValidateRestoreRequest(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(*RestoreRequest)
+		want   []string
+	}{
+		{
+			name:   "valid",
+			modify: func(r *RestoreRequest) {},
+		},
+		{
+			name:   "claim in another namespace",
+			modify: func(r *RestoreRequest) { r.Spec.Names.PVCNamespace = "other" },
+		},
+		{
+			name:   "missing names",
+			modify: func(r *RestoreRequest) { r.Spec.Names = Names{MigrationRequestName: "migration"} },
+			want: []string{"spec.names.pvName", "spec.names.pvcName", "spec.names.storageClassName",
+				"spec.names.targetNodeName", "spec.names.zfsDatasetName", "spec.names.zfsPoolName"},
+		},
+		{
+			name:   "dataset path",
+			modify: func(r *RestoreRequest) { r.Spec.Names.ZFSDatasetName = "migrated/pvc-1" },
+			want:   []string{"spec.names.zfsDatasetName"},
+		},
+		{
+			name:   "no capacity",
+			modify: func(r *RestoreRequest) { r.Spec.Parameters.Capacity = resource.Quantity{} },
+			want:   []string{"spec.parameters.capacity"},
+		},
+		{
+			name:   "negative capacity",
+			modify: func(r *RestoreRequest) { r.Spec.Parameters.Capacity = resource.MustParse("-1Gi") },
+			want:   []string{"spec.parameters.capacity"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			restoreRequest := validRestoreRequest()
+			tt.modify(restoreRequest)
+
+			err := (&restoreRequestWebhook{}).ValidateCreate(context.Background(), restoreRequest)
+			if got := invalidFields(t, err); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ValidateCreate() fields = %v, want %v (%v)", got, tt.want, err)
+			}
+		})
+	}
+}
+
+func TestValidateRestoreRequestUpdate(t *testing.T) {
+	oldRestoreRequest := validRestoreRequest()
+
+	restoreRequest := oldRestoreRequest.DeepCopy()
+	restoreRequest.Status.ReceivedSnapshots = 2
+	if err := (&restoreRequestWebhook{}).ValidateUpdate(context.Background(), oldRestoreRequest, restoreRequest); err != nil {
+		t.Errorf("ValidateUpdate() of the status = %v", err)
+	}
+
+	restoreRequest = oldRestoreRequest.DeepCopy()
+	restoreRequest.Spec.Names.TargetNodeName = "node-3"
+	err := (&restoreRequestWebhook{}).ValidateUpdate(context.Background(), oldRestoreRequest, restoreRequest)
+	if got := invalidFields(t, err); !reflect.DeepEqual(got, []string{"spec"}) {
+		t.Errorf("ValidateUpdate() of the spec fields = %v, want [spec]", got)
+	}
+}
@@ -0,0 +1,109 @@
+/*
+Copyright 2023 thehamdiaz.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// StatefulSetMigrationSpec defines the desired state of StatefulSetMigration
+type StatefulSetMigrationSpec struct {
+	// StatefulSetName is the StatefulSet whose replicas are migrated, in the namespace of the StatefulSetMigration
+	StatefulSetName string `json:"statefulSetName"`
+
+	// MaxUnavailable is the number of replicas migrated at the same time, 1 by default. A replica is unavailable
+	// from its cutover until its migrated pod is ready, the other replicas keep running.
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	MaxUnavailable int `json:"maxUnavailable,omitempty"`
+
+	// Template is the spec of the MigrationRequest of each replica. Its podName and workload are set for the replica
+	// and the ordinal of the replica is appended to its destination.remoteDataset, e.g. data-2.
+	Template MigrationRequestSpec `json:"template"`
+}
+
+// StatefulSetMigrationPhase is the step of the migration of a StatefulSet
+type StatefulSetMigrationPhase string
+
+const (
+	// StatefulSetMigrationPhaseMigrating migrates the replicas
+	StatefulSetMigrationPhaseMigrating StatefulSetMigrationPhase = "Migrating"
+	// StatefulSetMigrationPhaseCompleted is the terminal phase once every replica is migrated and ready
+	StatefulSetMigrationPhaseCompleted StatefulSetMigrationPhase = "Completed"
+	// StatefulSetMigrationPhaseFailed is the terminal phase once the migration of a replica failed or was aborted,
+	// the next replicas aren't migrated
+	StatefulSetMigrationPhaseFailed StatefulSetMigrationPhase = "Failed"
+)
+
+// ReplicaMigration is the migration of a replica of the StatefulSet
+type ReplicaMigration struct {
+	Ordinal              int32          `json:"ordinal"`
+	MigrationRequestName string         `json:"migrationRequestName"`
+	Phase                MigrationPhase `json:"phase,omitempty"`
+	// Ready is set once the migration completed and the pod of the replica is ready on the destination node
+	Ready bool `json:"ready,omitempty"`
+}
+
+// StatefulSetMigrationStatus defines the observed state of StatefulSetMigration
+type StatefulSetMigrationStatus struct {
+	Phase   StatefulSetMigrationPhase `json:"phase,omitempty"`
+	Message string                    `json:"message,omitempty"`
+	// Replicas is the number of replicas of the StatefulSet when the migration started, they are migrated from the highest ordinal
+	Replicas int32 `json:"replicas,omitempty"`
+	// ReadyReplicas counts the migrated replicas whose pod is ready on the destination node
+	ReadyReplicas int32 `json:"readyReplicas,omitempty"`
+	// Migrations are the migrations of the replicas started so far, in order
+	Migrations []ReplicaMigration `json:"migrations,omitempty"`
+
+	// Conditions are the latest observations of the migration, Completed and Failed like those of a MigrationRequest
+	// +listType=map
+	// +listMapKey=type
+	// +optional
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:subresource:status
+//+kubebuilder:printcolumn:name="StatefulSet",type=string,JSONPath=`.spec.statefulSetName`
+//+kubebuilder:printcolumn:name="Phase",type=string,JSONPath=`.status.phase`
+//+kubebuilder:printcolumn:name="Ready",type=integer,JSONPath=`.status.readyReplicas`
+//+kubebuilder:printcolumn:name="Replicas",type=integer,JSONPath=`.status.replicas`
+//+kubebuilder:printcolumn:name="Message",type=string,JSONPath=`.status.message`,priority=1
+//+kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+
+// StatefulSetMigration is the Schema for the statefulsetmigrations API, it migrates the replicas of a StatefulSet
+// one MigrationRequest at a time
+type StatefulSetMigration struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   StatefulSetMigrationSpec   `json:"spec,omitempty"`
+	Status StatefulSetMigrationStatus `json:"status,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// StatefulSetMigrationList contains a list of StatefulSetMigration
+type StatefulSetMigrationList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []StatefulSetMigration `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&StatefulSetMigration{}, &StatefulSetMigrationList{})
+}
@@ -0,0 +1,166 @@
+/*
+Copyright 2023 thehamdiaz.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	"context"
+	"fmt"
+
+	appsv1 "k8s.io/api/apps/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+)
+
+// log is for logging in this package.
+var statefulsetmigrationlog = logf.Log.WithName("statefulsetmigration-resource")
+
+// DefaultMaxUnavailable is the number of replicas of a StatefulSetMigration migrated at the same time by default
+const DefaultMaxUnavailable = 1
+
+// SetupWebhookWithManager registers the defaulting and validating webhooks of the StatefulSetMigrations
+func (r *StatefulSetMigration) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	hook := &statefulSetMigrationWebhook{client: mgr.GetAPIReader()}
+	return ctrl.NewWebhookManagedBy(mgr).
+		For(r).
+		WithDefaulter(hook).
+		WithValidator(hook).
+		Complete()
+}
+
+//+kubebuilder:webhook:path=/mutate-api-k8s-zfs-volume-migrator-io-v1-statefulsetmigration,mutating=true,failurePolicy=fail,sideEffects=None,groups=api.k8s.zfs-volume-migrator.io,resources=statefulsetmigrations,verbs=create;update,versions=v1,name=mstatefulsetmigration.kb.io,admissionReviewVersions=v1
+//+kubebuilder:webhook:path=/validate-api-k8s-zfs-volume-migrator-io-v1-statefulsetmigration,mutating=false,failurePolicy=fail,sideEffects=None,groups=api.k8s.zfs-volume-migrator.io,resources=statefulsetmigrations,verbs=create;update,versions=v1,name=vstatefulsetmigration.kb.io,admissionReviewVersions=v1
+
+type statefulSetMigrationWebhook struct {
+	client client.Reader
+}
+
+var _ webhook.CustomDefaulter = &statefulSetMigrationWebhook{}
+var _ webhook.CustomValidator = &statefulSetMigrationWebhook{}
+
+// Default implements webhook.CustomDefaulter so a webhook will be registered for the type
+func (w *statefulSetMigrationWebhook) Default(ctx context.Context, obj runtime.Object) error {
+	statefulSetMigration, ok := obj.(*StatefulSetMigration)
+	if !ok {
+		return fmt.Errorf("expected a StatefulSetMigration but got a %T", obj)
+	}
+	statefulsetmigrationlog.Info("default", "name", statefulSetMigration.Name)
+
+	if statefulSetMigration.Spec.MaxUnavailable == 0 {
+		statefulSetMigration.Spec.MaxUnavailable = DefaultMaxUnavailable
+	}
+	defaultMigrationRequestSpec(&statefulSetMigration.Spec.Template)
+	return nil
+}
+
+// ValidateCreate implements webhook.CustomValidator so a webhook will be registered for the type
+func (w *statefulSetMigrationWebhook) ValidateCreate(ctx context.Context, obj runtime.Object) error {
+	statefulSetMigration, ok := obj.(*StatefulSetMigration)
+	if !ok {
+		return fmt.Errorf("expected a StatefulSetMigration but got a %T", obj)
+	}
+	statefulsetmigrationlog.Info("validate create", "name", statefulSetMigration.Name)
+
+	allErrs := validateStatefulSetMigrationSpec(&statefulSetMigration.Spec)
+	if len(allErrs) == 0 {
+		allErrs = w.validateReferences(ctx, statefulSetMigration)
+	}
+	return invalidStatefulSetMigration(statefulSetMigration, allErrs)
+}
+
+// ValidateUpdate implements webhook.CustomValidator so a webhook will be registered for the type
+func (w *statefulSetMigrationWebhook) ValidateUpdate(ctx context.Context, oldObj, newObj runtime.Object) error {
+	oldStatefulSetMigration, ok := oldObj.(*StatefulSetMigration)
+	if !ok {
+		return fmt.Errorf("expected a StatefulSetMigration but got a %T", oldObj)
+	}
+	statefulSetMigration, ok := newObj.(*StatefulSetMigration)
+	if !ok {
+		return fmt.Errorf("expected a StatefulSetMigration but got a %T", newObj)
+	}
+	statefulsetmigrationlog.Info("validate update", "name", statefulSetMigration.Name)
+
+	allErrs := validateStatefulSetMigrationSpec(&statefulSetMigration.Spec)
+	oldSpec, spec := oldStatefulSetMigration.Spec, statefulSetMigration.Spec
+	oldSpec.MaxUnavailable, spec.MaxUnavailable = 0, 0
+	if oldStatefulSetMigration.Status.Phase != "" && !equality.Semantic.DeepEqual(oldSpec, spec) {
+		allErrs = append(allErrs, field.Forbidden(field.NewPath("spec"), "only maxUnavailable can change once the migration has started"))
+	}
+	return invalidStatefulSetMigration(statefulSetMigration, allErrs)
+}
+
+// ValidateDelete implements webhook.CustomValidator so a webhook will be registered for the type
+func (w *statefulSetMigrationWebhook) ValidateDelete(ctx context.Context, obj runtime.Object) error {
+	return nil
+}
+
+func validateStatefulSetMigrationSpec(spec *StatefulSetMigrationSpec) field.ErrorList {
+	var allErrs field.ErrorList
+	specPath := field.NewPath("spec")
+	templatePath := specPath.Child("template")
+
+	if spec.StatefulSetName == "" {
+		allErrs = append(allErrs, field.Required(specPath.Child("statefulSetName"), ""))
+	}
+	if spec.MaxUnavailable < 1 {
+		allErrs = append(allErrs, field.Invalid(specPath.Child("maxUnavailable"), spec.MaxUnavailable, "must be at least 1"))
+	}
+	if spec.Template.PodName != "" {
+		allErrs = append(allErrs, field.Forbidden(templatePath.Child("podName"), "the pod of each replica is migrated"))
+	}
+	if spec.Template.Workload != nil {
+		allErrs = append(allErrs, field.Forbidden(templatePath.Child("workload"), "the replicas are deleted alone and recreated by the StatefulSet"))
+	}
+	if spec.Template.Destination.KubeconfigSecretName != "" {
+		allErrs = append(allErrs, field.Forbidden(templatePath.Child("destination", "kubeconfigSecretName"), "the StatefulSet can't recreate its pods in another cluster"))
+	}
+	if spec.Template.Abort || spec.Template.Suspend {
+		allErrs = append(allErrs, field.Forbidden(templatePath, "abort and suspend are set on the MigrationRequest of a replica"))
+	}
+	return append(allErrs, validateMigrationSettings(templatePath, &spec.Template)...)
+}
+
+// validateReferences checks that the StatefulSet and the MigrationTarget of the template exist
+func (w *statefulSetMigrationWebhook) validateReferences(ctx context.Context, statefulSetMigration *StatefulSetMigration) field.ErrorList {
+	var allErrs field.ErrorList
+	specPath := field.NewPath("spec")
+	spec := statefulSetMigration.Spec
+
+	key := types.NamespacedName{Namespace: statefulSetMigration.Namespace, Name: spec.StatefulSetName}
+	if err := w.client.Get(ctx, key, &appsv1.StatefulSet{}); err != nil {
+		allErrs = append(allErrs, referenceError(specPath.Child("statefulSetName"), spec.StatefulSetName, err))
+	}
+	if spec.Template.TargetName != "" {
+		if err := w.client.Get(ctx, types.NamespacedName{Name: spec.Template.TargetName}, &MigrationTarget{}); err != nil {
+			allErrs = append(allErrs, referenceError(specPath.Child("template", "targetName"), spec.Template.TargetName, err))
+		}
+	}
+	return allErrs
+}
+
+func invalidStatefulSetMigration(statefulSetMigration *StatefulSetMigration, allErrs field.ErrorList) error {
+	if len(allErrs) == 0 {
+		return nil
+	}
+	return apierrors.NewInvalid(GroupVersion.WithKind("StatefulSetMigration").GroupKind(), statefulSetMigration.Name, allErrs)
+}
@@ -0,0 +1,151 @@
+/*
+Copyright 2023 thehamdiaz.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func validStatefulSetMigration() *StatefulSetMigration {
+	return &StatefulSetMigration{
+		ObjectMeta: metav1.ObjectMeta{Name: "db", Namespace: "apps"},
+		Spec: StatefulSetMigrationSpec{
+			StatefulSetName: "db",
+			MaxUnavailable:  DefaultMaxUnavailable,
+			Template: MigrationRequestSpec{
+				DesiredSnapshotCount: DefaultDesiredSnapshotCount,
+				Destination: DestinationDef{
+					RemotePool:     "pool",
+					RemoteDataset:  "migrated",
+					RemoteHostName: "node-2",
+				},
+			},
+		},
+	}
+}
+
+func TestValidateStatefulSetMigrationCreate(t *testing.T) {
+	statefulSet := &appsv1.StatefulSet{ObjectMeta: metav1.ObjectMeta{Name: "db", Namespace: "apps"}}
+	target := &MigrationTarget{ObjectMeta: metav1.ObjectMeta{Name: "node-2"}}
+
+	tests := []struct {
+		name   string
+		modify func(*StatefulSetMigration)
+		want   []string
+	}{
+		{
+			name:   "valid",
+			modify: func(s *StatefulSetMigration) {},
+		},
+		{
+			name: "missing StatefulSet name",
+			modify: func(s *StatefulSetMigration) {
+				s.Spec.StatefulSetName = ""
+				s.Spec.MaxUnavailable = 0
+			},
+			want: []string{"spec.maxUnavailable", "spec.statefulSetName"},
+		},
+		{
+			name: "fields of the MigrationRequest of a replica",
+			modify: func(s *StatefulSetMigration) {
+				s.Spec.Template.PodName = "db-0"
+				s.Spec.Template.Workload = &WorkloadReference{Kind: WorkloadKindStatefulSet, Name: "db"}
+				s.Spec.Template.Suspend = true
+			},
+			want: []string{"spec.template", "spec.template.podName", "spec.template.workload"},
+		},
+		{
+			name:   "other cluster",
+			modify: func(s *StatefulSetMigration) { s.Spec.Template.Destination.KubeconfigSecretName = "remote" },
+			want:   []string{"spec.template.destination.kubeconfigSecretName"},
+		},
+		{
+			name: "settings of the template",
+			modify: func(s *StatefulSetMigration) {
+				s.Spec.Template.DesiredSnapshotCount = 0
+				s.Spec.Template.Destination.RemoteHostName = ""
+			},
+			want: []string{"spec.template.desiredSnapshotCount", "spec.template.destination.remoteHostName"},
+		},
+		{
+			name:   "missing StatefulSet",
+			modify: func(s *StatefulSetMigration) { s.Spec.StatefulSetName = "web" },
+			want:   []string{"spec.statefulSetName"},
+		},
+		{
+			name:   "missing target",
+			modify: func(s *StatefulSetMigration) { s.Spec.Template.TargetName = "node-3" },
+			want:   []string{"spec.template.targetName"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := &statefulSetMigrationWebhook{client: fakeClient(t, statefulSet, target)}
+			statefulSetMigration := validStatefulSetMigration()
+			tt.modify(statefulSetMigration)
+
+			err := w.ValidateCreate(context.Background(), statefulSetMigration)
+			if got := invalidFields(t, err); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ValidateCreate() fields = %v, want %v (%v)", got, tt.want, err)
+			}
+		})
+	}
+}
+
+func TestValidateStatefulSetMigrationUpdate(t *testing.T) {
+	tests := []struct {
+		name   string
+		phase  StatefulSetMigrationPhase
+		modify func(*StatefulSetMigration)
+		want   []string
+	}{
+		{
+			name:   "spec changed before the migration started",
+			modify: func(s *StatefulSetMigration) { s.Spec.Template.DesiredSnapshotCount = 5 },
+		},
+		{
+			name:   "spec changed once the migration started",
+			phase:  StatefulSetMigrationPhaseMigrating,
+			modify: func(s *StatefulSetMigration) { s.Spec.Template.DesiredSnapshotCount = 5 },
+			want:   []string{"spec"},
+		},
+		{
+			name:   "maxUnavailable changed once the migration started",
+			phase:  StatefulSetMigrationPhaseMigrating,
+			modify: func(s *StatefulSetMigration) { s.Spec.MaxUnavailable = 2 },
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := &statefulSetMigrationWebhook{client: fakeClient(t)}
+			oldStatefulSetMigration := validStatefulSetMigration()
+			oldStatefulSetMigration.Status.Phase = tt.phase
+			statefulSetMigration := oldStatefulSetMigration.DeepCopy()
+			tt.modify(statefulSetMigration)
+
+			err := w.ValidateUpdate(context.Background(), oldStatefulSetMigration, statefulSetMigration)
+			if got := invalidFields(t, err); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ValidateUpdate() fields = %v, want %v (%v)", got, tt.want, err)
+			}
+		})
+	}
+}
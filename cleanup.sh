@@ -1,39 +1,9 @@
 #!/bin/bash
 
-# Delete all volumesnapshots
-kubectl delete volumesnapshot --all
-
-# Delete all configmaps that start with "s"
-kubectl get configmap --no-headers -o custom-columns=":metadata.name" |
-  awk '/^s/{print $1}' |
-  xargs -I {} kubectl delete configmap {}
-
-# Delete all configmaps that start with "legacy"
-kubectl get configmap --no-headers -o custom-columns=":metadata.name" |
-  awk '/^legacy/{print $1}' |
-  xargs -I {} kubectl delete configmap {}
-
-# Delete all secrets that start with "s"
-kubectl get secret --no-headers -o custom-columns=":metadata.name" |
-  awk '/^s/{print $1}' |
-  xargs -I {} kubectl delete secret {}
-
-# Delete all jobs that start with "s"
-kubectl get job --no-headers -o custom-columns=":metadata.name" |
-  awk '/^s/{print $1}' |
-  xargs -I {} kubectl delete job {}
-
-# Delete all jobs that start with "legacy"
-kubectl get job --no-headers -o custom-columns=":metadata.name" |
-  awk '/^legacy-/{print $1}' |
-  xargs -I {} kubectl delete job {}
-
-# Delete all migrationrequests.api.k8s.zfs-volume-migrator.io objects
+# Delete all migrationrequests.api.k8s.zfs-volume-migrator.io objects,
+# their VolumeSnapshots, Secrets and RestoreRequests are deleted with them
 kubectl delete migrationrequest.api.k8s.zfs-volume-migrator.io --all
 
-# Delete all restorerequests.api.k8s.zfs-volume-migrator.io objects
-kubectl delete restorerequest.api.k8s.zfs-volume-migrator.io --all
-
 # Delete my-fio pod
 kubectl delete pod my-fio
 
@@ -0,0 +1,61 @@
+/*
+Copyright 2023 thehamdiaz.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+
+	"github.com/thehamdiaz/first-controller.git/agent"
+)
+
+func main() {
+	var listenAddr string
+	var hostRoot string
+	var certDir string
+	var migrationUsers string
+	flag.StringVar(&listenAddr, "listen-address", fmt.Sprintf(":%d", agent.DefaultPort), "The address the node agent API binds to.")
+	flag.StringVar(&hostRoot, "host-root", "/host", "The path the root filesystem of the node is mounted at.")
+	flag.StringVar(&certDir, "cert-dir", "/etc/node-agent/certs",
+		"The directory holding the certificate of the node agent and its CA, as tls.crt, tls.key and ca.crt.")
+	flag.StringVar(&migrationUsers, "migration-users", "",
+		"Comma separated users of the node the migration keys may be authorized for. No key is authorized when empty.")
+	opts := zap.Options{
+		Development: true,
+	}
+	opts.BindFlags(flag.CommandLine)
+	flag.Parse()
+
+	ctrl.SetLogger(zap.New(zap.UseFlagOptions(&opts)))
+	log := ctrl.Log.WithName("node-agent")
+
+	server := agent.NewServer(log)
+	server.HostRoot = hostRoot
+	server.TLS = agent.CertDir(certDir)
+	if migrationUsers != "" {
+		server.MigrationUsers = strings.Split(migrationUsers, ",")
+	}
+	if err := server.Serve(ctrl.SetupSignalHandler(), listenAddr); err != nil {
+		log.Error(err, "problem running node agent")
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,156 @@
+/*
+Copyright 2023 thehamdiaz.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	"github.com/thehamdiaz/first-controller.git/agent"
+	apiv1 "github.com/thehamdiaz/first-controller.git/api/v1"
+)
+
+// migrationFinalizer lets the controller clean up after a MigrationRequest before it is deleted.
+// The Secrets and VolumeSnapshots of the migration are owned by the MigrationRequest and garbage collected after it,
+// the finalizer takes care of what lives on the destination.
+const migrationFinalizer = "api.k8s.zfs-volume-migrator.io/finalizer"
+
+// reconcileDelete cleans up the destination of a deleted migration and revokes its key before letting it go.
+// An unfinished migration is rolled back first so that its workload isn't left down.
+func (r *MigrationRequestReconciler) reconcileDelete(ctx context.Context, migrationRequest *apiv1.MigrationRequest) (ctrl.Result, error) {
+	l := log.FromContext(ctx)
+
+	if !controllerutil.ContainsFinalizer(migrationRequest, migrationFinalizer) {
+		return ctrl.Result{}, nil
+	}
+	phase := migrationRequest.Status.Phase
+	if migrationRequest.Status.Source != nil && (migrationRequest.Abortable() || phase == apiv1.MigrationPhaseAborting) {
+		if migrationRequest.Status.Rollback == nil {
+			now := metav1.Now()
+			migrationRequest.Status.Rollback = &apiv1.RollbackStatus{FromPhase: phase, StartTime: &now}
+		}
+		done, err := r.rollBack(ctx, migrationRequest)
+		if err != nil {
+			l.Error(err, "failed to roll back the migration")
+			return ctrl.Result{}, err
+		}
+		if !done {
+			return ctrl.Result{RequeueAfter: requeueInterval}, nil
+		}
+	}
+	if rollback := migrationRequest.Status.Rollback; rollback == nil || !rollback.DestinationCleaned {
+		if err := r.cleanupDestination(ctx, migrationRequest); err != nil {
+			l.Error(err, "failed to clean up the destination")
+			return ctrl.Result{}, err
+		}
+	}
+	if err := r.deleteRestoreRequests(ctx, migrationRequest); err != nil {
+		l.Error(err, "failed to delete the restoreRequests")
+		return ctrl.Result{}, err
+	}
+	if migrationRequest.Status.AuthorizedKey != "" {
+		if err := r.revokeKey(ctx, migrationRequest); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+
+	controllerutil.RemoveFinalizer(migrationRequest, migrationFinalizer)
+	if err := r.Update(ctx, migrationRequest); err != nil {
+		l.Error(err, "failed to remove the finalizer")
+		return ctrl.Result{}, err
+	}
+	return ctrl.Result{}, nil
+}
+
+// cleanupDestination destroys what the destination received and won't use: the partially received datasets
+// of a migration that didn't send all its snapshots, or the intermediate snapshots of one that did
+func (r *MigrationRequestReconciler) cleanupDestination(ctx context.Context, migrationRequest *apiv1.MigrationRequest) error {
+	l := log.FromContext(ctx)
+	if migrationRequest.Status.Source == nil {
+		// The migration didn't get to send anything
+		return nil
+	}
+	destination := destinationOf(migrationRequest)
+	allSent := meta.IsStatusConditionTrue(migrationRequest.Status.Conditions, apiv1.MigrationConditionSnapshotsSent)
+
+	destinationAgent, err := r.destinationAgent(ctx, migrationRequest)
+	if errors.IsNotFound(err) {
+		// The destination node or cluster is gone and its datasets with it
+		l.Info("destination not found, skipping its cleanup", "node", destination.RemoteHostName)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, volume := range migrationRequest.Status.Volumes {
+		request := &agent.DestroyRequest{Dataset: destination.RemotePool + "/" + volume.RemoteDataset}
+		sent := volume.SentSnapshots
+		switch {
+		case len(sent) > 0 && allSent:
+			// The last snapshot is the one the restored volume starts from
+			for _, handle := range sent[:len(sent)-1] {
+				if _, name, found := strings.Cut(handle, "@"); found {
+					request.Snapshots = append(request.Snapshots, name)
+				}
+			}
+		case len(sent) > 0:
+			// The full stream of the first snapshot created the dataset, it is incomplete without the others
+			request.All = true
+		}
+
+		if _, err := destinationAgent.Destroy(ctx, request); err != nil {
+			return err
+		}
+		l.Info("destination cleaned up", "dataset", request.Dataset, "snapshots", len(request.Snapshots), "destroyed", request.All)
+	}
+	return nil
+}
+
+// deleteRestoreRequests deletes the RestoreRequests of the migration, which live in the namespace of the MigrationRequest
+// in the destination cluster and can't be owned by it when that is another cluster. The restored volumes and pod are left in place.
+func (r *MigrationRequestReconciler) deleteRestoreRequests(ctx context.Context, migrationRequest *apiv1.MigrationRequest) error {
+	if migrationRequest.Status.Source == nil || len(migrationRequest.Status.Volumes) == 0 {
+		return nil
+	}
+	destinationClient, err := r.destinationClient(ctx, migrationRequest)
+	if errors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	for _, volume := range migrationRequest.Status.Volumes {
+		if volume.RestoreRequestName == "" {
+			continue
+		}
+		restoreReq := &apiv1.RestoreRequest{ObjectMeta: metav1.ObjectMeta{Namespace: migrationRequest.Namespace, Name: volume.RestoreRequestName}}
+		err = destinationClient.Delete(ctx, restoreReq, client.PropagationPolicy(metav1.DeletePropagationBackground))
+		if err != nil && !errors.IsNotFound(err) {
+			return err
+		}
+	}
+	return nil
+}
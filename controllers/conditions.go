@@ -0,0 +1,58 @@
+/*
+Copyright 2023 thehamdiaz.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	apiv1 "github.com/thehamdiaz/first-controller.git/api/v1"
+)
+
+// setCondition records a condition observed on the given generation of an object,
+// it tells whether the condition changed and the status must be updated
+func setCondition(conditions *[]metav1.Condition, generation int64, conditionType string, status metav1.ConditionStatus, reason, message string) bool {
+	condition := metav1.Condition{
+		Type:               conditionType,
+		Status:             status,
+		ObservedGeneration: generation,
+		Reason:             reason,
+		Message:            message,
+	}
+	existing := meta.FindStatusCondition(*conditions, conditionType)
+	if existing != nil && existing.Status == status && existing.Reason == reason &&
+		existing.Message == message && existing.ObservedGeneration == generation {
+		return false
+	}
+	meta.SetStatusCondition(conditions, condition)
+	return true
+}
+
+// setMigrationCondition records a condition of a MigrationRequest, the caller updates the status
+func setMigrationCondition(migrationRequest *apiv1.MigrationRequest, conditionType string, status metav1.ConditionStatus, reason, message string) bool {
+	return setCondition(&migrationRequest.Status.Conditions, migrationRequest.Generation, conditionType, status, reason, message)
+}
+
+// setRestoreCondition records a condition of a RestoreRequest, the caller updates the status
+func setRestoreCondition(restoreRequest *apiv1.RestoreRequest, conditionType string, status metav1.ConditionStatus, reason, message string) bool {
+	return setCondition(&restoreRequest.Status.Conditions, restoreRequest.Generation, conditionType, status, reason, message)
+}
+
+// setStatefulSetMigrationCondition records a condition of a StatefulSetMigration, the caller updates the status
+func setStatefulSetMigrationCondition(statefulSetMigration *apiv1.StatefulSetMigration, conditionType string, status metav1.ConditionStatus, reason, message string) bool {
+	return setCondition(&statefulSetMigration.Status.Conditions, statefulSetMigration.Generation, conditionType, status, reason, message)
+}
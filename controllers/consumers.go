@@ -0,0 +1,132 @@
+/*
+Copyright 2023 thehamdiaz.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	apiv1 "github.com/thehamdiaz/first-controller.git/api/v1"
+)
+
+// otherConsumers returns the running pods mounting one of the migrated claims, other than the source pod and
+// the pods of the workload scaled to zero with it
+func (r *MigrationRequestReconciler) otherConsumers(ctx context.Context, migrationRequest *apiv1.MigrationRequest) ([]corev1.Pod, error) {
+	source := migrationRequest.Status.Source
+	claims := map[string]bool{}
+	for _, volume := range migrationRequest.Status.Volumes {
+		claims[volume.PersistentVolumeClaimName] = true
+	}
+
+	managed := labels.Nothing()
+	if source.Workload != nil && !deletesPodAlone(migrationRequest) {
+		workload, err := getWorkload(ctx, r.Client, migrationRequest, source.Workload.WorkloadReference)
+		if err != nil {
+			return nil, err
+		}
+		if managed, err = workloadSelector(workload); err != nil {
+			return nil, err
+		}
+	}
+
+	pods := &corev1.PodList{}
+	if err := r.List(ctx, pods, client.InNamespace(migrationRequest.Namespace)); err != nil {
+		return nil, err
+	}
+	var consumers []corev1.Pod
+	for _, pod := range pods.Items {
+		if pod.Name == source.Pod.Name || managed.Matches(labels.Set(pod.Labels)) ||
+			pod.Status.Phase == corev1.PodSucceeded || pod.Status.Phase == corev1.PodFailed {
+			continue
+		}
+		for _, volume := range pod.Spec.Volumes {
+			if volume.PersistentVolumeClaim != nil && claims[volume.PersistentVolumeClaim.ClaimName] {
+				consumers = append(consumers, pod)
+				break
+			}
+		}
+	}
+	return consumers, nil
+}
+
+// consumerNames lists the names of the pods for the messages of the conditions
+func consumerNames(pods []corev1.Pod) string {
+	var names []string
+	for _, pod := range pods {
+		names = append(names, pod.Name)
+	}
+	return strings.Join(names, ", ")
+}
+
+// refuseConsumers tells whether the cutover is held because other pods mount the migrated claims and the
+// policy refuses to stop them. It is checked before the source pod is stopped, the caller updates the status.
+func (r *MigrationRequestReconciler) refuseConsumers(ctx context.Context, migrationRequest *apiv1.MigrationRequest) (bool, error) {
+	if migrationRequest.Spec.Consumers == apiv1.ConsumerPolicyDelete {
+		return false, nil
+	}
+	consumers, err := r.otherConsumers(ctx, migrationRequest)
+	if err != nil || len(consumers) == 0 {
+		return false, err
+	}
+	setMigrationCondition(migrationRequest, apiv1.MigrationConditionConsumersStopped, metav1.ConditionFalse, apiv1.ReasonUnmanagedConsumers,
+		fmt.Sprintf("pods %s mount the migrated claims, the cutover waits for them to stop", consumerNames(consumers)))
+	return true, nil
+}
+
+// stopConsumers deletes the other pods mounting the migrated claims once the source pod is stopped and reports
+// whether they are gone. The claims are locked by then so they can't be recreated, a pod created anyway while
+// the pod webhook was unavailable holds the cutover with the Refuse policy. The caller updates the status.
+func (r *MigrationRequestReconciler) stopConsumers(ctx context.Context, migrationRequest *apiv1.MigrationRequest) (bool, error) {
+	l := log.FromContext(ctx)
+
+	consumers, err := r.otherConsumers(ctx, migrationRequest)
+	if err != nil {
+		return false, err
+	}
+	if len(consumers) == 0 {
+		setMigrationCondition(migrationRequest, apiv1.MigrationConditionConsumersStopped, metav1.ConditionTrue, apiv1.ReasonConsumersStopped,
+			"no other pod mounts the migrated claims")
+		return true, nil
+	}
+	if migrationRequest.Spec.Consumers != apiv1.ConsumerPolicyDelete {
+		setMigrationCondition(migrationRequest, apiv1.MigrationConditionConsumersStopped, metav1.ConditionFalse, apiv1.ReasonUnmanagedConsumers,
+			fmt.Sprintf("pods %s mount the migrated claims, the cutover waits for them to stop", consumerNames(consumers)))
+		return false, nil
+	}
+
+	gracePeriodSeconds := int64(10)
+	for i := range consumers {
+		if consumers[i].DeletionTimestamp != nil {
+			continue
+		}
+		if err := r.Delete(ctx, &consumers[i], &client.DeleteOptions{GracePeriodSeconds: &gracePeriodSeconds}); err != nil && !errors.IsNotFound(err) {
+			return false, err
+		}
+		l.Info("consumer of the migrated claims deleted", "pod", consumers[i].Name)
+	}
+	setMigrationCondition(migrationRequest, apiv1.MigrationConditionConsumersStopped, metav1.ConditionFalse, apiv1.ReasonConsumersStopping,
+		fmt.Sprintf("waiting for pods %s to stop", consumerNames(consumers)))
+	return false, nil
+}
@@ -0,0 +1,108 @@
+/*
+Copyright 2023 thehamdiaz.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"fmt"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/thehamdiaz/first-controller.git/agent"
+	apiv1 "github.com/thehamdiaz/first-controller.git/api/v1"
+)
+
+// addDelta adds the incremental stream of a volume that was just sent to the delta of the current snapshot
+func addDelta(snapshot *apiv1.SnapshotRef, sendStatus *agent.SendStatus, incremental bool) {
+	// Nothing is sent when the destination already had the snapshot, which says nothing of its size
+	if !incremental || sendStatus.BytesSent <= 0 {
+		return
+	}
+	bytes := sendStatus.EstimatedBytes
+	if bytes == 0 {
+		bytes = sendStatus.BytesSent
+	}
+	if snapshot.Delta == nil {
+		snapshot.Delta = &apiv1.DeltaEstimate{Duration: &metav1.Duration{}}
+	}
+	snapshot.Delta.Bytes += bytes
+	snapshot.Delta.Duration.Duration += sendStatus.CompletionTime.Sub(sendStatus.StartTime).Round(time.Second)
+}
+
+// updateConvergence records the incremental streams of the snapshot that was just sent and sets the Converged condition
+// once they fit a budget of the convergence policy, or once the policy runs out of rounds. The final delta, sent once the pod
+// is stopped, is expected to be about the size of the last one since the snapshots are taken at the same interval.
+func updateConvergence(migrationRequest *apiv1.MigrationRequest, snapshotDelta *apiv1.DeltaEstimate) {
+	policy := migrationRequest.Spec.Convergence
+	if policy == nil || podStopped(migrationRequest) {
+		return
+	}
+	if snapshotDelta != nil {
+		migrationRequest.Status.LastDelta = snapshotDelta
+	}
+
+	delta := migrationRequest.Status.LastDelta
+	rounds := migrationRequest.Status.ConfirmedSnapshotCount
+	maxRounds := policy.MaxRounds
+	if maxRounds <= 0 {
+		maxRounds = apiv1.DefaultConvergenceMaxRounds
+	}
+	switch {
+	case deltaInBudget(policy, delta):
+		setMigrationCondition(migrationRequest, apiv1.MigrationConditionConverged, metav1.ConditionTrue, apiv1.ReasonDeltaInBudget,
+			fmt.Sprintf("the last incremental snapshot of %s took %s to send", formatBytes(delta.Bytes), delta.Duration.Duration))
+	case rounds >= maxRounds:
+		setMigrationCondition(migrationRequest, apiv1.MigrationConditionConverged, metav1.ConditionTrue, apiv1.ReasonMaxRounds,
+			fmt.Sprintf("%d snapshots were sent without converging", rounds))
+	case delta == nil:
+		setMigrationCondition(migrationRequest, apiv1.MigrationConditionConverged, metav1.ConditionFalse, apiv1.ReasonConverging,
+			"waiting for the first incremental snapshot")
+	default:
+		setMigrationCondition(migrationRequest, apiv1.MigrationConditionConverged, metav1.ConditionFalse, apiv1.ReasonConverging,
+			fmt.Sprintf("the last incremental snapshot of %s took %s to send, round %d of %d", formatBytes(delta.Bytes), delta.Duration.Duration, rounds, maxRounds))
+	}
+}
+
+// deltaInBudget tells whether an incremental stream fits one of the budgets of the convergence policy
+func deltaInBudget(policy *apiv1.ConvergencePolicy, delta *apiv1.DeltaEstimate) bool {
+	if delta == nil {
+		return false
+	}
+	if policy.MaxDeltaSize != nil && delta.Bytes <= policy.MaxDeltaSize.Value() {
+		return true
+	}
+	return policy.MaxDeltaDuration != nil && delta.Duration != nil && delta.Duration.Duration <= policy.MaxDeltaDuration.Duration
+}
+
+// sendingMessage describes the send of the current snapshot, and of which volume when there are several
+func sendingMessage(migrationRequest *apiv1.MigrationRequest) string {
+	next := migrationRequest.Status.ConfirmedSnapshotCount + 1
+	var message string
+	switch {
+	case migrationRequest.Spec.Convergence == nil:
+		message = fmt.Sprintf("sending snapshot %d of %d", next, migrationRequest.Spec.DesiredSnapshotCount)
+	case podStopped(migrationRequest):
+		message = fmt.Sprintf("sending the final snapshot %d", next)
+	default:
+		message = fmt.Sprintf("sending snapshot %d", next)
+	}
+	volumes := migrationRequest.Status.Volumes
+	if current := migrationRequest.Status.CurrentSnapshot; len(volumes) > 1 && current != nil && current.SentVolumes < len(volumes) {
+		message += fmt.Sprintf(", volume %s (%d of %d)", volumes[current.SentVolumes].Name, current.SentVolumes+1, len(volumes))
+	}
+	return message
+}
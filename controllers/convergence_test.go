@@ -0,0 +1,176 @@
+/*
+Copyright 2023 thehamdiaz.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	apiv1 "github.com/thehamdiaz/first-controller.git/api/v1"
+)
+
+func delta(bytes int64, duration time.Duration) *apiv1.DeltaEstimate {
+	return &apiv1.DeltaEstimate{Bytes: bytes, Duration: &metav1.Duration{Duration: duration}}
+}
+
+func TestDeltaInBudget(t *testing.T) {
+	maxSize := resource.MustParse("1Mi")
+	maxDuration := &metav1.Duration{Duration: 10 * time.Second}
+
+	tests := []struct {
+		name   string
+		policy apiv1.ConvergencePolicy
+		delta  *apiv1.DeltaEstimate
+		want   bool
+	}{
+		{name: "no delta yet", policy: apiv1.ConvergencePolicy{MaxDeltaSize: &maxSize}, want: false},
+		{name: "within the size", policy: apiv1.ConvergencePolicy{MaxDeltaSize: &maxSize}, delta: delta(1<<20, time.Minute), want: true},
+		{name: "over the size", policy: apiv1.ConvergencePolicy{MaxDeltaSize: &maxSize}, delta: delta(1<<20+1, time.Second), want: false},
+		{name: "within the duration", policy: apiv1.ConvergencePolicy{MaxDeltaDuration: maxDuration}, delta: delta(1<<30, 10*time.Second), want: true},
+		{name: "over the duration", policy: apiv1.ConvergencePolicy{MaxDeltaDuration: maxDuration}, delta: delta(1, 11*time.Second), want: false},
+		{name: "no duration measured", policy: apiv1.ConvergencePolicy{MaxDeltaDuration: maxDuration}, delta: &apiv1.DeltaEstimate{Bytes: 1}, want: false},
+		{name: "either budget", policy: apiv1.ConvergencePolicy{MaxDeltaSize: &maxSize, MaxDeltaDuration: maxDuration}, delta: delta(1<<30, time.Second), want: true},
+		{name: "over both budgets", policy: apiv1.ConvergencePolicy{MaxDeltaSize: &maxSize, MaxDeltaDuration: maxDuration}, delta: delta(1<<30, time.Minute), want: false},
+		{name: "no budget", policy: apiv1.ConvergencePolicy{MaxRounds: 3}, delta: delta(0, 0), want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := deltaInBudget(&tt.policy, tt.delta); got != tt.want {
+				t.Errorf("deltaInBudget() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUpdateConvergence(t *testing.T) {
+	maxSize := resource.MustParse("1Mi")
+	policy := &apiv1.ConvergencePolicy{MaxDeltaSize: &maxSize, MaxRounds: 3}
+	podStoppedCondition := metav1.Condition{Type: apiv1.MigrationConditionPodStopped, Status: metav1.ConditionTrue, Reason: "Stopped"}
+
+	tests := []struct {
+		name          string
+		policy        *apiv1.ConvergencePolicy
+		rounds        int
+		lastDelta     *apiv1.DeltaEstimate
+		snapshotDelta *apiv1.DeltaEstimate
+		conditions    []metav1.Condition
+		wantStatus    metav1.ConditionStatus
+		wantReason    string
+		wantLastDelta *apiv1.DeltaEstimate
+	}{
+		{
+			name:          "no convergence policy",
+			rounds:        1,
+			snapshotDelta: delta(1, time.Second),
+		},
+		{
+			name:          "pod already stopped",
+			policy:        policy,
+			rounds:        1,
+			lastDelta:     delta(1<<30, time.Minute),
+			snapshotDelta: delta(1, time.Second),
+			conditions:    []metav1.Condition{podStoppedCondition},
+			wantLastDelta: delta(1<<30, time.Minute),
+		},
+		{
+			name:       "waiting for the first incremental snapshot",
+			policy:     policy,
+			rounds:     1,
+			wantStatus: metav1.ConditionFalse,
+			wantReason: apiv1.ReasonConverging,
+		},
+		{
+			name:          "converging",
+			policy:        policy,
+			rounds:        2,
+			snapshotDelta: delta(1<<30, time.Minute),
+			wantStatus:    metav1.ConditionFalse,
+			wantReason:    apiv1.ReasonConverging,
+			wantLastDelta: delta(1<<30, time.Minute),
+		},
+		{
+			name:          "delta within the budget",
+			policy:        policy,
+			rounds:        2,
+			lastDelta:     delta(1<<30, time.Minute),
+			snapshotDelta: delta(1<<10, time.Second),
+			wantStatus:    metav1.ConditionTrue,
+			wantReason:    apiv1.ReasonDeltaInBudget,
+			wantLastDelta: delta(1<<10, time.Second),
+		},
+		{
+			name:          "last delta kept when the snapshot sent nothing",
+			policy:        policy,
+			rounds:        2,
+			lastDelta:     delta(1<<10, time.Second),
+			wantStatus:    metav1.ConditionTrue,
+			wantReason:    apiv1.ReasonDeltaInBudget,
+			wantLastDelta: delta(1<<10, time.Second),
+		},
+		{
+			name:          "out of rounds",
+			policy:        policy,
+			rounds:        3,
+			snapshotDelta: delta(1<<30, time.Minute),
+			wantStatus:    metav1.ConditionTrue,
+			wantReason:    apiv1.ReasonMaxRounds,
+			wantLastDelta: delta(1<<30, time.Minute),
+		},
+		{
+			name:          "default number of rounds",
+			policy:        &apiv1.ConvergencePolicy{MaxDeltaSize: &maxSize},
+			rounds:        apiv1.DefaultConvergenceMaxRounds - 1,
+			snapshotDelta: delta(1<<30, time.Minute),
+			wantStatus:    metav1.ConditionFalse,
+			wantReason:    apiv1.ReasonConverging,
+			wantLastDelta: delta(1<<30, time.Minute),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			migrationRequest := &apiv1.MigrationRequest{
+				Spec: apiv1.MigrationRequestSpec{Convergence: tt.policy},
+				Status: apiv1.MigrationRequestStatus{
+					ConfirmedSnapshotCount: tt.rounds,
+					LastDelta:              tt.lastDelta,
+					Conditions:             tt.conditions,
+				},
+			}
+			updateConvergence(migrationRequest, tt.snapshotDelta)
+
+			condition := meta.FindStatusCondition(migrationRequest.Status.Conditions, apiv1.MigrationConditionConverged)
+			switch {
+			case tt.wantReason == "" && condition != nil:
+				t.Errorf("Converged = %v, want none", condition)
+			case tt.wantReason != "" && condition == nil:
+				t.Errorf("Converged isn't set, want %s", tt.wantReason)
+			case tt.wantReason != "" && (condition.Status != tt.wantStatus || condition.Reason != tt.wantReason):
+				t.Errorf("Converged = %s %s, want %s %s", condition.Status, condition.Reason, tt.wantStatus, tt.wantReason)
+			}
+			if tt.policy != nil {
+				if got := migrationRequest.Status.LastDelta; (got == nil) != (tt.wantLastDelta == nil) ||
+					got != nil && (got.Bytes != tt.wantLastDelta.Bytes || got.Duration.Duration != tt.wantLastDelta.Duration.Duration) {
+					t.Errorf("LastDelta = %v, want %v", got, tt.wantLastDelta)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,92 @@
+/*
+Copyright 2023 thehamdiaz.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	apiv1 "github.com/thehamdiaz/first-controller.git/api/v1"
+)
+
+// errTargetNotChecked is returned while the MigrationTarget of a migration hasn't been validated yet,
+// such as when its node can't be reached
+var errTargetNotChecked = fmt.Errorf("the MigrationTarget has not been validated yet")
+
+// destinationOf returns the destination of a migration, as resolved when it was prepared
+func destinationOf(migrationRequest *apiv1.MigrationRequest) apiv1.ResolvedDestination {
+	if migrationRequest.Status.Destination != nil {
+		return *migrationRequest.Status.Destination
+	}
+	return apiv1.ResolvedDestination{
+		DestinationDef:             migrationRequest.Spec.Destination,
+		CredentialsSecretNamespace: migrationRequest.Namespace,
+		KubeconfigSecretNamespace:  migrationRequest.Namespace,
+	}
+}
+
+// resolveDestination builds the destination of a migration from its MigrationTarget, or from its spec when it references none.
+// A MigrationTarget the MigrationTarget controller found invalid is an error.
+func (r *MigrationRequestReconciler) resolveDestination(ctx context.Context, migrationRequest *apiv1.MigrationRequest) (*apiv1.ResolvedDestination, error) {
+	if migrationRequest.Spec.TargetName == "" {
+		destination := destinationOf(migrationRequest)
+		return &destination, nil
+	}
+
+	target := &apiv1.MigrationTarget{}
+	if err := r.Get(ctx, client.ObjectKey{Name: migrationRequest.Spec.TargetName}, target); err != nil {
+		return nil, err
+	}
+	valid := meta.FindStatusCondition(target.Status.Conditions, apiv1.TargetConditionValid)
+	if valid == nil || valid.ObservedGeneration != target.Generation || valid.Status == metav1.ConditionUnknown {
+		return nil, errTargetNotChecked
+	}
+	if valid.Status == metav1.ConditionFalse {
+		return nil, fmt.Errorf("MigrationTarget %s is invalid: %s", target.Name, valid.Message)
+	}
+
+	dataset := target.Spec.DatasetPrefix + migrationRequest.Spec.Destination.RemoteDataset
+	if errs := apiv1.DatasetNameErrors(dataset); len(errs) > 0 {
+		return nil, fmt.Errorf("dataset %s of MigrationTarget %s is invalid: %s", dataset, target.Name, strings.Join(errs, ", "))
+	}
+	destination := &apiv1.ResolvedDestination{
+		DestinationDef: apiv1.DestinationDef{
+			RemotePool:     target.Spec.Pool,
+			RemoteDataset:  dataset,
+			RemoteHostName: target.Spec.NodeName,
+		},
+	}
+	if target.Spec.Transport == apiv1.TransportSSH && target.Spec.SSH != nil {
+		destination.User = target.Spec.SSH.User
+		destination.RemoteHostIP = target.Spec.SSH.HostIP
+		destination.InsecureSkipHostKeyVerification = target.Spec.SSH.InsecureSkipHostKeyVerification
+		if ref := target.Spec.SSH.CredentialsSecretRef; ref != nil {
+			destination.CredentialsSecretName = ref.Name
+			destination.CredentialsSecretNamespace = ref.Namespace
+		}
+	}
+	if target.Spec.Cluster != nil {
+		destination.KubeconfigSecretName = target.Spec.Cluster.KubeconfigSecretRef.Name
+		destination.KubeconfigSecretNamespace = target.Spec.Cluster.KubeconfigSecretRef.Namespace
+	}
+	return destination, nil
+}
@@ -0,0 +1,189 @@
+/*
+Copyright 2023 thehamdiaz.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	"github.com/thehamdiaz/first-controller.git/agent"
+	apiv1 "github.com/thehamdiaz/first-controller.git/api/v1"
+)
+
+// migratedPodName returns the name of the pod started in the destination cluster in place of the source pod,
+// the name of the source pod itself with KeepNames
+func migratedPodName(migrationRequest *apiv1.MigrationRequest) string {
+	if migrationRequest.Spec.KeepNames {
+		return migrationRequest.Spec.PodName
+	}
+	return "migrated-pod-" + migrationRequest.Spec.PodName
+}
+
+// recordSendRate records the rate of a successful send, the final snapshot is expected to be sent at about the same rate
+func recordSendRate(migrationRequest *apiv1.MigrationRequest, sendStatus *agent.SendStatus) {
+	duration := sendStatus.CompletionTime.Sub(sendStatus.StartTime)
+	// Nothing is sent when the destination already had the snapshot
+	if sendStatus.BytesSent <= 0 || duration <= 0 {
+		return
+	}
+	migrationRequest.Status.LastSendRate = int64(float64(sendStatus.BytesSent) / duration.Seconds())
+}
+
+// estimateDowntime returns the estimated time to send the final snapshot, from the data written to the volumes since
+// the last snapshot sent and the rate of the last send. It returns false when no snapshot was sent yet to estimate it from.
+func (r *MigrationRequestReconciler) estimateDowntime(ctx context.Context, migrationRequest *apiv1.MigrationRequest) (time.Duration, bool, error) {
+	rate := migrationRequest.Status.LastSendRate
+	if rate <= 0 {
+		return 0, false, nil
+	}
+
+	sourceAgent, err := r.Agents.ForNode(ctx, r.Client, migrationRequest.Status.Source.NodeName)
+	if err != nil {
+		return 0, false, err
+	}
+	var written int64
+	for _, volume := range migrationRequest.Status.Volumes {
+		dataset, snapshot, found := strings.Cut(volume.IncrementalBase, "@")
+		if !found {
+			return 0, false, nil
+		}
+		property := "written@" + snapshot
+		response, err := sourceAgent.List(ctx, &agent.ListRequest{Dataset: dataset, Types: []string{"filesystem", "volume"}, Properties: []string{property}})
+		if err != nil {
+			return 0, false, err
+		}
+		if len(response.Datasets) == 0 {
+			return 0, false, fmt.Errorf("dataset %s not found on node %s", dataset, migrationRequest.Status.Source.NodeName)
+		}
+		bytes, err := strconv.ParseInt(response.Datasets[0].Properties[property], 10, 64)
+		if err != nil {
+			return 0, false, fmt.Errorf("invalid %s of dataset %s: %w", property, dataset, err)
+		}
+		written += bytes
+	}
+	return time.Duration(float64(written) / float64(rate) * float64(time.Second)).Round(time.Second), true, nil
+}
+
+// checkDowntimeBudget tells whether the source pod can be stopped within the downtime budget of the migration,
+// and records the estimate in the DowntimeWithinBudget condition
+func (r *MigrationRequestReconciler) checkDowntimeBudget(ctx context.Context, migrationRequest *apiv1.MigrationRequest) (bool, error) {
+	budget := migrationRequest.Spec.MaxDowntime
+	if budget == nil {
+		return true, nil
+	}
+	estimate, known, err := r.estimateDowntime(ctx, migrationRequest)
+	if err != nil {
+		return false, err
+	}
+	if !known {
+		setMigrationCondition(migrationRequest, apiv1.MigrationConditionDowntimeWithinBudget, metav1.ConditionFalse, apiv1.ReasonNoTransferRate,
+			"no snapshot was sent yet to estimate the downtime from")
+		return false, nil
+	}
+	if estimate > budget.Duration {
+		setMigrationCondition(migrationRequest, apiv1.MigrationConditionDowntimeWithinBudget, metav1.ConditionFalse, apiv1.ReasonOverBudget,
+			fmt.Sprintf("the final snapshot is estimated to take %s to send, over the budget of %s", estimate, budget.Duration))
+		return false, nil
+	}
+	setMigrationCondition(migrationRequest, apiv1.MigrationConditionDowntimeWithinBudget, metav1.ConditionTrue, apiv1.ReasonWithinBudget,
+		fmt.Sprintf("the final snapshot is estimated to take %s to send, within the budget of %s", estimate, budget.Duration))
+	migrationRequest.Status.Downtime = &apiv1.DowntimeStatus{Estimated: &metav1.Duration{Duration: estimate}}
+	return true, nil
+}
+
+// measureDowntime records the end of the downtime once the migrated pod is ready, and requeues the migration until then
+func (r *MigrationRequestReconciler) measureDowntime(ctx context.Context, migrationRequest *apiv1.MigrationRequest) (ctrl.Result, error) {
+	l := log.FromContext(ctx)
+	downtime := migrationRequest.Status.Downtime
+
+	destinationClient, err := r.destinationClient(ctx, migrationRequest)
+	if err != nil {
+		l.Error(err, "failed to get the client of the destination cluster")
+		return ctrl.Result{}, err
+	}
+	pods, found, err := r.migratedPods(ctx, destinationClient, migrationRequest)
+	if err != nil {
+		l.Error(err, "failed to get the migrated pod")
+		return ctrl.Result{}, err
+	}
+	if !found {
+		// The migrated pod was deleted before it got ready, there is nothing left to measure
+		l.Info("migrated pod not found, the downtime is not measured")
+		return ctrl.Result{}, nil
+	}
+
+	// The first pod ready since the source pod was stopped ends the downtime
+	var ready *corev1.Pod
+	var end metav1.Time
+	for i := range pods {
+		for _, condition := range pods[i].Status.Conditions {
+			if condition.Type != corev1.PodReady || condition.Status != corev1.ConditionTrue || condition.LastTransitionTime.Before(downtime.StartTime) {
+				continue
+			}
+			if ready == nil || condition.LastTransitionTime.Before(&end) {
+				ready = &pods[i]
+				end = condition.LastTransitionTime
+			}
+		}
+	}
+	if ready == nil {
+		return ctrl.Result{RequeueAfter: requeueInterval}, nil
+	}
+
+	downtime.EndTime = &end
+	downtime.Actual = &metav1.Duration{Duration: end.Sub(downtime.StartTime.Time).Round(time.Second)}
+	if err := r.Status().Update(ctx, migrationRequest); err != nil {
+		l.Error(err, "failed to update migrationRequest status")
+		return ctrl.Result{}, err
+	}
+	l.Info("migrated pod is ready", "pod", ready.Name, "downtime", downtime.Actual.Duration)
+	return ctrl.Result{}, nil
+}
+
+// migratedPods returns the pods replacing the source pod in the destination cluster, false when the migrated pod
+// or the restored workload doesn't exist
+func (r *MigrationRequestReconciler) migratedPods(ctx context.Context, destinationClient client.Client, migrationRequest *apiv1.MigrationRequest) ([]corev1.Pod, bool, error) {
+	if migrationRequest.Status.Source.Workload != nil {
+		return r.migratedWorkloadPods(ctx, destinationClient, migrationRequest)
+	}
+	pod := &corev1.Pod{}
+	key := types.NamespacedName{Namespace: migrationRequest.Namespace, Name: migratedPodName(migrationRequest)}
+	if err := destinationClient.Get(ctx, key, pod); err != nil {
+		if errors.IsNotFound(err) {
+			return nil, false, nil
+		}
+		return nil, false, err
+	}
+	return []corev1.Pod{*pod}, true, nil
+}
+
+// measuringDowntime tells whether the downtime started and didn't end yet
+func measuringDowntime(migrationRequest *apiv1.MigrationRequest) bool {
+	downtime := migrationRequest.Status.Downtime
+	return downtime != nil && downtime.StartTime != nil && downtime.EndTime == nil
+}
@@ -0,0 +1,160 @@
+/*
+Copyright 2023 thehamdiaz.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	apiv1 "github.com/thehamdiaz/first-controller.git/api/v1"
+)
+
+func TestCheckDowntimeBudget(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	testAgent, err := startTestAgent(ctx, t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := &MigrationRequestReconciler{
+		Client: fake.NewClientBuilder().WithObjects(testNode("node-1")).Build(),
+		Agents: testAgent.agents,
+	}
+	volumes := []apiv1.MigratedVolume{
+		{Name: "data", IncrementalBase: "pool/pvc-1@snap-2"},
+		{Name: "logs", IncrementalBase: "pool/pvc-2@snap-2"},
+	}
+	// 30MiB were written to each dataset since the last snapshot sent
+	const zfsList = `case "$*" in
+"list -H -p -t filesystem,volume -o name,written@snap-2 pool/pvc-1") printf 'pool/pvc-1\t31457280\n' ;;
+"list -H -p -t filesystem,volume -o name,written@snap-2 pool/pvc-2") printf 'pool/pvc-2\t31457280\n' ;;
+*) echo "cannot open '$*': dataset does not exist" >&2; exit 1 ;;
+esac
+`
+
+	tests := []struct {
+		name       string
+		budget     time.Duration
+		rate       int64
+		volumes    []apiv1.MigratedVolume
+		zfs        string
+		want       bool
+		wantErr    bool
+		wantReason string
+		wantEstim  time.Duration
+	}{
+		{
+			name:    "no budget",
+			rate:    0,
+			volumes: volumes,
+			want:    true,
+		},
+		{
+			name:       "no snapshot sent yet",
+			budget:     time.Minute,
+			volumes:    volumes,
+			wantReason: apiv1.ReasonNoTransferRate,
+		},
+		{
+			name:       "no incremental base yet",
+			budget:     time.Minute,
+			rate:       1 << 20,
+			volumes:    []apiv1.MigratedVolume{{Name: "data"}},
+			wantReason: apiv1.ReasonNoTransferRate,
+		},
+		{
+			name:       "within the budget",
+			budget:     time.Minute,
+			rate:       1 << 20,
+			volumes:    volumes,
+			zfs:        zfsList,
+			want:       true,
+			wantReason: apiv1.ReasonWithinBudget,
+			wantEstim:  time.Minute,
+		},
+		{
+			name:       "over the budget",
+			budget:     time.Minute,
+			rate:       1 << 19,
+			volumes:    volumes,
+			zfs:        zfsList,
+			wantReason: apiv1.ReasonOverBudget,
+		},
+		{
+			name:    "dataset missing on the node",
+			budget:  time.Minute,
+			rate:    1 << 20,
+			volumes: []apiv1.MigratedVolume{{Name: "data", IncrementalBase: "pool/pvc-3@snap-2"}},
+			zfs:     zfsList,
+			wantErr: true,
+		},
+		{
+			name:    "invalid written property",
+			budget:  time.Minute,
+			rate:    1 << 20,
+			volumes: volumes,
+			zfs:     "printf 'pool/pvc-1\\t-\\n'\n",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := testAgent.setZFS(tt.zfs); err != nil {
+				t.Fatal(err)
+			}
+			migrationRequest := &apiv1.MigrationRequest{
+				Status: apiv1.MigrationRequestStatus{
+					Source:       &apiv1.SourceResources{NodeName: "node-1"},
+					Volumes:      tt.volumes,
+					LastSendRate: tt.rate,
+				},
+			}
+			if tt.budget != 0 {
+				migrationRequest.Spec.MaxDowntime = &metav1.Duration{Duration: tt.budget}
+			}
+
+			got, err := r.checkDowntimeBudget(ctx, migrationRequest)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("checkDowntimeBudget() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("checkDowntimeBudget() = %v, want %v", got, tt.want)
+			}
+
+			condition := meta.FindStatusCondition(migrationRequest.Status.Conditions, apiv1.MigrationConditionDowntimeWithinBudget)
+			switch {
+			case tt.wantReason == "" && condition != nil:
+				t.Errorf("DowntimeWithinBudget = %v, want none", condition)
+			case tt.wantReason != "" && (condition == nil || condition.Reason != tt.wantReason):
+				t.Errorf("DowntimeWithinBudget = %v, want %s", condition, tt.wantReason)
+			}
+
+			downtime := migrationRequest.Status.Downtime
+			switch {
+			case tt.wantEstim == 0 && downtime != nil:
+				t.Errorf("Downtime = %v, want none", downtime)
+			case tt.wantEstim != 0 && (downtime == nil || downtime.Estimated.Duration != tt.wantEstim):
+				t.Errorf("Downtime = %v, want an estimate of %s", downtime, tt.wantEstim)
+			}
+		})
+	}
+}
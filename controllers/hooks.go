@@ -0,0 +1,135 @@
+/*
+Copyright 2023 thehamdiaz.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	snapv1 "github.com/kubernetes-csi/external-snapshotter/client/v4/apis/volumesnapshot/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	apiv1 "github.com/thehamdiaz/first-controller.git/api/v1"
+)
+
+// quiesceSnapshot tells whether the hooks run around the VolumeSnapshots of the current snapshot. The final snapshot is taken once
+// the source pod is stopped, there is nothing to quiesce then.
+func quiesceSnapshot(migrationRequest *apiv1.MigrationRequest) bool {
+	return migrationRequest.Spec.Hooks != nil && !podStopped(migrationRequest)
+}
+
+// snapshotTaken tells whether the snapshot of a VolumeSnapshot was cut, or failed to be, so the post-snapshot hooks can run
+func snapshotTaken(vs *snapv1.VolumeSnapshot) bool {
+	return vs.Status != nil && (vs.Status.CreationTime != nil || vs.Status.Error != nil)
+}
+
+// hookError is the failure of a hook whose policy is Fail
+type hookError struct {
+	stage string
+	index int
+	err   error
+}
+
+func (e *hookError) Error() string {
+	return fmt.Sprintf("%s-snapshot hook %d failed: %v", e.stage, e.index, e.err)
+}
+
+// runHooks runs hooks in order in the source pod. It stops at the first hook failing with the Fail policy and returns
+// its error, the failures of the hooks with the Continue policy are returned as messages.
+func (r *MigrationRequestReconciler) runHooks(ctx context.Context, migrationRequest *apiv1.MigrationRequest, stage string, hooks []apiv1.ExecHook) ([]string, error) {
+	l := log.FromContext(ctx)
+	var failures []string
+	for i, hook := range hooks {
+		timeout := apiv1.DefaultHookTimeout
+		if hook.Timeout != nil {
+			timeout = hook.Timeout.Duration
+		}
+		hookCtx, cancel := context.WithTimeout(ctx, timeout)
+		start := time.Now()
+		err := r.Exec.Run(hookCtx, migrationRequest.Namespace, migrationRequest.Spec.PodName, hook.Container, hook.Command)
+		cancel()
+		if err == nil {
+			l.Info("hook succeeded", "stage", stage, "hook", i, "duration", time.Since(start).Round(time.Millisecond))
+			continue
+		}
+		if hookCtx.Err() == context.DeadlineExceeded {
+			err = fmt.Errorf("timed out after %s", timeout)
+		}
+		if hook.OnError != apiv1.HookErrorContinue {
+			return failures, &hookError{stage: stage, index: i, err: err}
+		}
+		l.Error(err, "hook failed, continuing", "stage", stage, "hook", i)
+		failures = append(failures, (&hookError{stage: stage, index: i, err: err}).Error())
+	}
+	return failures, nil
+}
+
+// runPreSnapshotHooks runs the pre-snapshot hooks before the VolumeSnapshots of the current snapshot are created. The snapshot is marked
+// as quiescing first, so the post-snapshot hooks run even if the manager restarts in between.
+// When a hook fails with the Fail policy, the post-snapshot hooks run to undo what the previous ones did.
+func (r *MigrationRequestReconciler) runPreSnapshotHooks(ctx context.Context, migrationRequest *apiv1.MigrationRequest) error {
+	current := migrationRequest.Status.CurrentSnapshot
+	if !current.Quiescing {
+		current.Quiescing = true
+		setMigrationCondition(migrationRequest, apiv1.MigrationConditionQuiesced, metav1.ConditionFalse, apiv1.ReasonQuiescing,
+			fmt.Sprintf("running the hooks around snapshot %s", current.Name))
+		if err := r.Status().Update(ctx, migrationRequest); err != nil {
+			return err
+		}
+	}
+
+	failures, err := r.runHooks(ctx, migrationRequest, "pre", migrationRequest.Spec.Hooks.Pre)
+	if err != nil {
+		if postErr := r.runPostSnapshotHooks(ctx, migrationRequest); postErr != nil {
+			log.FromContext(ctx).Error(postErr, "failed to run the post-snapshot hooks after a pre-snapshot hook failed")
+		}
+		setMigrationCondition(migrationRequest, apiv1.MigrationConditionQuiesced, metav1.ConditionFalse, apiv1.ReasonHookFailed, err.Error())
+		return err
+	}
+	if len(failures) > 0 {
+		// Kept until the post-snapshot hooks ran
+		setMigrationCondition(migrationRequest, apiv1.MigrationConditionQuiesced, metav1.ConditionFalse, apiv1.ReasonHookFailed, strings.Join(failures, "; "))
+	}
+	return nil
+}
+
+// runPostSnapshotHooks runs the post-snapshot hooks once the current snapshot is taken and records the outcome of
+// the hooks around it in the Quiesced condition. The caller updates the status.
+func (r *MigrationRequestReconciler) runPostSnapshotHooks(ctx context.Context, migrationRequest *apiv1.MigrationRequest) error {
+	current := migrationRequest.Status.CurrentSnapshot
+	failures, err := r.runHooks(ctx, migrationRequest, "post", migrationRequest.Spec.Hooks.Post)
+	current.Quiescing = false
+	if err != nil {
+		return err
+	}
+
+	// The failures of the pre-snapshot hooks
+	if quiesced := meta.FindStatusCondition(migrationRequest.Status.Conditions, apiv1.MigrationConditionQuiesced); quiesced != nil && quiesced.Reason == apiv1.ReasonHookFailed {
+		failures = append([]string{quiesced.Message}, failures...)
+	}
+	if len(failures) > 0 {
+		setMigrationCondition(migrationRequest, apiv1.MigrationConditionQuiesced, metav1.ConditionFalse, apiv1.ReasonHookFailed, strings.Join(failures, "; "))
+		return nil
+	}
+	setMigrationCondition(migrationRequest, apiv1.MigrationConditionQuiesced, metav1.ConditionTrue, apiv1.ReasonHooksSucceeded,
+		fmt.Sprintf("the hooks around snapshot %s succeeded", current.Name))
+	return nil
+}
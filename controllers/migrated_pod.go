@@ -0,0 +1,149 @@
+/*
+Copyright 2023 thehamdiaz.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"strings"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	apiv1 "github.com/thehamdiaz/first-controller.git/api/v1"
+)
+
+// serviceAccountVolumePrefix names the projected volume of the service account token mounted on admission
+const serviceAccountVolumePrefix = "kube-api-access-"
+
+// controllerLabels are set by the controller of the source pod, a ReplicaSet or a StatefulSet would adopt
+// the migrated pod carrying them and delete it as a surplus replica
+var controllerLabels = []string{
+	appsv1.DefaultDeploymentUniqueLabelKey,
+	appsv1.ControllerRevisionHashLabelKey,
+	appsv1.StatefulSetPodNameLabel,
+}
+
+// populateMigratedPod returns the pod replacing the source pod: a copy of the source pod without the fields assigned
+// by its cluster, whose migrated volumes use the restored PersistentVolumeClaims, pinned to the destination node
+func populateMigratedPod(migrationRequest *apiv1.MigrationRequest, source *corev1.PodTemplateSpec) *corev1.Pod {
+	spec := source.Spec.DeepCopy()
+	stripClusterFields(spec)
+	migratePodSpec(migrationRequest, spec)
+
+	// The restored PersistentVolumes are pinned to the destination node with the same label
+	if spec.NodeSelector == nil {
+		spec.NodeSelector = map[string]string{}
+	}
+	spec.NodeSelector[hostnameLabel] = destinationOf(migrationRequest).RemoteHostName
+
+	labels := map[string]string{}
+	for key, value := range source.Labels {
+		labels[key] = value
+	}
+	for _, key := range controllerLabels {
+		delete(labels, key)
+	}
+
+	// The pod may mount the claims of the source pod by name while they are locked
+	annotations := map[string]string{}
+	for key, value := range source.Annotations {
+		annotations[key] = value
+	}
+	annotations[apiv1.MigrationRequestAnnotation] = migrationRequest.Name
+
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        migratedPodName(migrationRequest),
+			Namespace:   source.Namespace,
+			Labels:      labels,
+			Annotations: annotations,
+		},
+		Spec: *spec,
+	}
+}
+
+// migratePodSpec points the migrated volumes of a pod spec to the restored PersistentVolumeClaims,
+// the other volumes are kept as they are, and moves it from the source node to the destination node
+func migratePodSpec(migrationRequest *apiv1.MigrationRequest, spec *corev1.PodSpec) {
+	claims := restoredClaims(migrationRequest)
+	for i := range spec.Volumes {
+		volume := &spec.Volumes[i]
+		if claimName, found := claims[volume.Name]; found && volume.PersistentVolumeClaim != nil {
+			volume.PersistentVolumeClaim.ClaimName = claimName
+		}
+	}
+	retargetNode(spec, migrationRequest.Status.Source.NodeName, destinationOf(migrationRequest).RemoteHostName)
+}
+
+// retargetNode replaces the source node by the destination node in the hostname node selector and the required
+// node affinity of a pod spec, a pod pinned to the source node could no longer be scheduled next to its volumes
+func retargetNode(spec *corev1.PodSpec, sourceNode, destinationNode string) {
+	if node, found := spec.NodeSelector[hostnameLabel]; found && node == sourceNode {
+		spec.NodeSelector[hostnameLabel] = destinationNode
+	}
+	if spec.Affinity == nil || spec.Affinity.NodeAffinity == nil || spec.Affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution == nil {
+		return
+	}
+	terms := spec.Affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms
+	for i := range terms {
+		for j := range terms[i].MatchExpressions {
+			expression := &terms[i].MatchExpressions[j]
+			if expression.Key != hostnameLabel {
+				continue
+			}
+			for k := range expression.Values {
+				if expression.Values[k] == sourceNode {
+					expression.Values[k] = destinationNode
+				}
+			}
+		}
+	}
+}
+
+// stripClusterFields clears the fields of a pod spec the source cluster assigned, the destination cluster sets them again
+func stripClusterFields(spec *corev1.PodSpec) {
+	spec.NodeName = ""
+	// They are set from the PriorityClass and the RuntimeClass on admission, which refuses the values that don't match
+	spec.Priority = nil
+	spec.PreemptionPolicy = nil
+	spec.Overhead = nil
+	// Ephemeral containers can only be added to a running pod
+	spec.EphemeralContainers = nil
+
+	// The service account token is mounted again on admission
+	tokenVolumes := map[string]bool{}
+	var volumes []corev1.Volume
+	for _, volume := range spec.Volumes {
+		if volume.Projected != nil && strings.HasPrefix(volume.Name, serviceAccountVolumePrefix) {
+			tokenVolumes[volume.Name] = true
+			continue
+		}
+		volumes = append(volumes, volume)
+	}
+	spec.Volumes = volumes
+	for _, containers := range [][]corev1.Container{spec.InitContainers, spec.Containers} {
+		for i := range containers {
+			var mounts []corev1.VolumeMount
+			for _, mount := range containers[i].VolumeMounts {
+				if !tokenVolumes[mount.Name] {
+					mounts = append(mounts, mount)
+				}
+			}
+			containers[i].VolumeMounts = mounts
+		}
+	}
+}
@@ -0,0 +1,195 @@
+/*
+Copyright 2023 thehamdiaz.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	apiv1 "github.com/thehamdiaz/first-controller.git/api/v1"
+)
+
+func nodeAffinity(key string, values ...string) *corev1.Affinity {
+	return &corev1.Affinity{NodeAffinity: &corev1.NodeAffinity{
+		RequiredDuringSchedulingIgnoredDuringExecution: &corev1.NodeSelector{NodeSelectorTerms: []corev1.NodeSelectorTerm{{
+			MatchExpressions: []corev1.NodeSelectorRequirement{{Key: key, Operator: corev1.NodeSelectorOpIn, Values: values}},
+		}}},
+	}}
+}
+
+func TestRetargetNode(t *testing.T) {
+	tests := []struct {
+		name string
+		spec corev1.PodSpec
+		want corev1.PodSpec
+	}{
+		{
+			name: "not pinned",
+			spec: corev1.PodSpec{NodeSelector: map[string]string{"disktype": "ssd"}},
+			want: corev1.PodSpec{NodeSelector: map[string]string{"disktype": "ssd"}},
+		},
+		{
+			name: "node selector",
+			spec: corev1.PodSpec{NodeSelector: map[string]string{hostnameLabel: "source", "disktype": "ssd"}},
+			want: corev1.PodSpec{NodeSelector: map[string]string{hostnameLabel: "destination", "disktype": "ssd"}},
+		},
+		{
+			name: "node selector of another node",
+			spec: corev1.PodSpec{NodeSelector: map[string]string{hostnameLabel: "other"}},
+			want: corev1.PodSpec{NodeSelector: map[string]string{hostnameLabel: "other"}},
+		},
+		{
+			name: "required node affinity",
+			spec: corev1.PodSpec{Affinity: nodeAffinity(hostnameLabel, "other", "source")},
+			want: corev1.PodSpec{Affinity: nodeAffinity(hostnameLabel, "other", "destination")},
+		},
+		{
+			name: "node affinity on another label",
+			spec: corev1.PodSpec{Affinity: nodeAffinity("topology.kubernetes.io/zone", "source")},
+			want: corev1.PodSpec{Affinity: nodeAffinity("topology.kubernetes.io/zone", "source")},
+		},
+		{
+			name: "pod affinity only",
+			spec: corev1.PodSpec{Affinity: &corev1.Affinity{PodAffinity: &corev1.PodAffinity{}}},
+			want: corev1.PodSpec{Affinity: &corev1.Affinity{PodAffinity: &corev1.PodAffinity{}}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			retargetNode(&tt.spec, "source", "destination")
+			if !equality.Semantic.DeepEqual(tt.spec, tt.want) {
+				t.Errorf("retargetNode() = %+v, want %+v", tt.spec, tt.want)
+			}
+		})
+	}
+}
+
+func TestStripClusterFields(t *testing.T) {
+	priority := int32(1000)
+	preemptLowerPriority := corev1.PreemptLowerPriority
+	tokenVolume := corev1.Volume{Name: serviceAccountVolumePrefix + "x7k2p", VolumeSource: corev1.VolumeSource{Projected: &corev1.ProjectedVolumeSource{}}}
+	tokenMount := corev1.VolumeMount{Name: tokenVolume.Name, MountPath: "/var/run/secrets/kubernetes.io/serviceaccount"}
+	dataVolume := corev1.Volume{Name: "data", VolumeSource: corev1.VolumeSource{
+		PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{ClaimName: "data"},
+	}}
+	dataMount := corev1.VolumeMount{Name: "data", MountPath: "/data"}
+	// A projected volume named by the user is kept
+	projectedVolume := corev1.Volume{Name: "config", VolumeSource: corev1.VolumeSource{Projected: &corev1.ProjectedVolumeSource{}}}
+	projectedMount := corev1.VolumeMount{Name: "config", MountPath: "/config"}
+
+	tests := []struct {
+		name string
+		spec corev1.PodSpec
+		want corev1.PodSpec
+	}{
+		{
+			name: "assigned fields",
+			spec: corev1.PodSpec{
+				NodeName:            "source",
+				PriorityClassName:   "high",
+				Priority:            &priority,
+				PreemptionPolicy:    &preemptLowerPriority,
+				Overhead:            corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("120Mi")},
+				EphemeralContainers: []corev1.EphemeralContainer{{EphemeralContainerCommon: corev1.EphemeralContainerCommon{Name: "debugger"}}},
+				Containers:          []corev1.Container{{Name: "app"}},
+			},
+			want: corev1.PodSpec{
+				PriorityClassName: "high",
+				Containers:        []corev1.Container{{Name: "app"}},
+			},
+		},
+		{
+			name: "service account token",
+			spec: corev1.PodSpec{
+				Volumes:        []corev1.Volume{dataVolume, tokenVolume, projectedVolume},
+				InitContainers: []corev1.Container{{Name: "init", VolumeMounts: []corev1.VolumeMount{tokenMount}}},
+				Containers:     []corev1.Container{{Name: "app", VolumeMounts: []corev1.VolumeMount{dataMount, tokenMount, projectedMount}}},
+			},
+			want: corev1.PodSpec{
+				Volumes:        []corev1.Volume{dataVolume, projectedVolume},
+				InitContainers: []corev1.Container{{Name: "init"}},
+				Containers:     []corev1.Container{{Name: "app", VolumeMounts: []corev1.VolumeMount{dataMount, projectedMount}}},
+			},
+		},
+		{
+			name: "volume named like the token but not projected",
+			spec: corev1.PodSpec{
+				Volumes:    []corev1.Volume{{Name: serviceAccountVolumePrefix + "cache", VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}}}},
+				Containers: []corev1.Container{{Name: "app", VolumeMounts: []corev1.VolumeMount{{Name: serviceAccountVolumePrefix + "cache", MountPath: "/cache"}}}},
+			},
+			want: corev1.PodSpec{
+				Volumes:    []corev1.Volume{{Name: serviceAccountVolumePrefix + "cache", VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}}}},
+				Containers: []corev1.Container{{Name: "app", VolumeMounts: []corev1.VolumeMount{{Name: serviceAccountVolumePrefix + "cache", MountPath: "/cache"}}}},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stripClusterFields(&tt.spec)
+			if !equality.Semantic.DeepEqual(tt.spec, tt.want) {
+				t.Errorf("stripClusterFields() = %+v, want %+v", tt.spec, tt.want)
+			}
+		})
+	}
+}
+
+func TestPopulateMigratedPod(t *testing.T) {
+	migrationRequest := &apiv1.MigrationRequest{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "apps", Name: "migration"},
+		Spec: apiv1.MigrationRequestSpec{
+			Destination: apiv1.DestinationDef{RemotePool: "pool", RemoteDataset: "data", RemoteHostName: "node-2"},
+		},
+		Status: apiv1.MigrationRequestStatus{
+			Source: &apiv1.SourceResources{NodeName: "node-1"},
+		},
+	}
+	source := &corev1.PodTemplateSpec{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "apps",
+			Name:      "db-5d8f7c9b4-x2k9p",
+			Labels: map[string]string{
+				"app":                                  "db",
+				appsv1.DefaultDeploymentUniqueLabelKey: "5d8f7c9b4",
+				appsv1.ControllerRevisionHashLabelKey:  "db-6c4b9f",
+				appsv1.StatefulSetPodNameLabel:         "db-0",
+			},
+			Annotations: map[string]string{"prometheus.io/scrape": "true"},
+		},
+		Spec: corev1.PodSpec{NodeName: "node-1", Containers: []corev1.Container{{Name: "db"}}},
+	}
+
+	pod := populateMigratedPod(migrationRequest, source)
+	// The labels of the controller of the source pod are dropped so that it doesn't adopt the migrated pod
+	if want := map[string]string{"app": "db"}; !equality.Semantic.DeepEqual(pod.Labels, want) {
+		t.Errorf("labels = %v, want %v", pod.Labels, want)
+	}
+	if len(source.Labels) != 4 {
+		t.Errorf("the labels of the source pod were changed: %v", source.Labels)
+	}
+	want := map[string]string{"prometheus.io/scrape": "true", apiv1.MigrationRequestAnnotation: "migration"}
+	if !equality.Semantic.DeepEqual(pod.Annotations, want) {
+		t.Errorf("annotations = %v, want %v", pod.Annotations, want)
+	}
+	if pod.Spec.NodeName != "" || pod.Spec.NodeSelector[hostnameLabel] != "node-2" {
+		t.Errorf("pod is scheduled with nodeName %q and nodeSelector %v, want it pinned to node-2", pod.Spec.NodeName, pod.Spec.NodeSelector)
+	}
+}
@@ -0,0 +1,862 @@
+/*
+Copyright 2023 thehamdiaz.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	snapv1 "github.com/kubernetes-csi/external-snapshotter/client/v4/apis/volumesnapshot/v1"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	apiv1 "github.com/thehamdiaz/first-controller.git/api/v1"
+)
+
+// receivingZFS is a zfs command that sends a fixed stream and records the datasets it receives next to itself,
+// a received dataset is reported as received by a migration until it is destroyed and the others don't exist
+const receivingZFS = `received="$(dirname "$0")/received"
+for dataset; do :; done
+state="$received/$(echo "$dataset" | tr / _)"
+case "$1" in
+send)
+	if [ "$2" = -nvP ]; then
+		printf 'size\t1024\n'
+		exit 0
+	fi
+	printf 'stream'
+	;;
+receive)
+	if [ "$2" = -A ]; then
+		echo "cannot resume: '$dataset' does not have any resumable receive state" >&2
+		exit 1
+	fi
+	mkdir -p "$received" && cat > "$state"
+	;;
+get)
+	if [ ! -e "$state" ]; then
+		echo "cannot open '$dataset': dataset does not exist" >&2
+		exit 1
+	fi
+	printf 'true\tlocal\n'
+	;;
+set)
+	;;
+destroy)
+	rm -f "$state"
+	;;
+*)
+	echo "cannot open '$dataset': dataset does not exist" >&2
+	exit 1
+	;;
+esac
+`
+
+// interruptingZFS is receivingZFS whose first receive into a dataset fails midway, leaving a resumable receive state
+const interruptingZFS = `echo "$@" >> "$(dirname "$0")/zfs.log"
+for dataset; do :; done
+partial="$(dirname "$0")/partial-$(echo "$dataset" | tr / _)"
+if [ "$1" = receive ] && [ "$2" != -A ] && [ ! -e "$partial" ]; then
+	cat > /dev/null
+	touch "$partial"
+	echo "cannot receive new filesystem stream: checksum mismatch or incomplete stream" >&2
+	exit 1
+fi
+case "$*" in
+list*receive_resume_token*)
+	printf '%s\t1-abc-def\n' "$dataset"
+	exit 0
+	;;
+esac
+` + receivingZFS
+
+// createNode creates a node whose agent is the test agent, unless another test did
+func createNode(ctx context.Context, name string) {
+	node := testNode(name)
+	addresses := node.Status.Addresses
+	err := k8sClient.Create(ctx, node)
+	if errors.IsAlreadyExists(err) {
+		return
+	}
+	Expect(err).NotTo(HaveOccurred())
+	node.Status.Addresses = addresses
+	Expect(k8sClient.Status().Update(ctx, node)).To(Succeed())
+}
+
+// createIgnoringExisting creates the objects shared by the tests of the suite
+func createIgnoringExisting(ctx context.Context, objects ...client.Object) {
+	for _, object := range objects {
+		if err := k8sClient.Create(ctx, object); !errors.IsAlreadyExists(err) {
+			Expect(err).NotTo(HaveOccurred())
+		}
+	}
+}
+
+// playControllers does the work of the controllers missing from the test environment: the snapshot controller
+// binds the VolumeSnapshots of the namespace to a ready VolumeSnapshotContent, the kubelet removes the pods
+// being deleted and the protection controller releases the claims being deleted
+func playControllers(ctx context.Context, namespace string) {
+	snapshots := &snapv1.VolumeSnapshotList{}
+	Expect(k8sClient.List(ctx, snapshots, client.InNamespace(namespace))).To(Succeed())
+	for i := range snapshots.Items {
+		vs := &snapshots.Items[i]
+		if vs.Status != nil {
+			continue
+		}
+		content := &snapv1.VolumeSnapshotContent{
+			ObjectMeta: metav1.ObjectMeta{Name: "snapcontent-" + string(vs.UID)},
+			Spec: snapv1.VolumeSnapshotContentSpec{
+				DeletionPolicy:    snapv1.VolumeSnapshotContentDelete,
+				Driver:            zfsCSIDriver,
+				Source:            snapv1.VolumeSnapshotContentSource{VolumeHandle: stringPtr("pvc-" + *vs.Spec.Source.PersistentVolumeClaimName)},
+				VolumeSnapshotRef: corev1.ObjectReference{Namespace: vs.Namespace, Name: vs.Name, UID: vs.UID},
+			},
+		}
+		Expect(k8sClient.Create(ctx, content)).To(Succeed())
+		content.Status = &snapv1.VolumeSnapshotContentStatus{
+			SnapshotHandle: stringPtr(*content.Spec.Source.VolumeHandle + "@snapshot-" + string(vs.UID)),
+		}
+		Expect(k8sClient.Status().Update(ctx, content)).To(Succeed())
+
+		ready := true
+		vs.Status = &snapv1.VolumeSnapshotStatus{BoundVolumeSnapshotContentName: &content.Name, ReadyToUse: &ready}
+		Expect(k8sClient.Status().Update(ctx, vs)).To(Succeed())
+	}
+
+	pods := &corev1.PodList{}
+	Expect(k8sClient.List(ctx, pods, client.InNamespace(namespace))).To(Succeed())
+	for i := range pods.Items {
+		if pods.Items[i].DeletionTimestamp != nil {
+			Expect(client.IgnoreNotFound(k8sClient.Delete(ctx, &pods.Items[i], client.GracePeriodSeconds(0)))).To(Succeed())
+		}
+	}
+
+	claims := &corev1.PersistentVolumeClaimList{}
+	Expect(k8sClient.List(ctx, claims, client.InNamespace(namespace))).To(Succeed())
+	for i := range claims.Items {
+		if claims.Items[i].DeletionTimestamp != nil && len(claims.Items[i].Finalizers) > 0 {
+			claims.Items[i].Finalizers = nil
+			Expect(client.IgnoreNotFound(k8sClient.Update(ctx, &claims.Items[i]))).To(Succeed())
+		}
+	}
+}
+
+func stringPtr(s string) *string {
+	return &s
+}
+
+var _ = Describe("MigrationRequest controller", func() {
+	ctx := context.Background()
+	var namespace string
+	var key types.NamespacedName
+	var defaultBandwidthLimit *resource.Quantity
+
+	BeforeEach(func() {
+		defaultBandwidthLimit = nil
+		Expect(testAgents.setZFS(receivingZFS)).To(Succeed())
+
+		createIgnoringExisting(ctx,
+			&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "openebs"}},
+			&storagev1.StorageClass{
+				ObjectMeta:  metav1.ObjectMeta{Name: "zfs"},
+				Provisioner: zfsCSIDriver,
+				Parameters:  map[string]string{"poolname": "pool"},
+			},
+		)
+		for _, name := range []string{"node-1", "node-2"} {
+			createNode(ctx, name)
+		}
+	})
+
+	// createMigration creates the pod to migrate with its volumes, and its MigrationRequest, in a namespace of their own.
+	// The pod claims a single volume named data unless claims are given.
+	createMigration := func(name, migrationName string, claims ...string) {
+		namespace = name
+		key = types.NamespacedName{Namespace: namespace, Name: migrationName}
+		if len(claims) == 0 {
+			claims = []string{"data"}
+		}
+
+		Expect(k8sClient.Create(ctx, &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: namespace}})).To(Succeed())
+		var volumes []corev1.Volume
+		for _, claim := range claims {
+			Expect(k8sClient.Create(ctx, &corev1.PersistentVolume{
+				ObjectMeta: metav1.ObjectMeta{Name: "pv-" + namespace + "-" + claim},
+				Spec: corev1.PersistentVolumeSpec{
+					StorageClassName:              "zfs",
+					Capacity:                      corev1.ResourceList{corev1.ResourceStorage: resource.MustParse("1Gi")},
+					AccessModes:                   []corev1.PersistentVolumeAccessMode{corev1.ReadWriteOnce},
+					PersistentVolumeReclaimPolicy: corev1.PersistentVolumeReclaimRetain,
+					ClaimRef:                      &corev1.ObjectReference{Namespace: namespace, Name: claim},
+					PersistentVolumeSource: corev1.PersistentVolumeSource{
+						CSI: &corev1.CSIPersistentVolumeSource{Driver: zfsCSIDriver, VolumeHandle: "pvc-" + claim},
+					},
+				},
+			})).To(Succeed())
+			storageClassName := "zfs"
+			Expect(k8sClient.Create(ctx, &corev1.PersistentVolumeClaim{
+				ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: claim},
+				Spec: corev1.PersistentVolumeClaimSpec{
+					StorageClassName: &storageClassName,
+					VolumeName:       "pv-" + namespace + "-" + claim,
+					AccessModes:      []corev1.PersistentVolumeAccessMode{corev1.ReadWriteOnce},
+					Resources: corev1.ResourceRequirements{
+						Requests: corev1.ResourceList{corev1.ResourceStorage: resource.MustParse("1Gi")},
+					},
+				},
+			})).To(Succeed())
+			volumes = append(volumes, corev1.Volume{Name: claim, VolumeSource: corev1.VolumeSource{
+				PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{ClaimName: claim},
+			}})
+		}
+		Expect(k8sClient.Create(ctx, &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: "db", Labels: map[string]string{"app": "db"}},
+			Spec: corev1.PodSpec{
+				NodeName:   "node-1",
+				Containers: []corev1.Container{{Name: "db", Image: "postgres"}},
+				Volumes:    volumes,
+			},
+		})).To(Succeed())
+
+		Expect(k8sClient.Create(ctx, &apiv1.MigrationRequest{
+			ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: key.Name},
+			Spec: apiv1.MigrationRequestSpec{
+				PodName:                 "db",
+				DesiredSnapshotCount:    2,
+				VolumeSnapshotClassName: "migration-vsc",
+				Destination: apiv1.DestinationDef{
+					RemotePool:     "pool",
+					RemoteDataset:  namespace + "-data",
+					RemoteHostName: "node-2",
+				},
+			},
+		})).To(Succeed())
+	}
+
+	// reconcile runs a new reconciler each time, the progress of the migration is only kept in its status
+	reconcile := func() *apiv1.MigrationRequest {
+		reconciler := &MigrationRequestReconciler{Client: k8sClient, Scheme: k8sClient.Scheme(), Agents: testAgents.agents,
+			DefaultBandwidthLimit: defaultBandwidthLimit}
+		_, err := reconciler.Reconcile(ctx, ctrl.Request{NamespacedName: key})
+		Expect(err).NotTo(HaveOccurred())
+		migrationRequest := &apiv1.MigrationRequest{}
+		Expect(k8sClient.Get(ctx, key, migrationRequest)).To(Succeed())
+		return migrationRequest
+	}
+
+	// reconcileUntil reconciles the MigrationRequest until it reaches the phase
+	reconcileUntil := func(phase apiv1.MigrationPhase) *apiv1.MigrationRequest {
+		for deadline := time.Now().Add(30 * time.Second); time.Now().Before(deadline); time.Sleep(20 * time.Millisecond) {
+			migrationRequest := reconcile()
+			Expect(migrationRequest.Status.Phase).NotTo(Equal(apiv1.MigrationPhaseFailed), migrationRequest.Status.Message)
+			if migrationRequest.Status.Phase == phase {
+				return migrationRequest
+			}
+			playControllers(ctx, namespace)
+		}
+		Fail("the MigrationRequest didn't reach phase " + string(phase))
+		return nil
+	}
+
+	It("migrates a pod through all the phases", func() {
+		createMigration("apps", "migration")
+
+		By("preparing the migration")
+		reconcileUntil(apiv1.MigrationPhasePreparing)
+		migrationRequest := reconcileUntil(apiv1.MigrationPhaseSnapshotting)
+		Expect(migrationRequest.Status.Source.NodeName).To(Equal("node-1"))
+		Expect(migrationRequest.Status.Volumes).To(HaveLen(1))
+		volume := migrationRequest.Status.Volumes[0]
+		Expect(volume.PersistentVolumeClaimName).To(Equal("data"))
+		Expect(volume.PoolName).To(Equal("pool"))
+		Expect(volume.RemoteDataset).To(Equal("apps-data"))
+
+		By("sending the first snapshot")
+		migrationRequest = reconcileUntil(apiv1.MigrationPhaseSending)
+		Expect(migrationRequest.Status.SnapshotCount).To(Equal(1))
+		Expect(migrationRequest.Status.CurrentSnapshot.Handles).To(HaveLen(1))
+		Expect(migrationRequest.Status.CurrentSnapshot.Handles[0]).To(HavePrefix("pool/pvc-data@snapshot-"))
+		migrationRequest = reconcileUntil(apiv1.MigrationPhaseCuttingOver)
+		Expect(migrationRequest.Status.ConfirmedSnapshotCount).To(Equal(1))
+		Expect(migrationRequest.Status.Volumes[0].IncrementalBase).To(HavePrefix("pool/pvc-data@snapshot-"))
+		received, err := os.ReadFile(filepath.Join(testAgents.dir, "bin", "received", "pool_apps-data"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(received)).To(Equal("stream"))
+
+		By("stopping the pod")
+		migrationRequest = reconcileUntil(apiv1.MigrationPhaseSnapshotting)
+		err = k8sClient.Get(ctx, types.NamespacedName{Namespace: namespace, Name: "db"}, &corev1.Pod{})
+		Expect(errors.IsNotFound(err)).To(BeTrue())
+		Expect(meta.IsStatusConditionTrue(migrationRequest.Status.Conditions, apiv1.MigrationConditionPodStopped)).To(BeTrue())
+
+		By("sending the final snapshot")
+		migrationRequest = reconcileUntil(apiv1.MigrationPhaseRestoring)
+		Expect(migrationRequest.Status.ConfirmedSnapshotCount).To(Equal(2))
+		Expect(meta.IsStatusConditionTrue(migrationRequest.Status.Conditions, apiv1.MigrationConditionSnapshotsSent)).To(BeTrue())
+		Expect(migrationRequest.Status.Volumes[0].SentSnapshots).To(HaveLen(2))
+
+		By("restoring the volume")
+		migrationRequest = reconcile()
+		Expect(migrationRequest.Status.Volumes[0].RestoreRequestName).To(Equal("restore-migration-data"))
+		restoreRequest := &apiv1.RestoreRequest{}
+		restoreKey := types.NamespacedName{Namespace: namespace, Name: "restore-migration-data"}
+		Expect(k8sClient.Get(ctx, restoreKey, restoreRequest)).To(Succeed())
+		Expect(restoreRequest.Spec.Names.PVCName).To(Equal("restored-data"))
+		Expect(restoreRequest.Spec.Names.PVCNamespace).To(Equal(namespace))
+		Expect(restoreRequest.Spec.Names.ZFSDatasetName).To(Equal("apps-data"))
+		Expect(restoreRequest.Spec.Names.TargetNodeName).To(Equal("node-2"))
+		migratedPod := &corev1.Pod{}
+		Expect(k8sClient.Get(ctx, types.NamespacedName{Namespace: namespace, Name: "migrated-pod-db"}, migratedPod)).To(Succeed())
+		Expect(migratedPod.Spec.Volumes[0].PersistentVolumeClaim.ClaimName).To(Equal("restored-data"))
+
+		restoreReconciler := &RestoreRequestReconciler{Client: k8sClient, Scheme: k8sClient.Scheme(), Agents: testAgents.agents}
+		_, err = restoreReconciler.Reconcile(ctx, ctrl.Request{NamespacedName: restoreKey})
+		Expect(err).NotTo(HaveOccurred())
+		pv := &corev1.PersistentVolume{}
+		Expect(k8sClient.Get(ctx, types.NamespacedName{Name: restoreRequest.Spec.Names.PVName}, pv)).To(Succeed())
+		Expect(pv.Spec.ClaimRef.Namespace).To(Equal(namespace))
+		Expect(pv.Spec.ClaimRef.Name).To(Equal("restored-data"))
+		Expect(k8sClient.Get(ctx, types.NamespacedName{Namespace: namespace, Name: "restored-data"}, &corev1.PersistentVolumeClaim{})).To(Succeed())
+
+		By("completing the migration")
+		migrationRequest = reconcileUntil(apiv1.MigrationPhaseCompleted)
+		Expect(meta.IsStatusConditionTrue(migrationRequest.Status.Conditions, apiv1.MigrationConditionRestored)).To(BeTrue())
+		Expect(meta.IsStatusConditionTrue(migrationRequest.Status.Conditions, apiv1.MigrationConditionCompleted)).To(BeTrue())
+	})
+
+	It("migrates every ZFS-LocalPV volume of the pod", func() {
+		createMigration("volumes", "volumes", "data", "logs")
+
+		By("receiving each volume into a dataset of its own")
+		migrationRequest := reconcileUntil(apiv1.MigrationPhaseSnapshotting)
+		Expect(migrationRequest.Status.Volumes).To(HaveLen(2))
+		Expect(migrationRequest.Status.Volumes[0].RemoteDataset).To(Equal("volumes-data-data"))
+		Expect(migrationRequest.Status.Volumes[1].RemoteDataset).To(Equal("volumes-data-logs"))
+
+		By("sending the snapshots of all the volumes")
+		migrationRequest = reconcileUntil(apiv1.MigrationPhaseRestoring)
+		for _, volume := range migrationRequest.Status.Volumes {
+			Expect(volume.SentSnapshots).To(HaveLen(2))
+			Expect(volume.SentSnapshots[0]).To(HavePrefix("pool/pvc-" + volume.Name + "@snapshot-"))
+			Expect(filepath.Join(testAgents.dir, "bin", "received", "pool_"+volume.RemoteDataset)).To(BeAnExistingFile())
+		}
+
+		By("restoring each volume for the migrated pod")
+		migrationRequest = reconcile()
+		for _, volume := range migrationRequest.Status.Volumes {
+			restoreRequest := &apiv1.RestoreRequest{}
+			Expect(k8sClient.Get(ctx, types.NamespacedName{Namespace: namespace, Name: volume.RestoreRequestName}, restoreRequest)).To(Succeed())
+			Expect(restoreRequest.Spec.Names.ZFSDatasetName).To(Equal(volume.RemoteDataset))
+		}
+		migratedPod := &corev1.Pod{}
+		Expect(k8sClient.Get(ctx, types.NamespacedName{Namespace: namespace, Name: "migrated-pod-db"}, migratedPod)).To(Succeed())
+		Expect(migratedPod.Spec.Volumes[0].PersistentVolumeClaim.ClaimName).To(Equal("restored-data"))
+		Expect(migratedPod.Spec.Volumes[1].PersistentVolumeClaim.ClaimName).To(Equal("restored-logs"))
+	})
+
+	It("restores the claims and the pod under their source names", func() {
+		createMigration("keep-names", "keep-names")
+		migrationRequest := &apiv1.MigrationRequest{}
+		Expect(k8sClient.Get(ctx, key, migrationRequest)).To(Succeed())
+		migrationRequest.Spec.KeepNames = true
+		Expect(k8sClient.Update(ctx, migrationRequest)).To(Succeed())
+
+		migrationRequest = reconcileUntil(apiv1.MigrationPhaseRestoring)
+		Expect(migrationRequest.Status.Volumes[0].RestoredClaimName).To(Equal("data"))
+
+		By("releasing the source claim, its volume is retained for a rollback")
+		Eventually(func() string {
+			migrationRequest = reconcile()
+			playControllers(ctx, namespace)
+			return migrationRequest.Status.Volumes[0].RestoreRequestName
+		}, 10*time.Second, 20*time.Millisecond).ShouldNot(BeEmpty())
+		err := k8sClient.Get(ctx, types.NamespacedName{Namespace: namespace, Name: "data"}, &corev1.PersistentVolumeClaim{})
+		Expect(errors.IsNotFound(err)).To(BeTrue())
+		Expect(k8sClient.Get(ctx, types.NamespacedName{Name: "pv-keep-names-data"}, &corev1.PersistentVolume{})).To(Succeed())
+		restoreRequest := &apiv1.RestoreRequest{}
+		Expect(k8sClient.Get(ctx, types.NamespacedName{Namespace: namespace, Name: migrationRequest.Status.Volumes[0].RestoreRequestName}, restoreRequest)).To(Succeed())
+		Expect(restoreRequest.Spec.Names.PVCName).To(Equal("data"))
+
+		By("starting the migrated pod under the name of the source pod")
+		migratedPod := &corev1.Pod{}
+		Expect(k8sClient.Get(ctx, types.NamespacedName{Namespace: namespace, Name: "db"}, migratedPod)).To(Succeed())
+		Expect(migratedPod.Annotations).To(HaveKeyWithValue(apiv1.MigrationRequestAnnotation, "keep-names"))
+		Expect(migratedPod.Spec.NodeSelector).To(HaveKeyWithValue(hostnameLabel, "node-2"))
+		Expect(migratedPod.Spec.Volumes[0].PersistentVolumeClaim.ClaimName).To(Equal("data"))
+	})
+
+	It("fails the migration when the source claim was recreated and bound to another volume", func() {
+		createMigration("recreated-claim", "recreated-claim")
+		migrationRequest := &apiv1.MigrationRequest{}
+		Expect(k8sClient.Get(ctx, key, migrationRequest)).To(Succeed())
+		migrationRequest.Spec.KeepNames = true
+		Expect(k8sClient.Update(ctx, migrationRequest)).To(Succeed())
+		reconcileUntil(apiv1.MigrationPhaseRestoring)
+
+		By("recreating the claim bound to a new volume, as a StatefulSet would while the webhook is unavailable")
+		claimKey := types.NamespacedName{Namespace: namespace, Name: "data"}
+		Expect(k8sClient.Delete(ctx, &corev1.PersistentVolumeClaim{ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: "data"}})).To(Succeed())
+		Eventually(func() bool {
+			playControllers(ctx, namespace)
+			return errors.IsNotFound(k8sClient.Get(ctx, claimKey, &corev1.PersistentVolumeClaim{}))
+		}, 10*time.Second, 20*time.Millisecond).Should(BeTrue())
+		storageClassName := "zfs"
+		pvc := &corev1.PersistentVolumeClaim{
+			ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: "data"},
+			Spec: corev1.PersistentVolumeClaimSpec{
+				StorageClassName: &storageClassName,
+				VolumeName:       "pvc-provisioned",
+				AccessModes:      []corev1.PersistentVolumeAccessMode{corev1.ReadWriteOnce},
+				Resources: corev1.ResourceRequirements{
+					Requests: corev1.ResourceList{corev1.ResourceStorage: resource.MustParse("1Gi")},
+				},
+			},
+		}
+		Expect(k8sClient.Create(ctx, pvc)).To(Succeed())
+		pvc.Status.Phase = corev1.ClaimBound
+		Expect(k8sClient.Status().Update(ctx, pvc)).To(Succeed())
+
+		migrationRequest = reconcile()
+		Expect(migrationRequest.Status.Phase).To(Equal(apiv1.MigrationPhaseFailed))
+		Expect(migrationRequest.Status.Message).To(ContainSubstring("bound to PersistentVolume pvc-provisioned"))
+		Expect(k8sClient.Get(ctx, claimKey, pvc)).To(Succeed())
+		Expect(pvc.DeletionTimestamp).To(BeNil())
+	})
+
+	It("fails the migration of a pod whose claim isn't bound to a volume", func() {
+		createMigration("unbound-claim", "unbound-claim")
+
+		By("replacing the claim of the pod with a pending one")
+		claimKey := types.NamespacedName{Namespace: namespace, Name: "data"}
+		Expect(k8sClient.Delete(ctx, &corev1.PersistentVolumeClaim{ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: "data"}})).To(Succeed())
+		Eventually(func() bool {
+			playControllers(ctx, namespace)
+			return errors.IsNotFound(k8sClient.Get(ctx, claimKey, &corev1.PersistentVolumeClaim{}))
+		}, 10*time.Second, 20*time.Millisecond).Should(BeTrue())
+		storageClassName := "zfs"
+		pvc := &corev1.PersistentVolumeClaim{
+			ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: "data"},
+			Spec: corev1.PersistentVolumeClaimSpec{
+				StorageClassName: &storageClassName,
+				AccessModes:      []corev1.PersistentVolumeAccessMode{corev1.ReadWriteOnce},
+				Resources: corev1.ResourceRequirements{
+					Requests: corev1.ResourceList{corev1.ResourceStorage: resource.MustParse("1Gi")},
+				},
+			},
+		}
+		Expect(k8sClient.Create(ctx, pvc)).To(Succeed())
+		pvc.Status.Phase = corev1.ClaimPending
+		Expect(k8sClient.Status().Update(ctx, pvc)).To(Succeed())
+
+		migrationRequest := reconcile()
+		Expect(migrationRequest.Status.Phase).To(Equal(apiv1.MigrationPhasePreparing))
+		migrationRequest = reconcile()
+		Expect(migrationRequest.Status.Phase).To(Equal(apiv1.MigrationPhaseFailed))
+		Expect(migrationRequest.Status.Message).To(Equal("PersistentVolumeClaim data is Pending and bound to no PersistentVolume, there is no volume to migrate"))
+	})
+
+	It("waits for the VolumeSnapshotContent to record the snapshot handle", func() {
+		createMigration("pending-handle", "pending-handle")
+		reconcileUntil(apiv1.MigrationPhaseSnapshotting)
+		reconcile()
+		snapshots := &snapv1.VolumeSnapshotList{}
+		Expect(k8sClient.List(ctx, snapshots, client.InNamespace(namespace))).To(Succeed())
+		Expect(snapshots.Items).To(HaveLen(1))
+		vs := &snapshots.Items[0]
+
+		By("reporting the VolumeSnapshot ready before it is bound to its content")
+		ready := true
+		vs.Status = &snapv1.VolumeSnapshotStatus{ReadyToUse: &ready}
+		Expect(k8sClient.Status().Update(ctx, vs)).To(Succeed())
+		Expect(reconcile().Status.Phase).To(Equal(apiv1.MigrationPhaseSnapshotting))
+
+		By("binding it to a content without a snapshot handle")
+		content := &snapv1.VolumeSnapshotContent{
+			ObjectMeta: metav1.ObjectMeta{Name: "snapcontent-" + string(vs.UID)},
+			Spec: snapv1.VolumeSnapshotContentSpec{
+				DeletionPolicy:    snapv1.VolumeSnapshotContentDelete,
+				Driver:            zfsCSIDriver,
+				Source:            snapv1.VolumeSnapshotContentSource{VolumeHandle: stringPtr("pvc-data")},
+				VolumeSnapshotRef: corev1.ObjectReference{Namespace: vs.Namespace, Name: vs.Name, UID: vs.UID},
+			},
+		}
+		vs.Status.BoundVolumeSnapshotContentName = &content.Name
+		Expect(k8sClient.Status().Update(ctx, vs)).To(Succeed())
+		Expect(reconcile().Status.Phase).To(Equal(apiv1.MigrationPhaseSnapshotting))
+		Expect(k8sClient.Create(ctx, content)).To(Succeed())
+		Expect(reconcile().Status.Phase).To(Equal(apiv1.MigrationPhaseSnapshotting))
+
+		By("sending the snapshot once its handle is recorded")
+		content.Status = &snapv1.VolumeSnapshotContentStatus{SnapshotHandle: stringPtr("pvc-data@snapshot-" + string(vs.UID))}
+		Expect(k8sClient.Status().Update(ctx, content)).To(Succeed())
+		migrationRequest := reconcile()
+		Expect(migrationRequest.Status.Phase).To(Equal(apiv1.MigrationPhaseSending))
+		Expect(migrationRequest.Status.CurrentSnapshot.Handles).To(Equal([]string{"pool/pvc-data@snapshot-" + string(vs.UID)}))
+	})
+
+	It("resumes an interrupted send from the resume token of the destination", func() {
+		Expect(testAgents.setZFS(interruptingZFS)).To(Succeed())
+		createMigration("resume", "resume")
+		sending := reconcileUntil(apiv1.MigrationPhaseSending)
+
+		By("recording the resume token of the failed attempt")
+		var migrationRequest *apiv1.MigrationRequest
+		Eventually(func() string {
+			migrationRequest = reconcile()
+			return migrationRequest.Status.ResumeToken
+		}, 10*time.Second, 20*time.Millisecond).Should(Equal("1-abc-def"))
+		Expect(migrationRequest.Status.Phase).To(Equal(apiv1.MigrationPhaseSending))
+		Expect(migrationRequest.Status.SendAttempt).To(BeEquivalentTo(1))
+
+		By("resuming the stream in the next attempt")
+		migrationRequest = reconcileUntil(apiv1.MigrationPhaseCuttingOver)
+		Expect(migrationRequest.Status.ResumeToken).To(BeEmpty())
+		Expect(migrationRequest.Status.SendAttempt).To(BeZero())
+		Expect(migrationRequest.Status.Volumes[0].SentSnapshots).To(Equal(sending.Status.CurrentSnapshot.Handles))
+		log, err := os.ReadFile(filepath.Join(testAgents.dir, "bin", "zfs.log"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(log)).To(ContainSubstring("send -t 1-abc-def\n"))
+		Expect(string(log)).To(ContainSubstring("receive -s -u -o zfs-volume-migrator:migrated=true pool/resume-data\n"))
+	})
+
+	It("rolls back a migration aborted after the pod was stopped", func() {
+		createMigration("aborted", "aborted")
+		pod := &corev1.Pod{}
+		Expect(k8sClient.Get(ctx, types.NamespacedName{Namespace: namespace, Name: "db"}, pod)).To(Succeed())
+		pod.Annotations = map[string]string{"backup.velero.io/backup-volumes": "data"}
+		Expect(k8sClient.Update(ctx, pod)).To(Succeed())
+		reconcileUntil(apiv1.MigrationPhaseCuttingOver)
+		migrationRequest := reconcileUntil(apiv1.MigrationPhaseSnapshotting)
+		Expect(meta.IsStatusConditionTrue(migrationRequest.Status.Conditions, apiv1.MigrationConditionPodStopped)).To(BeTrue())
+		received := filepath.Join(testAgents.dir, "bin", "received", "pool_aborted-data")
+		Expect(received).To(BeAnExistingFile())
+
+		By("aborting the migration")
+		migrationRequest.Spec.Abort = true
+		Expect(k8sClient.Update(ctx, migrationRequest)).To(Succeed())
+		migrationRequest = reconcileUntil(apiv1.MigrationPhaseAborted)
+		Expect(migrationRequest.Status.Rollback.FromPhase).To(Equal(apiv1.MigrationPhaseSnapshotting))
+		Expect(migrationRequest.Status.Rollback.SendCanceled).To(BeTrue())
+		Expect(migrationRequest.Status.Rollback.DestinationCleaned).To(BeTrue())
+		Expect(meta.IsStatusConditionTrue(migrationRequest.Status.Conditions, apiv1.MigrationConditionAborted)).To(BeTrue())
+
+		By("destroying what the destination received")
+		Expect(received).NotTo(BeAnExistingFile())
+
+		By("recreating the source pod on the source node")
+		Expect(migrationRequest.Status.Rollback.RecreatedPod).To(Equal("db"))
+		pod = &corev1.Pod{}
+		Expect(k8sClient.Get(ctx, types.NamespacedName{Namespace: namespace, Name: "db"}, pod)).To(Succeed())
+		Expect(pod.Spec.NodeName).To(Equal("node-1"))
+		Expect(pod.Labels).To(Equal(map[string]string{"app": "db"}))
+		Expect(pod.Annotations).To(Equal(map[string]string{"backup.velero.io/backup-volumes": "data"}))
+		Expect(pod.OwnerReferences).To(BeEmpty())
+		Expect(pod.Spec.Volumes[0].PersistentVolumeClaim.ClaimName).To(Equal("data"))
+	})
+
+	It("leaves the source pod to its controller when a migration without its workload is aborted", func() {
+		createMigration("aborted-controlled", "aborted-controlled")
+		replicaSet := &appsv1.ReplicaSet{
+			ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: "db"},
+			Spec: appsv1.ReplicaSetSpec{
+				Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "db"}},
+				Template: corev1.PodTemplateSpec{
+					ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{"app": "db"}},
+					Spec:       corev1.PodSpec{Containers: []corev1.Container{{Name: "db", Image: "postgres"}}},
+				},
+			},
+		}
+		Expect(k8sClient.Create(ctx, replicaSet)).To(Succeed())
+		pod := &corev1.Pod{}
+		Expect(k8sClient.Get(ctx, types.NamespacedName{Namespace: namespace, Name: "db"}, pod)).To(Succeed())
+		Expect(ctrl.SetControllerReference(replicaSet, pod, k8sClient.Scheme())).To(Succeed())
+		Expect(k8sClient.Update(ctx, pod)).To(Succeed())
+
+		reconcileUntil(apiv1.MigrationPhaseCuttingOver)
+		migrationRequest := reconcileUntil(apiv1.MigrationPhaseSnapshotting)
+		Expect(meta.IsStatusConditionTrue(migrationRequest.Status.Conditions, apiv1.MigrationConditionPodStopped)).To(BeTrue())
+
+		migrationRequest.Spec.Abort = true
+		Expect(k8sClient.Update(ctx, migrationRequest)).To(Succeed())
+		migrationRequest = reconcileUntil(apiv1.MigrationPhaseAborted)
+		Expect(migrationRequest.Status.Rollback.RecreatedPod).To(BeEmpty())
+		err := k8sClient.Get(ctx, types.NamespacedName{Namespace: namespace, Name: "db"}, &corev1.Pod{})
+		Expect(errors.IsNotFound(err)).To(BeTrue())
+	})
+
+	It("doesn't run the pre-snapshot hooks again once they ran", func() {
+		createMigration("quiesced", "quiesced")
+		migrationRequest := reconcileUntil(apiv1.MigrationPhaseSnapshotting)
+		migrationRequest.Spec.Hooks = &apiv1.SnapshotHooks{Pre: []apiv1.ExecHook{{Command: []string{"fsfreeze", "--freeze", "/data"}}}}
+		Expect(k8sClient.Update(ctx, migrationRequest)).To(Succeed())
+
+		By("resuming a snapshot whose VolumeSnapshots couldn't be created after the hooks ran")
+		// The reconciler has no PodExec, running a hook would panic
+		migrationRequest.Status.SnapshotCount++
+		migrationRequest.Status.CurrentSnapshot = &apiv1.SnapshotRef{
+			Name:      fmt.Sprintf("migration-snapshot-%s-%d", migrationRequest.Name, migrationRequest.Status.SnapshotCount),
+			Quiescing: true,
+		}
+		Expect(k8sClient.Status().Update(ctx, migrationRequest)).To(Succeed())
+		migrationRequest = reconcile()
+		Expect(migrationRequest.Status.CurrentSnapshot.Quiescing).To(BeTrue())
+		snapshots := &snapv1.VolumeSnapshotList{}
+		Expect(k8sClient.List(ctx, snapshots, client.InNamespace(namespace))).To(Succeed())
+		Expect(snapshots.Items).To(HaveLen(1))
+		Expect(snapshots.Items[0].Name).To(HavePrefix(migrationRequest.Status.CurrentSnapshot.Name))
+	})
+
+	It("holds a suspended migration until it is resumed", func() {
+		createMigration("suspended", "suspended")
+		setSuspend := func(suspend bool) {
+			migrationRequest := &apiv1.MigrationRequest{}
+			Expect(k8sClient.Get(ctx, key, migrationRequest)).To(Succeed())
+			migrationRequest.Spec.Suspend = suspend
+			Expect(k8sClient.Update(ctx, migrationRequest)).To(Succeed())
+		}
+		suspended := func(migrationRequest *apiv1.MigrationRequest) bool {
+			return meta.IsStatusConditionTrue(migrationRequest.Status.Conditions, apiv1.MigrationConditionSuspended)
+		}
+
+		By("holding the migration before the send starts")
+		reconcileUntil(apiv1.MigrationPhaseSending)
+		setSuspend(true)
+		for i := 0; i < 3; i++ {
+			migrationRequest := reconcile()
+			Expect(migrationRequest.Status.Phase).To(Equal(apiv1.MigrationPhaseSending))
+			Expect(suspended(migrationRequest)).To(BeTrue())
+		}
+		Expect(filepath.Join(testAgents.dir, "bin", "received", "pool_suspended-data")).NotTo(BeAnExistingFile())
+
+		By("continuing from where it was held")
+		setSuspend(false)
+		migrationRequest := reconcileUntil(apiv1.MigrationPhaseCuttingOver)
+		Expect(suspended(migrationRequest)).To(BeFalse())
+		Expect(meta.FindStatusCondition(migrationRequest.Status.Conditions, apiv1.MigrationConditionSuspended).Reason).To(Equal(apiv1.ReasonResumed))
+		Expect(migrationRequest.Status.ConfirmedSnapshotCount).To(Equal(1))
+
+		By("not holding the migration once the pod is stopped")
+		migrationRequest = reconcileUntil(apiv1.MigrationPhaseSnapshotting)
+		Expect(meta.IsStatusConditionTrue(migrationRequest.Status.Conditions, apiv1.MigrationConditionPodStopped)).To(BeTrue())
+		setSuspend(true)
+		migrationRequest = reconcileUntil(apiv1.MigrationPhaseRestoring)
+		Expect(suspended(migrationRequest)).To(BeFalse())
+	})
+
+	It("holds the cutover while another pod mounts the claims, unless it may delete it", func() {
+		createMigration("consumers", "consumers")
+		backupKey := types.NamespacedName{Namespace: namespace, Name: "backup"}
+		Expect(k8sClient.Create(ctx, &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: backupKey.Name},
+			Spec: corev1.PodSpec{
+				NodeName:   "node-1",
+				Containers: []corev1.Container{{Name: "backup", Image: "restic"}},
+				Volumes: []corev1.Volume{{Name: "data", VolumeSource: corev1.VolumeSource{
+					PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{ClaimName: "data"},
+				}}},
+			},
+		})).To(Succeed())
+
+		By("refusing to stop the source pod while the other pod runs")
+		reconcileUntil(apiv1.MigrationPhaseCuttingOver)
+		var migrationRequest *apiv1.MigrationRequest
+		for i := 0; i < 3; i++ {
+			migrationRequest = reconcile()
+			Expect(migrationRequest.Status.Phase).To(Equal(apiv1.MigrationPhaseCuttingOver))
+		}
+		consumersStopped := meta.FindStatusCondition(migrationRequest.Status.Conditions, apiv1.MigrationConditionConsumersStopped)
+		Expect(consumersStopped.Status).To(Equal(metav1.ConditionFalse))
+		Expect(consumersStopped.Reason).To(Equal(apiv1.ReasonUnmanagedConsumers))
+		Expect(consumersStopped.Message).To(ContainSubstring("backup"))
+		Expect(k8sClient.Get(ctx, types.NamespacedName{Namespace: namespace, Name: "db"}, &corev1.Pod{})).To(Succeed())
+
+		By("deleting the other pod with the source pod once allowed to")
+		migrationRequest.Spec.Consumers = apiv1.ConsumerPolicyDelete
+		Expect(k8sClient.Update(ctx, migrationRequest)).To(Succeed())
+		migrationRequest = reconcileUntil(apiv1.MigrationPhaseSnapshotting)
+		Expect(meta.IsStatusConditionTrue(migrationRequest.Status.Conditions, apiv1.MigrationConditionConsumersStopped)).To(BeTrue())
+		err := k8sClient.Get(ctx, backupKey, &corev1.Pod{})
+		Expect(errors.IsNotFound(err)).To(BeTrue())
+	})
+
+	It("sends with the bandwidth limit of the migration", func() {
+		limit := resource.MustParse("10Mi")
+		defaultBandwidthLimit = &limit
+		createMigration("limited", "limited")
+		migrationRequest := reconcileUntil(apiv1.MigrationPhaseSending)
+		bandwidthLimit := func() int64 {
+			r := &MigrationRequestReconciler{Client: k8sClient, Scheme: k8sClient.Scheme(), Agents: testAgents.agents,
+				DefaultBandwidthLimit: defaultBandwidthLimit}
+			request, err := r.sendRequest(ctx, migrationRequest)
+			Expect(err).NotTo(HaveOccurred())
+			return request.BandwidthLimit
+		}
+		Expect(bandwidthLimit()).To(BeEquivalentTo(10 * 1024 * 1024))
+
+		By("overriding the default limit")
+		migrationLimit := resource.MustParse("1Mi")
+		migrationRequest.Spec.BandwidthLimit = &migrationLimit
+		Expect(bandwidthLimit()).To(BeEquivalentTo(1024 * 1024))
+
+		By("lifting the limit")
+		migrationLimit = resource.MustParse("0")
+		Expect(bandwidthLimit()).To(BeZero())
+	})
+
+	// controlByStatefulSet makes a StatefulSet with a volumeClaimTemplate for the data volume the controller of the pod
+	// and the workload of the migration, stopped with the mode
+	controlByStatefulSet := func(stop apiv1.WorkloadStopMode) *appsv1.StatefulSet {
+		replicas := int32(1)
+		labels := map[string]string{"app": "db"}
+		statefulSet := &appsv1.StatefulSet{
+			ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: "db"},
+			Spec: appsv1.StatefulSetSpec{
+				Replicas:    &replicas,
+				ServiceName: "db",
+				Selector:    &metav1.LabelSelector{MatchLabels: labels},
+				Template: corev1.PodTemplateSpec{
+					ObjectMeta: metav1.ObjectMeta{Labels: labels},
+					Spec:       corev1.PodSpec{Containers: []corev1.Container{{Name: "db", Image: "postgres"}}},
+				},
+				VolumeClaimTemplates: []corev1.PersistentVolumeClaim{{
+					ObjectMeta: metav1.ObjectMeta{Name: "data"},
+					Spec: corev1.PersistentVolumeClaimSpec{
+						AccessModes: []corev1.PersistentVolumeAccessMode{corev1.ReadWriteOnce},
+						Resources: corev1.ResourceRequirements{
+							Requests: corev1.ResourceList{corev1.ResourceStorage: resource.MustParse("1Gi")},
+						},
+					},
+				}},
+			},
+		}
+		Expect(k8sClient.Create(ctx, statefulSet)).To(Succeed())
+
+		pod := &corev1.Pod{}
+		Expect(k8sClient.Get(ctx, types.NamespacedName{Namespace: namespace, Name: "db"}, pod)).To(Succeed())
+		controller := true
+		pod.OwnerReferences = []metav1.OwnerReference{{
+			APIVersion: "apps/v1", Kind: "StatefulSet", Name: statefulSet.Name, UID: statefulSet.UID, Controller: &controller,
+		}}
+		Expect(k8sClient.Update(ctx, pod)).To(Succeed())
+
+		migrationRequest := &apiv1.MigrationRequest{}
+		Expect(k8sClient.Get(ctx, key, migrationRequest)).To(Succeed())
+		migrationRequest.Spec.Workload = &apiv1.WorkloadReference{Kind: apiv1.WorkloadKindStatefulSet, Name: statefulSet.Name, Stop: stop}
+		Expect(k8sClient.Update(ctx, migrationRequest)).To(Succeed())
+		return statefulSet
+	}
+
+	// replicasOf returns the replicas of the StatefulSet
+	replicasOf := func(statefulSet *appsv1.StatefulSet) int32 {
+		Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(statefulSet), statefulSet)).To(Succeed())
+		return *statefulSet.Spec.Replicas
+	}
+
+	// stopStatefulSetPod reconciles the migration until its StatefulSet is scaled to zero, then deletes the pod
+	// as the StatefulSet controller would
+	stopStatefulSetPod := func(statefulSet *appsv1.StatefulSet) {
+		reconcileUntil(apiv1.MigrationPhaseCuttingOver)
+		Eventually(func() int32 {
+			reconcile()
+			return replicasOf(statefulSet)
+		}, 10*time.Second, 20*time.Millisecond).Should(BeZero())
+		Expect(k8sClient.Get(ctx, types.NamespacedName{Namespace: namespace, Name: "db"}, &corev1.Pod{})).To(Succeed())
+		Expect(k8sClient.Delete(ctx, &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: "db"}})).To(Succeed())
+	}
+
+	It("scales the StatefulSet of the pod down for the cutover and back up once restored", func() {
+		createMigration("statefulset", "statefulset")
+		statefulSet := controlByStatefulSet(apiv1.WorkloadStopScaleToZero)
+
+		By("keeping the name of the claim of the volumeClaimTemplate")
+		migrationRequest := reconcileUntil(apiv1.MigrationPhaseSnapshotting)
+		Expect(migrationRequest.Status.Source.Workload.Kind).To(Equal(apiv1.WorkloadKindStatefulSet))
+		Expect(migrationRequest.Status.Volumes[0].RestoredClaimName).To(Equal("data"))
+
+		By("scaling the StatefulSet to zero instead of deleting the pod")
+		stopStatefulSetPod(statefulSet)
+		migrationRequest = reconcileUntil(apiv1.MigrationPhaseRestoring)
+		Expect(*migrationRequest.Status.Source.Workload.Replicas).To(BeEquivalentTo(1))
+
+		By("releasing the source claim for the restored one, without a migrated pod")
+		Eventually(func() string {
+			migrationRequest = reconcile()
+			playControllers(ctx, namespace)
+			return migrationRequest.Status.Volumes[0].RestoreRequestName
+		}, 10*time.Second, 20*time.Millisecond).ShouldNot(BeEmpty())
+		restoreRequest := &apiv1.RestoreRequest{}
+		restoreKey := types.NamespacedName{Namespace: namespace, Name: migrationRequest.Status.Volumes[0].RestoreRequestName}
+		Expect(k8sClient.Get(ctx, restoreKey, restoreRequest)).To(Succeed())
+		Expect(restoreRequest.Spec.Names.PVCName).To(Equal("data"))
+		pv := &corev1.PersistentVolume{}
+		Expect(k8sClient.Get(ctx, types.NamespacedName{Name: "pv-statefulset-data"}, pv)).To(Succeed())
+		Expect(pv.Spec.PersistentVolumeReclaimPolicy).To(Equal(corev1.PersistentVolumeReclaimRetain))
+		err := k8sClient.Get(ctx, types.NamespacedName{Namespace: namespace, Name: "data"}, &corev1.PersistentVolumeClaim{})
+		Expect(errors.IsNotFound(err)).To(BeTrue())
+		err = k8sClient.Get(ctx, types.NamespacedName{Namespace: namespace, Name: "migrated-pod-db"}, &corev1.Pod{})
+		Expect(errors.IsNotFound(err)).To(BeTrue())
+
+		By("scaling the StatefulSet back up once the volume is restored")
+		meta.SetStatusCondition(&migrationRequest.Status.Conditions, metav1.Condition{
+			Type: apiv1.MigrationConditionRestored, Status: metav1.ConditionTrue, Reason: apiv1.ReasonRestored,
+		})
+		Expect(k8sClient.Status().Update(ctx, migrationRequest)).To(Succeed())
+		reconcileUntil(apiv1.MigrationPhaseCompleted)
+		Expect(replicasOf(statefulSet)).To(BeEquivalentTo(1))
+	})
+
+	It("deletes the pod of a StatefulSet alone when its claims come from the volumeClaimTemplates", func() {
+		createMigration("statefulset-pod", "statefulset-pod")
+		statefulSet := controlByStatefulSet("")
+
+		migrationRequest := reconcileUntil(apiv1.MigrationPhaseSnapshotting)
+		Expect(migrationRequest.Status.Source.Workload.Stop).To(Equal(apiv1.WorkloadStopDeletePod))
+		migrationRequest = reconcileUntil(apiv1.MigrationPhaseCuttingOver)
+		migrationRequest = reconcileUntil(apiv1.MigrationPhaseSnapshotting)
+		Expect(meta.IsStatusConditionTrue(migrationRequest.Status.Conditions, apiv1.MigrationConditionPodStopped)).To(BeTrue())
+		err := k8sClient.Get(ctx, types.NamespacedName{Namespace: namespace, Name: "db"}, &corev1.Pod{})
+		Expect(errors.IsNotFound(err)).To(BeTrue())
+		Expect(replicasOf(statefulSet)).To(BeEquivalentTo(1))
+	})
+
+	It("scales the StatefulSet back up when the migration is aborted", func() {
+		createMigration("statefulset-aborted", "statefulset-aborted")
+		statefulSet := controlByStatefulSet(apiv1.WorkloadStopScaleToZero)
+		stopStatefulSetPod(statefulSet)
+		migrationRequest := reconcileUntil(apiv1.MigrationPhaseSnapshotting)
+
+		migrationRequest.Spec.Abort = true
+		Expect(k8sClient.Update(ctx, migrationRequest)).To(Succeed())
+		migrationRequest = reconcileUntil(apiv1.MigrationPhaseAborted)
+		Expect(migrationRequest.Status.Rollback.RecreatedPod).To(BeEmpty())
+		Expect(replicasOf(statefulSet)).To(BeEquivalentTo(1))
+	})
+})
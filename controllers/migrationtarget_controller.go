@@ -0,0 +1,167 @@
+/*
+Copyright 2023 thehamdiaz.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+
+	"github.com/thehamdiaz/first-controller.git/agent"
+	apiv1 "github.com/thehamdiaz/first-controller.git/api/v1"
+)
+
+const (
+	// targetCheckInterval is how often the reachability of a MigrationTarget is checked
+	targetCheckInterval = time.Minute
+	// targetCheckTimeout bounds the call to the node agent of the destination node
+	targetCheckTimeout = 10 * time.Second
+)
+
+// MigrationTargetReconciler validates the MigrationTargets and checks that their destination node is reachable
+type MigrationTargetReconciler struct {
+	client.Client
+	Scheme *runtime.Scheme
+	// Agents reaches the node agent of the destination nodes
+	Agents *NodeAgents
+	// Remotes reaches the destination clusters
+	Remotes *RemoteClusters
+}
+
+//+kubebuilder:rbac:groups=api.k8s.zfs-volume-migrator.io,resources=migrationtargets,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=api.k8s.zfs-volume-migrator.io,resources=migrationtargets/status,verbs=get;update;patch
+//+kubebuilder:rbac:groups=api.k8s.zfs-volume-migrator.io,resources=migrationtargets/finalizers,verbs=update
+//+kubebuilder:rbac:groups="",resources=nodes,verbs=get;list;watch
+//+kubebuilder:rbac:groups="",resources=secrets,verbs=get;list;watch
+
+// Reconcile records whether the MigrationTarget is valid and reachable in its conditions,
+// and checks it again every targetCheckInterval.
+func (r *MigrationTargetReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	l := log.FromContext(ctx)
+
+	target := &apiv1.MigrationTarget{}
+	if err := r.Get(ctx, req.NamespacedName, target); err != nil {
+		if errors.IsNotFound(err) {
+			// Object not found Return and don't requeue
+			return ctrl.Result{}, nil
+		}
+		return ctrl.Result{}, err
+	}
+
+	valid, reachable := r.check(ctx, target)
+	valid.ObservedGeneration = target.Generation
+	reachable.ObservedGeneration = target.Generation
+	meta.SetStatusCondition(&target.Status.Conditions, valid)
+	meta.SetStatusCondition(&target.Status.Conditions, reachable)
+	target.Status.Reachable = reachable.Status == metav1.ConditionTrue
+	now := metav1.Now()
+	target.Status.LastCheckTime = &now
+	if err := r.Status().Update(ctx, target); err != nil {
+		l.Error(err, "failed to update migrationTarget status")
+		return ctrl.Result{}, err
+	}
+
+	return ctrl.Result{RequeueAfter: targetCheckInterval}, nil
+}
+
+// check returns the Valid and Reachable conditions of a MigrationTarget
+func (r *MigrationTargetReconciler) check(ctx context.Context, target *apiv1.MigrationTarget) (metav1.Condition, metav1.Condition) {
+	invalid := func(reason, message string) (metav1.Condition, metav1.Condition) {
+		return metav1.Condition{Type: apiv1.TargetConditionValid, Status: metav1.ConditionFalse, Reason: reason, Message: message},
+			metav1.Condition{Type: apiv1.TargetConditionReachable, Status: metav1.ConditionUnknown, Reason: "Invalid", Message: "the target is invalid"}
+	}
+	unreachable := func(reason, message string) (metav1.Condition, metav1.Condition) {
+		return metav1.Condition{Type: apiv1.TargetConditionValid, Status: metav1.ConditionUnknown, Reason: "Unreachable", Message: "the target is unreachable"},
+			metav1.Condition{Type: apiv1.TargetConditionReachable, Status: metav1.ConditionFalse, Reason: reason, Message: message}
+	}
+
+	spec := target.Spec
+	if spec.DatasetPrefix != "" {
+		if errs := apiv1.DatasetPrefixErrors(spec.DatasetPrefix); len(errs) > 0 {
+			return invalid("InvalidDatasetPrefix", fmt.Sprintf("datasetPrefix %s: %s", spec.DatasetPrefix, strings.Join(errs, ", ")))
+		}
+	}
+	if spec.Transport == apiv1.TransportSSH && (spec.SSH == nil || spec.SSH.User == "" || spec.SSH.HostIP == "") {
+		return invalid("MissingSSH", "the SSH transport requires ssh.user and ssh.hostIP")
+	}
+	if spec.SSH != nil && spec.SSH.CredentialsSecretRef != nil {
+		ref := spec.SSH.CredentialsSecretRef
+		if err := r.Get(ctx, types.NamespacedName{Namespace: ref.Namespace, Name: ref.Name}, &corev1.Secret{}); err != nil {
+			return invalid("CredentialsNotFound", fmt.Sprintf("credentials secret %s/%s: %v", ref.Namespace, ref.Name, err))
+		}
+	}
+
+	destinationClient := client.Client(r.Client)
+	if spec.Cluster != nil {
+		ref := spec.Cluster.KubeconfigSecretRef
+		remote, err := r.Remotes.Client(ctx, r.Client, types.NamespacedName{Namespace: ref.Namespace, Name: ref.Name})
+		if errors.IsNotFound(err) {
+			return invalid("KubeconfigNotFound", fmt.Sprintf("kubeconfig secret %s/%s not found", ref.Namespace, ref.Name))
+		}
+		if err != nil {
+			return invalid("InvalidKubeconfig", err.Error())
+		}
+		destinationClient = remote
+	}
+
+	node := &corev1.Node{}
+	if err := destinationClient.Get(ctx, types.NamespacedName{Name: spec.NodeName}, node); err != nil {
+		if errors.IsNotFound(err) {
+			return invalid("NodeNotFound", fmt.Sprintf("node %s not found", spec.NodeName))
+		}
+		return unreachable("ClusterUnreachable", err.Error())
+	}
+
+	nodeAgent, err := r.Agents.ForNode(ctx, destinationClient, spec.NodeName)
+	if err != nil {
+		return unreachable("AgentUnreachable", err.Error())
+	}
+	checkCtx, cancel := context.WithTimeout(ctx, targetCheckTimeout)
+	defer cancel()
+	if _, err := nodeAgent.List(checkCtx, &agent.ListRequest{Dataset: spec.Pool}); err != nil {
+		if status.Code(err) == codes.NotFound {
+			return invalid("PoolNotFound", fmt.Sprintf("pool %s not found on node %s", spec.Pool, spec.NodeName))
+		}
+		return unreachable("AgentUnreachable", err.Error())
+	}
+
+	return metav1.Condition{Type: apiv1.TargetConditionValid, Status: metav1.ConditionTrue, Reason: "Valid", Message: "the node, pool and secrets exist"},
+		metav1.Condition{Type: apiv1.TargetConditionReachable, Status: metav1.ConditionTrue, Reason: "AgentReachable", Message: "the node agent of the destination node answered"}
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *MigrationTargetReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	// The checks are driven by RequeueAfter, the status updates must not trigger them
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&apiv1.MigrationTarget{}, builder.WithPredicates(predicate.GenerationChangedPredicate{})).
+		Complete(r)
+}
@@ -0,0 +1,80 @@
+/*
+Copyright 2023 thehamdiaz.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+
+	apiv1 "github.com/thehamdiaz/first-controller.git/api/v1"
+)
+
+// listingZFS is a zfs command whose pools and datasets all exist
+const listingZFS = `for dataset; do :; done
+printf '%s\n' "$dataset"
+`
+
+var _ = Describe("MigrationTarget controller", func() {
+	ctx := context.Background()
+
+	BeforeEach(func() {
+		Expect(testAgents.setZFS(listingZFS)).To(Succeed())
+		createNode(ctx, "node-2")
+	})
+
+	// check creates the MigrationTarget with the dataset prefix and returns its Valid condition once reconciled
+	check := func(name, datasetPrefix string) *metav1.Condition {
+		Expect(k8sClient.Create(ctx, &apiv1.MigrationTarget{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Spec:       apiv1.MigrationTargetSpec{NodeName: "node-2", Pool: "pool", DatasetPrefix: datasetPrefix},
+		})).To(Succeed())
+		r := &MigrationTargetReconciler{Client: k8sClient, Scheme: k8sClient.Scheme(), Agents: testAgents.agents}
+		_, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: types.NamespacedName{Name: name}})
+		Expect(err).NotTo(HaveOccurred())
+		target := &apiv1.MigrationTarget{}
+		Expect(k8sClient.Get(ctx, types.NamespacedName{Name: name}, target)).To(Succeed())
+		return meta.FindStatusCondition(target.Status.Conditions, apiv1.TargetConditionValid)
+	}
+
+	It("receives the datasets of the MigrationRequests under the prefix of the target", func() {
+		valid := check("prefixed", "migrated-")
+		Expect(valid.Status).To(Equal(metav1.ConditionTrue), valid.Message)
+
+		r := &MigrationRequestReconciler{Client: k8sClient, Scheme: k8sClient.Scheme(), Agents: testAgents.agents}
+		destination, err := r.resolveDestination(ctx, &apiv1.MigrationRequest{Spec: apiv1.MigrationRequestSpec{
+			TargetName:  "prefixed",
+			Destination: apiv1.DestinationDef{RemoteDataset: "data"},
+		}})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(destination.RemotePool).To(Equal("pool"))
+		Expect(destination.RemoteDataset).To(Equal("migrated-data"))
+		Expect(destination.RemoteHostName).To(Equal("node-2"))
+	})
+
+	It("refuses a prefix making the datasets paths", func() {
+		valid := check("nested", "migrated/")
+		Expect(valid.Status).To(Equal(metav1.ConditionFalse))
+		Expect(valid.Reason).To(Equal("InvalidDatasetPrefix"))
+	})
+})
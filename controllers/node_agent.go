@@ -0,0 +1,60 @@
+/*
+Copyright 2023 thehamdiaz.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/thehamdiaz/first-controller.git/agent"
+)
+
+// NodeAgents connects the controllers to the node agents, which run the ZFS commands on every node
+type NodeAgents struct {
+	Clients *agent.Clients
+	// Port is the port the agents listen on, on the network of their node
+	Port int
+}
+
+// Address returns the address of the node agent of a node
+func (a *NodeAgents) Address(ctx context.Context, c client.Client, nodeName string) (string, error) {
+	node := &corev1.Node{}
+	if err := c.Get(ctx, types.NamespacedName{Name: nodeName}, node); err != nil {
+		return "", err
+	}
+	for _, address := range node.Status.Addresses {
+		if address.Type == corev1.NodeInternalIP {
+			return net.JoinHostPort(address.Address, strconv.Itoa(a.Port)), nil
+		}
+	}
+	return "", fmt.Errorf("node %s has no internal IP", nodeName)
+}
+
+// ForNode returns the client of the node agent of a node
+func (a *NodeAgents) ForNode(ctx context.Context, c client.Client, nodeName string) (*agent.Client, error) {
+	address, err := a.Address(ctx, c, nodeName)
+	if err != nil {
+		return nil, err
+	}
+	return a.Clients.Get(address)
+}
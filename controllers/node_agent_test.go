@@ -0,0 +1,207 @@
+/*
+Copyright 2023 thehamdiaz.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/thehamdiaz/first-controller.git/agent"
+)
+
+// testAgent is a node agent serving on the loopback address with a fake zfs command
+type testAgent struct {
+	dir    string
+	agents *NodeAgents
+}
+
+// writeCertificate writes the certificate of commonName issued by the CA, and the CA, in the layout of a cert-manager Secret
+func writeCertificate(dir, commonName string, usages []x509.ExtKeyUsage, ca *x509.Certificate, caKey *ecdsa.PrivateKey) error {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return err
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: commonName},
+		DNSNames:     []string{commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  usages,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca, &key.PublicKey, caKey)
+	if err != nil {
+		return err
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	files := map[string][]byte{
+		"tls.crt": pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		"tls.key": pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}),
+		"ca.crt":  pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.Raw}),
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), content, 0600); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// startTestAgent serves a node agent on the loopback address until ctx is done. The zfs command it runs is a script
+// of dir, see setZFS, and the returned NodeAgents call it with the certificate of the manager.
+func startTestAgent(ctx context.Context, dir string) (*testAgent, error) {
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "agent-ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}, &x509.Certificate{Subject: pkix.Name{CommonName: "agent-ca"}}, &caKey.PublicKey, caKey)
+	if err != nil {
+		return nil, err
+	}
+	ca, err := x509.ParseCertificate(caDER)
+	if err != nil {
+		return nil, err
+	}
+	agentDir, managerDir := filepath.Join(dir, "agent"), filepath.Join(dir, "manager")
+	if err := writeCertificate(agentDir, agent.AgentIdentity,
+		[]x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth}, ca, caKey); err != nil {
+		return nil, err
+	}
+	if err := writeCertificate(managerDir, agent.ManagerIdentity, []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}, ca, caKey); err != nil {
+		return nil, err
+	}
+	clientCredentials, err := agent.CertDir(managerDir).ClientCredentials()
+	if err != nil {
+		return nil, err
+	}
+
+	// The agent runs zfs from the PATH of the process
+	binDir := filepath.Join(dir, "bin")
+	if err := os.MkdirAll(binDir, 0700); err != nil {
+		return nil, err
+	}
+	if err := os.Setenv("PATH", binDir+string(os.PathListSeparator)+os.Getenv("PATH")); err != nil {
+		return nil, err
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	port := listener.Addr().(*net.TCPAddr).Port
+	listener.Close()
+
+	server := agent.NewServer(logr.Discard())
+	server.TLS = agent.CertDir(agentDir)
+	address := net.JoinHostPort("127.0.0.1", strconv.Itoa(port))
+	go server.Serve(ctx, address) //nolint:errcheck
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+		conn, err := net.Dial("tcp", address)
+		if err == nil {
+			conn.Close()
+			break
+		}
+		if time.Now().After(deadline) {
+			return nil, err
+		}
+	}
+
+	return &testAgent{dir: dir, agents: &NodeAgents{Clients: agent.NewClients(clientCredentials), Port: port}}, nil
+}
+
+// setZFS replaces the zfs command run by the agent with a shell script
+func (a *testAgent) setZFS(script string) error {
+	return os.WriteFile(filepath.Join(a.dir, "bin", "zfs"), []byte("#!/bin/sh\n"+script), 0700)
+}
+
+// testNode returns a node whose agent is the test agent
+func testNode(name string) *corev1.Node {
+	return &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Status: corev1.NodeStatus{Addresses: []corev1.NodeAddress{
+			{Type: corev1.NodeHostName, Address: name},
+			{Type: corev1.NodeInternalIP, Address: "127.0.0.1"},
+		}},
+	}
+}
+
+func TestNodeAgentAddress(t *testing.T) {
+	agents := &NodeAgents{Port: 9550}
+	c := fake.NewClientBuilder().WithObjects(
+		testNode("node-1"),
+		&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node-2"}, Status: corev1.NodeStatus{Addresses: []corev1.NodeAddress{
+			{Type: corev1.NodeInternalIP, Address: "fd00::2"},
+		}}},
+		&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node-3"}, Status: corev1.NodeStatus{Addresses: []corev1.NodeAddress{
+			{Type: corev1.NodeExternalIP, Address: "203.0.113.3"},
+		}}},
+	).Build()
+
+	tests := []struct {
+		node    string
+		want    string
+		wantErr bool
+	}{
+		{node: "node-1", want: "127.0.0.1:9550"},
+		{node: "node-2", want: "[fd00::2]:9550"},
+		{node: "node-3", wantErr: true},
+		{node: "node-4", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.node, func(t *testing.T) {
+			got, err := agents.Address(context.Background(), c, tt.node)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Address() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("Address() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
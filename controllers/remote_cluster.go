@@ -0,0 +1,123 @@
+/*
+Copyright 2023 thehamdiaz.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/clientcmd"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/thehamdiaz/first-controller.git/agent"
+	apiv1 "github.com/thehamdiaz/first-controller.git/api/v1"
+)
+
+// RemoteClusters builds the clients of the clusters reached through a kubeconfig Secret.
+// A client is kept until the Secret it was built from changes.
+type RemoteClusters struct {
+	scheme  *runtime.Scheme
+	mu      sync.Mutex
+	clients map[types.NamespacedName]remoteClient
+}
+
+type remoteClient struct {
+	resourceVersion string
+	client          client.Client
+}
+
+func NewRemoteClusters(scheme *runtime.Scheme) *RemoteClusters {
+	return &RemoteClusters{scheme: scheme, clients: map[types.NamespacedName]remoteClient{}}
+}
+
+// Client returns the client of the cluster whose kubeconfig is stored in the given Secret of the local cluster
+func (rc *RemoteClusters) Client(ctx context.Context, c client.Client, secretKey types.NamespacedName) (client.Client, error) {
+	secret := &corev1.Secret{}
+	if err := c.Get(ctx, secretKey, secret); err != nil {
+		return nil, err
+	}
+
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	if cached, found := rc.clients[secretKey]; found && cached.resourceVersion == secret.ResourceVersion {
+		return cached.client, nil
+	}
+
+	kubeconfig := secret.Data[apiv1.KubeconfigKey]
+	if len(kubeconfig) == 0 {
+		return nil, fmt.Errorf("secret %s has no %s", secretKey, apiv1.KubeconfigKey)
+	}
+	config, err := clientcmd.RESTConfigFromKubeConfig(kubeconfig)
+	if err != nil {
+		return nil, fmt.Errorf("invalid kubeconfig in secret %s: %w", secretKey, err)
+	}
+	remote, err := client.New(config, client.Options{Scheme: rc.scheme})
+	if err != nil {
+		return nil, err
+	}
+	rc.clients[secretKey] = remoteClient{resourceVersion: secret.ResourceVersion, client: remote}
+	return remote, nil
+}
+
+// destinationClient returns the client of the cluster the volume is restored in, the local one unless
+// the destination references a kubeconfig Secret
+func (r *MigrationRequestReconciler) destinationClient(ctx context.Context, migrationRequest *apiv1.MigrationRequest) (client.Client, error) {
+	destination := destinationOf(migrationRequest)
+	if destination.KubeconfigSecretName == "" {
+		return r.Client, nil
+	}
+	return r.Remotes.Client(ctx, r.Client, types.NamespacedName{Namespace: destination.KubeconfigSecretNamespace, Name: destination.KubeconfigSecretName})
+}
+
+// callbackSecret returns the Secret copying the kubeconfig of the source cluster to the destination cluster for a RestoreRequest
+// to report back with, it returns nil when the kubeconfig Secret of the destination has none
+func (r *MigrationRequestReconciler) callbackSecret(ctx context.Context, migrationRequest *apiv1.MigrationRequest, name string) (*corev1.Secret, error) {
+	kubeconfigSecret := &corev1.Secret{}
+	destination := destinationOf(migrationRequest)
+	key := types.NamespacedName{Namespace: destination.KubeconfigSecretNamespace, Name: destination.KubeconfigSecretName}
+	if err := r.Get(ctx, key, kubeconfigSecret); err != nil {
+		return nil, err
+	}
+	sourceKubeconfig := kubeconfigSecret.Data[apiv1.SourceKubeconfigKey]
+	if len(sourceKubeconfig) == 0 {
+		return nil, nil
+	}
+
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: migrationRequest.Namespace,
+		},
+		Type: corev1.SecretTypeOpaque,
+		Data: map[string][]byte{apiv1.KubeconfigKey: sourceKubeconfig},
+	}
+	return secret, nil
+}
+
+// destinationAgent returns the client of the node agent of the destination node
+func (r *MigrationRequestReconciler) destinationAgent(ctx context.Context, migrationRequest *apiv1.MigrationRequest) (*agent.Client, error) {
+	destinationClient, err := r.destinationClient(ctx, migrationRequest)
+	if err != nil {
+		return nil, err
+	}
+	return r.Agents.ForNode(ctx, destinationClient, destinationOf(migrationRequest).RemoteHostName)
+}
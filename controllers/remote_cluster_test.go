@@ -0,0 +1,216 @@
+/*
+Copyright 2023 thehamdiaz.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/envtest"
+
+	apiv1 "github.com/thehamdiaz/first-controller.git/api/v1"
+)
+
+// kubeconfig returns a kubeconfig reaching the API server of config
+func kubeconfig(config *rest.Config) []byte {
+	kubeconfig := clientcmdapi.NewConfig()
+	kubeconfig.Clusters["cluster"] = &clientcmdapi.Cluster{Server: config.Host, CertificateAuthorityData: config.CAData}
+	kubeconfig.AuthInfos["user"] = &clientcmdapi.AuthInfo{
+		ClientCertificateData: config.CertData,
+		ClientKeyData:         config.KeyData,
+		Token:                 config.BearerToken,
+	}
+	kubeconfig.Contexts["context"] = &clientcmdapi.Context{Cluster: "cluster", AuthInfo: "user"}
+	kubeconfig.CurrentContext = "context"
+	data, err := clientcmd.Write(*kubeconfig)
+	Expect(err).NotTo(HaveOccurred())
+	return data
+}
+
+var _ = Describe("Remote clusters", Ordered, func() {
+	const namespace = "cross-cluster"
+	ctx := context.Background()
+	// destinationEnv is a second API server, the destination cluster of the migrations
+	var destinationEnv *envtest.Environment
+	var destinationClient client.Client
+	var secret *corev1.Secret
+
+	BeforeAll(func() {
+		destinationEnv = &envtest.Environment{
+			CRDDirectoryPaths:     []string{filepath.Join("..", "config", "crd", "bases")},
+			ErrorIfCRDPathMissing: true,
+		}
+		destinationConfig, err := destinationEnv.Start()
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(destinationEnv.Stop)
+		destinationClient, err = client.New(destinationConfig, client.Options{Scheme: k8sClient.Scheme()})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(destinationClient.Create(ctx, &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: namespace}})).To(Succeed())
+
+		Expect(k8sClient.Create(ctx, &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: namespace}})).To(Succeed())
+		secret = &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: "destination"},
+			Data: map[string][]byte{
+				apiv1.KubeconfigKey:       kubeconfig(destinationConfig),
+				apiv1.SourceKubeconfigKey: kubeconfig(cfg),
+			},
+		}
+		Expect(k8sClient.Create(ctx, secret)).To(Succeed())
+	})
+
+	It("keeps the client of a kubeconfig Secret until the Secret changes", func() {
+		remotes := NewRemoteClusters(k8sClient.Scheme())
+		key := client.ObjectKeyFromObject(secret)
+		remote, err := remotes.Client(ctx, k8sClient, key)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(remote.Get(ctx, types.NamespacedName{Name: namespace}, &corev1.Namespace{})).To(Succeed())
+
+		cached, err := remotes.Client(ctx, k8sClient, key)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cached).To(BeIdenticalTo(remote))
+
+		By("rebuilding the client once the Secret is updated")
+		secret.Labels = map[string]string{"rotated": "true"}
+		Expect(k8sClient.Update(ctx, secret)).To(Succeed())
+		rebuilt, err := remotes.Client(ctx, k8sClient, key)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(rebuilt).NotTo(BeIdenticalTo(remote))
+
+		By("refusing a Secret without a kubeconfig")
+		Expect(k8sClient.Create(ctx, &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: "empty"},
+		})).To(Succeed())
+		_, err = remotes.Client(ctx, k8sClient, types.NamespacedName{Namespace: namespace, Name: "empty"})
+		Expect(err).To(MatchError(ContainSubstring("has no kubeconfig")))
+	})
+
+	It("restores the volume in the destination cluster", func() {
+		Expect(k8sClient.Create(ctx, &corev1.PersistentVolume{
+			ObjectMeta: metav1.ObjectMeta{Name: "pv-" + namespace},
+			Spec: corev1.PersistentVolumeSpec{
+				StorageClassName:              "zfs",
+				Capacity:                      corev1.ResourceList{corev1.ResourceStorage: resource.MustParse("1Gi")},
+				AccessModes:                   []corev1.PersistentVolumeAccessMode{corev1.ReadWriteOnce},
+				PersistentVolumeReclaimPolicy: corev1.PersistentVolumeReclaimRetain,
+				PersistentVolumeSource: corev1.PersistentVolumeSource{
+					CSI: &corev1.CSIPersistentVolumeSource{Driver: zfsCSIDriver, VolumeHandle: "pvc-data"},
+				},
+			},
+		})).To(Succeed())
+		Expect(k8sClient.Create(ctx, &corev1.PersistentVolumeClaim{
+			ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: "data"},
+			Spec: corev1.PersistentVolumeClaimSpec{
+				VolumeName:  "pv-" + namespace,
+				AccessModes: []corev1.PersistentVolumeAccessMode{corev1.ReadWriteOnce},
+				Resources: corev1.ResourceRequirements{
+					Requests: corev1.ResourceList{corev1.ResourceStorage: resource.MustParse("1Gi")},
+				},
+			},
+		})).To(Succeed())
+
+		key := types.NamespacedName{Namespace: namespace, Name: "cross-cluster"}
+		migrationRequest := &apiv1.MigrationRequest{
+			ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: key.Name},
+			Spec: apiv1.MigrationRequestSpec{
+				PodName:              "db",
+				DesiredSnapshotCount: 2,
+				Destination: apiv1.DestinationDef{
+					RemotePool:           "pool",
+					RemoteDataset:        "cross-cluster-data",
+					RemoteHostName:       "node-2",
+					KubeconfigSecretName: secret.Name,
+				},
+			},
+		}
+		Expect(k8sClient.Create(ctx, migrationRequest)).To(Succeed())
+		migrationRequest.Status.Phase = apiv1.MigrationPhaseRestoring
+		migrationRequest.Status.Source = &apiv1.SourceResources{
+			NodeName: "node-1",
+			Pod: &corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: "db", Labels: map[string]string{"app": "db"}},
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{{Name: "db", Image: "postgres"}},
+					Volumes: []corev1.Volume{{Name: "data", VolumeSource: corev1.VolumeSource{
+						PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{ClaimName: "data"},
+					}}},
+				},
+			},
+		}
+		migrationRequest.Status.Volumes = []apiv1.MigratedVolume{{
+			Name:                      "data",
+			PersistentVolumeClaimName: "data",
+			PersistentVolumeName:      "pv-" + namespace,
+			PoolName:                  "pool",
+			RestoredClaimName:         "restored-data",
+			RemoteDataset:             "cross-cluster-data",
+		}}
+		Expect(k8sClient.Status().Update(ctx, migrationRequest)).To(Succeed())
+
+		reconcile := func() *apiv1.MigrationRequest {
+			r := &MigrationRequestReconciler{Client: k8sClient, Scheme: k8sClient.Scheme(), Agents: testAgents.agents,
+				Remotes: NewRemoteClusters(k8sClient.Scheme())}
+			_, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key})
+			Expect(err).NotTo(HaveOccurred())
+			migrationRequest := &apiv1.MigrationRequest{}
+			Expect(k8sClient.Get(ctx, key, migrationRequest)).To(Succeed())
+			return migrationRequest
+		}
+
+		By("creating the RestoreRequest and the migrated pod in the destination cluster")
+		migrationRequest = reconcile()
+		Expect(migrationRequest.Status.Phase).To(Equal(apiv1.MigrationPhaseRestoring))
+		restoreKey := types.NamespacedName{Namespace: namespace, Name: migrationRequest.Status.Volumes[0].RestoreRequestName}
+		restoreRequest := &apiv1.RestoreRequest{}
+		Expect(destinationClient.Get(ctx, restoreKey, restoreRequest)).To(Succeed())
+		Expect(restoreRequest.Spec.Names.ZFSDatasetName).To(Equal("cross-cluster-data"))
+		Expect(restoreRequest.Spec.Source).NotTo(BeNil())
+		Expect(restoreRequest.Spec.Source.Namespace).To(Equal(namespace))
+		Expect(destinationClient.Get(ctx, types.NamespacedName{Namespace: namespace, Name: "migrated-pod-db"}, &corev1.Pod{})).To(Succeed())
+		err := k8sClient.Get(ctx, restoreKey, &apiv1.RestoreRequest{})
+		Expect(errors.IsNotFound(err)).To(BeTrue())
+
+		By("giving the destination cluster the kubeconfig of the source cluster")
+		callbackSecret := &corev1.Secret{}
+		Expect(destinationClient.Get(ctx, types.NamespacedName{Namespace: namespace, Name: restoreRequest.Spec.Source.KubeconfigSecretName}, callbackSecret)).To(Succeed())
+		Expect(callbackSecret.Data[apiv1.KubeconfigKey]).To(Equal(secret.Data[apiv1.SourceKubeconfigKey]))
+
+		By("completing once the RestoreRequest of the destination cluster succeeded")
+		Expect(reconcile().Status.Phase).To(Equal(apiv1.MigrationPhaseRestoring))
+		meta.SetStatusCondition(&restoreRequest.Status.Conditions, metav1.Condition{
+			Type: apiv1.RestoreConditionRestored, Status: metav1.ConditionTrue, Reason: apiv1.ReasonRestored,
+		})
+		Expect(destinationClient.Status().Update(ctx, restoreRequest)).To(Succeed())
+		migrationRequest = reconcile()
+		Expect(migrationRequest.Status.Phase).To(Equal(apiv1.MigrationPhaseCompleted))
+		Expect(meta.IsStatusConditionTrue(migrationRequest.Status.Conditions, apiv1.MigrationConditionRestored)).To(BeTrue())
+		Expect(meta.IsStatusConditionTrue(migrationRequest.Status.Conditions, apiv1.MigrationConditionCompleted)).To(BeTrue())
+	})
+})
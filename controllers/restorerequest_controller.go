@@ -19,18 +19,15 @@ package controllers
 import (
 	"context"
 	"fmt"
-	"time"
 
 	openebszfsv1 "github.com/openebs/zfs-localpv/pkg/apis/openebs.io/zfs/v1"
+	"github.com/thehamdiaz/first-controller.git/agent"
 	apiv1 "github.com/thehamdiaz/first-controller.git/api/v1"
-	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
-	"k8s.io/apimachinery/pkg/util/wait"
-
-	"sync"
 
 	"k8s.io/apimachinery/pkg/runtime"
 	ctrl "sigs.k8s.io/controller-runtime"
@@ -42,11 +39,20 @@ import (
 type RestoreRequestReconciler struct {
 	client.Client
 	Scheme *runtime.Scheme
+	// Agents prepares the received dataset on the target node
+	Agents *NodeAgents
+	// Remotes reaches the source clusters of the cross-cluster migrations
+	Remotes *RemoteClusters
 }
 
 //+kubebuilder:rbac:groups=api.k8s.zfs-volume-migrator.io,resources=restorerequests,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=api.k8s.zfs-volume-migrator.io,resources=restorerequests/status,verbs=get;update;patch
 //+kubebuilder:rbac:groups=api.k8s.zfs-volume-migrator.io,resources=restorerequests/finalizers,verbs=update
+//+kubebuilder:rbac:groups=api.k8s.zfs-volume-migrator.io,resources=migrationrequests/status,verbs=get;update;patch
+//+kubebuilder:rbac:groups="",resources=persistentvolumes,verbs=get;list;watch;create
+//+kubebuilder:rbac:groups="",resources=persistentvolumeclaims,verbs=get;list;watch;create
+//+kubebuilder:rbac:groups="",resources=nodes,verbs=get;list;watch
+//+kubebuilder:rbac:groups=zfs.openebs.io,resources=zfsvolumes,verbs=get;list;watch;create
 
 // Reconcile is part of the main kubernetes reconciliation loop which aims to
 // move the current state of the cluster closer to the desired state.
@@ -73,79 +79,69 @@ func (r *RestoreRequestReconciler) Reconcile(ctx context.Context, req ctrl.Reque
 	}
 
 	// Check if the RestoreRequest is already completed
-	if restoreReq.Status.Succeeded == "True" {
+	if meta.IsStatusConditionTrue(restoreReq.Status.Conditions, apiv1.RestoreConditionRestored) {
 		log.Info("RestoreRequest is already completed")
 		return ctrl.Result{}, nil
 	}
 
-	// create configmap
-	config, err := r.createConfigMapRestoreObject(ctx, restoreReq)
-	if err != nil {
-		log.Error(err, "unable to create the ConfigMap")
-		return ctrl.Result{}, err
-	}
-
 	//change mount point of the dataset to legacy
-	err = r.CreateLegacyDatasetJob(ctx, restoreReq, config)
+	err := r.setLegacyMountpoint(ctx, restoreReq)
 	if err != nil {
 		log.Error(err, "unable to set mount point to legacy")
-		return ctrl.Result{}, err
+		setRestoreCondition(restoreReq, apiv1.RestoreConditionDatasetReady, metav1.ConditionFalse, apiv1.ReasonMountpointFailed, err.Error())
+		return r.restoreFailed(ctx, restoreReq, err, fmt.Sprintf("Failed to set the mountpoint to legacy: %v", err))
 	}
+	setRestoreCondition(restoreReq, apiv1.RestoreConditionDatasetReady, metav1.ConditionTrue, apiv1.ReasonDatasetReady, "the mountpoint of the dataset is legacy")
 
 	// Create PV
 	err = r.createPV(ctx, restoreReq)
 	if err != nil {
-		restoreReq.Status.Succeeded = "False"
-		restoreReq.Status.Message = fmt.Sprintf("Failed to create PV: %v", err)
-		if updateErr := r.Status().Update(ctx, restoreReq); updateErr != nil {
-			log.Error(updateErr, "Failed to update RestoreRequest status")
-			return ctrl.Result{}, updateErr
-		}
-		return ctrl.Result{}, err
+		setRestoreCondition(restoreReq, apiv1.RestoreConditionRestored, metav1.ConditionFalse, apiv1.ReasonPersistentVolumeFailed, err.Error())
+		return r.restoreFailed(ctx, restoreReq, err, fmt.Sprintf("Failed to create PV: %v", err))
 	}
 
 	// Create PVC
 	err = r.createPVC(ctx, restoreReq)
 	if err != nil {
-		restoreReq.Status.Succeeded = "False"
-		restoreReq.Status.Message = fmt.Sprintf("Failed to create PVC: %v", err)
-		if updateErr := r.Status().Update(ctx, restoreReq); updateErr != nil {
-			log.Error(updateErr, "Failed to update RestoreRequest status")
-			return ctrl.Result{}, updateErr
-		}
-		return ctrl.Result{}, err
+		setRestoreCondition(restoreReq, apiv1.RestoreConditionRestored, metav1.ConditionFalse, apiv1.ReasonPersistentVolumeClaimFailed, err.Error())
+		return r.restoreFailed(ctx, restoreReq, err, fmt.Sprintf("Failed to create PVC: %v", err))
 	}
 
 	// Create ZFSVolume
 	err = r.createZFSVolume(ctx, restoreReq)
 	if err != nil {
-		restoreReq.Status.Succeeded = "False"
-		restoreReq.Status.Message = fmt.Sprintf("Failed to create ZFSVolume: %v", err)
-		if updateErr := r.Status().Update(ctx, restoreReq); updateErr != nil {
-			log.Error(updateErr, "Failed to update RestoreRequest status")
-			return ctrl.Result{}, updateErr
-		}
+		setRestoreCondition(restoreReq, apiv1.RestoreConditionRestored, metav1.ConditionFalse, apiv1.ReasonZFSVolumeFailed, err.Error())
+		return r.restoreFailed(ctx, restoreReq, err, fmt.Sprintf("Failed to create ZFSVolume: %v", err))
+	}
+
+	// Update the MigrationRequest first, the RestoreRequest isn't reconciled again once it is restored
+	if err := r.updateMigrationRequestStatus(ctx, restoreReq); err != nil {
+		log.Error(err, "Failed to update migrationRequest status")
 		return ctrl.Result{}, err
 	}
 
 	// Update RestoreRequest status
-	restoreReq.Status.Succeeded = "True"
+	setRestoreCondition(restoreReq, apiv1.RestoreConditionRestored, metav1.ConditionTrue, apiv1.ReasonRestored, "the volume is restored")
 	restoreReq.Status.Message = "RestoreRequest completed successfully"
 	if err := r.Status().Update(ctx, restoreReq); err != nil {
 		log.Error(err, "Failed to update RestoreRequest status")
 		return ctrl.Result{}, err
 	}
 
-	// Update migrationRequest object status in the source cluster
-	if err := r.updateMigrationRequestStatus(ctx, restoreReq); err != nil {
-		log.Error(err, "Failed to update migrationRequest status")
-		return ctrl.Result{}, err
-	}
-
 	log.Info("RestoreRequest reconciliation completed")
 	return ctrl.Result{}, nil
 }
 
+// restoreFailed records the failure of a restore step, the step is retried
+func (r *RestoreRequestReconciler) restoreFailed(ctx context.Context, restoreReq *apiv1.RestoreRequest, cause error, message string) (ctrl.Result, error) {
+	restoreReq.Status.Message = message
+	if updateErr := r.Status().Update(ctx, restoreReq); updateErr != nil {
+		log.FromContext(ctx).Error(updateErr, "Failed to update RestoreRequest status")
+		return ctrl.Result{}, updateErr
+	}
+	return ctrl.Result{}, cause
+}
+
 func (r *RestoreRequestReconciler) createPV(ctx context.Context, restoreRequest *apiv1.RestoreRequest) error {
 	pv := &corev1.PersistentVolume{
 		ObjectMeta: metav1.ObjectMeta{
@@ -162,7 +158,7 @@ func (r *RestoreRequestReconciler) createPV(ctx context.Context, restoreRequest
 				APIVersion: "v1",
 				Kind:       "PersistentVolumeClaim",
 				Name:       restoreRequest.Spec.Names.PVCName,
-				Namespace:  "default",
+				Namespace:  restoreRequest.ClaimNamespace(),
 			},
 			PersistentVolumeSource: corev1.PersistentVolumeSource{
 				CSI: &corev1.CSIPersistentVolumeSource{
@@ -200,7 +196,7 @@ func (r *RestoreRequestReconciler) createPV(ctx context.Context, restoreRequest
 	}
 
 	// Create the PV
-	if err := r.Create(ctx, pv); err != nil {
+	if err := r.Create(ctx, pv); err != nil && !errors.IsAlreadyExists(err) {
 		return fmt.Errorf("failed to create PV: %v", err)
 	}
 
@@ -212,10 +208,13 @@ func (r *RestoreRequestReconciler) createPVC(ctx context.Context, restoreRequest
 	pvc := &corev1.PersistentVolumeClaim{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      restoreRequest.Spec.Names.PVCName,
-			Namespace: "default",
+			Namespace: restoreRequest.ClaimNamespace(),
+			// The claim may take the name of a source claim locked by the migration
+			Annotations: map[string]string{apiv1.MigrationRequestAnnotation: restoreRequest.Spec.Names.MigrationRequestName},
 		},
 		Spec: corev1.PersistentVolumeClaimSpec{
 			StorageClassName: &restoreRequest.Spec.Names.StorageClassName,
+			VolumeName:       restoreRequest.Spec.Names.PVName,
 			AccessModes:      make([]corev1.PersistentVolumeAccessMode, len(restoreRequest.Spec.Parameters.AccessModes)),
 			Resources: corev1.ResourceRequirements{
 				Requests: corev1.ResourceList{
@@ -230,8 +229,16 @@ func (r *RestoreRequestReconciler) createPVC(ctx context.Context, restoreRequest
 		pvc.Spec.AccessModes[i] = mode
 	}
 
-	// Create the PVC
-	if err := r.Create(ctx, pvc); err != nil {
+	// Create the PVC, an existing one must be bound to the restored PV and not to a volume provisioned for it
+	err := r.Create(ctx, pvc)
+	if errors.IsAlreadyExists(err) {
+		if err := r.Get(ctx, client.ObjectKeyFromObject(pvc), pvc); err != nil {
+			return fmt.Errorf("failed to get PVC: %v", err)
+		}
+		if pvc.Spec.VolumeName != restoreRequest.Spec.Names.PVName {
+			return fmt.Errorf("PVC %s already exists and isn't bound to PV %s", pvc.Name, restoreRequest.Spec.Names.PVName)
+		}
+	} else if err != nil {
 		return fmt.Errorf("failed to create PVC: %v", err)
 	}
 
@@ -266,7 +273,7 @@ func (r *RestoreRequestReconciler) createZFSVolume(ctx context.Context, restoreR
 	}
 
 	// Create the ZFSVolume object
-	if err := r.Create(ctx, zfsVolume); err != nil {
+	if err := r.Create(ctx, zfsVolume); err != nil && !errors.IsAlreadyExists(err) {
 		return fmt.Errorf("failed to create ZFSVolume: %v", err)
 	}
 
@@ -276,18 +283,51 @@ func (r *RestoreRequestReconciler) createZFSVolume(ctx context.Context, restoreR
 
 func (r *RestoreRequestReconciler) updateMigrationRequestStatus(ctx context.Context, restoreRequest *apiv1.RestoreRequest) error {
 	migrationRequestName := restoreRequest.Spec.Names.MigrationRequestName
+	sourceClient := client.Client(r.Client)
+	namespace := restoreRequest.Namespace
+	if source := restoreRequest.Spec.Source; source != nil {
+		if source.KubeconfigSecretName == "" {
+			// The MigrationRequest of the other cluster polls the RestoreRequest
+			return nil
+		}
+		var err error
+		sourceClient, err = r.Remotes.Client(ctx, r.Client, types.NamespacedName{Namespace: restoreRequest.Namespace, Name: source.KubeconfigSecretName})
+		if err != nil {
+			return err
+		}
+		namespace = source.Namespace
+	}
 
 	// Fetch the associated MigrationRequest object
 	migrationRequest := &apiv1.MigrationRequest{}
-	err := r.Get(ctx, types.NamespacedName{Name: migrationRequestName, Namespace: restoreRequest.Namespace}, migrationRequest)
+	err := sourceClient.Get(ctx, types.NamespacedName{Name: migrationRequestName, Namespace: namespace}, migrationRequest)
 	if err != nil {
 		return err
 	}
 
+	// The last RestoreRequest of the migration to complete reports it, the MigrationRequest polls its RestoreRequests
+	// in case several complete at the same time
+	for _, volume := range migrationRequest.Status.Volumes {
+		if volume.RestoreRequestName == restoreRequest.Name {
+			continue
+		}
+		if volume.RestoreRequestName == "" {
+			return nil
+		}
+		other := &apiv1.RestoreRequest{}
+		if err := r.Get(ctx, types.NamespacedName{Namespace: restoreRequest.Namespace, Name: volume.RestoreRequestName}, other); err != nil {
+			return err
+		}
+		if !meta.IsStatusConditionTrue(other.Status.Conditions, apiv1.RestoreConditionRestored) {
+			return nil
+		}
+	}
+
 	// Update the MigrationRequest Status
-	migrationRequest.Status.RestorationCompleted = "True"
+	setMigrationCondition(migrationRequest, apiv1.MigrationConditionRestored, metav1.ConditionTrue, apiv1.ReasonRestored,
+		fmt.Sprintf("the RestoreRequests restored %d volumes", len(migrationRequest.Status.Volumes)))
 
-	err = r.Status().Update(ctx, migrationRequest)
+	err = sourceClient.Status().Update(ctx, migrationRequest)
 	if err != nil {
 		return err
 	}
@@ -295,116 +335,22 @@ func (r *RestoreRequestReconciler) updateMigrationRequestStatus(ctx context.Cont
 	return nil
 }
 
-func (r *RestoreRequestReconciler) CreateLegacyDatasetJob(ctx context.Context, restoreRequest *apiv1.RestoreRequest, config *corev1.ConfigMap) error {
-	job := &batchv1.Job{
-		ObjectMeta: metav1.ObjectMeta{
-			Name:      "legacy-dataset-" + restoreRequest.Spec.Names.ZFSDatasetName,
-			Namespace: restoreRequest.Namespace,
-		},
-		Spec: batchv1.JobSpec{
-			Template: corev1.PodTemplateSpec{
-				Spec: corev1.PodSpec{
-					Containers: []corev1.Container{
-						{
-							Name:  "zfs-container",
-							Image: "thehamdiaz/zfs-make-legacy-ubuntu:v1.0",
-							SecurityContext: &corev1.SecurityContext{
-								Privileged: func() *bool { b := true; return &b }(),
-							},
-							EnvFrom: []corev1.EnvFromSource{
-								{
-									ConfigMapRef: &corev1.ConfigMapEnvSource{
-										LocalObjectReference: corev1.LocalObjectReference{
-											Name: config.Name,
-										},
-									},
-								},
-							},
-						},
-					},
-					RestartPolicy: "Never",
-					Affinity: &corev1.Affinity{
-						NodeAffinity: &corev1.NodeAffinity{
-							RequiredDuringSchedulingIgnoredDuringExecution: &corev1.NodeSelector{
-								NodeSelectorTerms: []corev1.NodeSelectorTerm{
-									{
-										MatchExpressions: []corev1.NodeSelectorRequirement{
-											{
-												Key:      "kubernetes.io/hostname",
-												Operator: corev1.NodeSelectorOpIn,
-												Values:   []string{restoreRequest.Spec.Names.TargetNodeName},
-											},
-										},
-									},
-								},
-							},
-						},
-					},
-				},
-			},
-		},
+// setLegacyMountpoint has the node agent of the target node set the mountpoint of the received dataset to legacy,
+// so that the dataset is mounted by the ZFS CSI driver instead of by ZFS itself
+func (r *RestoreRequestReconciler) setLegacyMountpoint(ctx context.Context, restoreRequest *apiv1.RestoreRequest) error {
+	targetAgent, err := r.Agents.ForNode(ctx, r.Client, restoreRequest.Spec.Names.TargetNodeName)
+	if err != nil {
+		return err
 	}
 
-	// Create the Job
-	createCompleted := make(chan error, 1)
-
-	var wg sync.WaitGroup
-	wg.Add(1)
-
-	go func() {
-		defer wg.Done()
-		err := r.Create(ctx, job)
-		createCompleted <- err
-	}()
-
-	// Wait for the createResource function to complete
-	wg.Wait()
-
-	// Wait for the Job to finish
-	jobKey := types.NamespacedName{Name: job.Name, Namespace: job.Namespace}
-	err := wait.PollImmediate(time.Second, time.Minute*5, func() (bool, error) {
-		if err := r.Get(ctx, jobKey, job); err != nil {
-			return false, err
-		}
-
-		if job.Status.CompletionTime != nil {
-			if job.Status.Succeeded > 0 {
-				return true, nil
-			}
-			return false, fmt.Errorf("job failed: %s", job.Status.String())
-		}
-
-		return false, nil
+	_, err = targetAgent.SetProperty(ctx, &agent.SetPropertyRequest{
+		Dataset:  restoreRequest.Spec.Names.ZFSPoolName + "/" + restoreRequest.Spec.Names.ZFSDatasetName,
+		Property: "mountpoint",
+		Value:    "legacy",
 	})
-
 	return err
 }
 
-func (r *RestoreRequestReconciler) createConfigMapRestoreObject(ctx context.Context, restoreRequest *apiv1.RestoreRequest) (*corev1.ConfigMap, error) {
-	configMap := &corev1.ConfigMap{
-		TypeMeta: metav1.TypeMeta{
-			APIVersion: "v1",
-			Kind:       "ConfigMap",
-		},
-		ObjectMeta: metav1.ObjectMeta{
-			GenerateName: "legacy-dataset-config-",
-			Namespace:    "default",
-		},
-		Data: map[string]string{
-			"POOLNAME":    restoreRequest.Spec.Names.ZFSPoolName,
-			"DATASETNAME": restoreRequest.Spec.Names.ZFSDatasetName,
-		},
-	}
-
-	err := r.Create(ctx, configMap)
-	if err != nil {
-		// Handle the error
-		return nil, err
-	}
-
-	return configMap, nil
-}
-
 // SetupWithManager sets up the controller with the Manager.
 func (r *RestoreRequestReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	return ctrl.NewControllerManagedBy(mgr).
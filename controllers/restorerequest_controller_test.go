@@ -0,0 +1,120 @@
+/*
+Copyright 2023 thehamdiaz.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	openebszfsv1 "github.com/openebs/zfs-localpv/pkg/apis/openebs.io/zfs/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+
+	apiv1 "github.com/thehamdiaz/first-controller.git/api/v1"
+)
+
+var _ = Describe("RestoreRequest controller", func() {
+	const namespace = "team-a"
+	ctx := context.Background()
+	key := types.NamespacedName{Namespace: namespace, Name: "restore-migration-data"}
+
+	BeforeEach(func() {
+		Expect(testAgents.setZFS(receivingZFS)).To(Succeed())
+		createIgnoringExisting(ctx, &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "openebs"}})
+		createNode(ctx, "node-2")
+		Expect(k8sClient.Create(ctx, &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: namespace}})).To(Succeed())
+
+		// The dataset was received by the migration
+		received := filepath.Join(testAgents.dir, "bin", "received")
+		Expect(os.MkdirAll(received, 0700)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(received, "pool_team-a-data"), []byte("stream"), 0600)).To(Succeed())
+
+		migrationRequest := &apiv1.MigrationRequest{
+			ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: "migration"},
+			Spec: apiv1.MigrationRequestSpec{
+				PodName:              "db",
+				DesiredSnapshotCount: 2,
+				Destination: apiv1.DestinationDef{
+					RemotePool:     "pool",
+					RemoteDataset:  "team-a-data",
+					RemoteHostName: "node-2",
+				},
+			},
+		}
+		Expect(k8sClient.Create(ctx, migrationRequest)).To(Succeed())
+		migrationRequest.Status.Phase = apiv1.MigrationPhaseRestoring
+		migrationRequest.Status.Volumes = []apiv1.MigratedVolume{{
+			Name:                      "data",
+			PersistentVolumeClaimName: "data",
+			PersistentVolumeName:      "pv-team-a-data",
+			RemoteDataset:             "team-a-data",
+			RestoredClaimName:         "restored-data",
+			RestoreRequestName:        key.Name,
+		}}
+		Expect(k8sClient.Status().Update(ctx, migrationRequest)).To(Succeed())
+
+		Expect(k8sClient.Create(ctx, &apiv1.RestoreRequest{
+			ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: key.Name},
+			Spec: apiv1.RestoreRequestSpec{
+				Names: apiv1.Names{
+					MigrationRequestName: migrationRequest.Name,
+					StorageClassName:     "zfs",
+					PVName:               "restored-pv-team-a-data",
+					PVCName:              "restored-data",
+					ZFSDatasetName:       "team-a-data",
+					ZFSPoolName:          "pool",
+					TargetNodeName:       "node-2",
+				},
+				Parameters: apiv1.Parameters{
+					Capacity:      resource.MustParse("1Gi"),
+					AccessModes:   []corev1.PersistentVolumeAccessMode{corev1.ReadWriteOnce},
+					ReclaimPolicy: corev1.PersistentVolumeReclaimRetain,
+				},
+			},
+		})).To(Succeed())
+	})
+
+	It("restores the claim in the namespace of the RestoreRequest", func() {
+		r := &RestoreRequestReconciler{Client: k8sClient, Scheme: k8sClient.Scheme(), Agents: testAgents.agents}
+		_, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key})
+		Expect(err).NotTo(HaveOccurred())
+
+		restoreRequest := &apiv1.RestoreRequest{}
+		Expect(k8sClient.Get(ctx, key, restoreRequest)).To(Succeed())
+		Expect(meta.IsStatusConditionTrue(restoreRequest.Status.Conditions, apiv1.RestoreConditionRestored)).To(BeTrue(), restoreRequest.Status.Message)
+
+		pv := &corev1.PersistentVolume{}
+		Expect(k8sClient.Get(ctx, types.NamespacedName{Name: "restored-pv-team-a-data"}, pv)).To(Succeed())
+		Expect(pv.Spec.ClaimRef.Namespace).To(Equal(namespace))
+		pvc := &corev1.PersistentVolumeClaim{}
+		Expect(k8sClient.Get(ctx, types.NamespacedName{Namespace: namespace, Name: "restored-data"}, pvc)).To(Succeed())
+		Expect(pvc.Spec.VolumeName).To(Equal(pv.Name))
+		Expect(k8sClient.Get(ctx, types.NamespacedName{Namespace: "openebs", Name: "team-a-data"}, &openebszfsv1.ZFSVolume{})).To(Succeed())
+
+		migrationRequest := &apiv1.MigrationRequest{}
+		Expect(k8sClient.Get(ctx, types.NamespacedName{Namespace: namespace, Name: "migration"}, migrationRequest)).To(Succeed())
+		Expect(meta.IsStatusConditionTrue(migrationRequest.Status.Conditions, apiv1.MigrationConditionRestored)).To(BeTrue())
+	})
+})
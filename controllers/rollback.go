@@ -0,0 +1,189 @@
+/*
+Copyright 2023 thehamdiaz.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	"github.com/thehamdiaz/first-controller.git/agent"
+	apiv1 "github.com/thehamdiaz/first-controller.git/api/v1"
+)
+
+// abortMigration moves an aborted migration to the Aborting phase, recording where it was aborted
+func (r *MigrationRequestReconciler) abortMigration(ctx context.Context, migrationRequest *apiv1.MigrationRequest) (ctrl.Result, error) {
+	log.FromContext(ctx).Info("migration aborted, rolling back", "phase", migrationRequest.Status.Phase)
+	now := metav1.Now()
+	migrationRequest.Status.Rollback = &apiv1.RollbackStatus{FromPhase: migrationRequest.Status.Phase, StartTime: &now}
+	migrationRequest.Status.Progress = nil
+	setMigrationCondition(migrationRequest, apiv1.MigrationConditionAborted, metav1.ConditionFalse, apiv1.ReasonRollingBack, "rolling back the migration")
+	return r.setPhase(ctx, migrationRequest, apiv1.MigrationPhaseAborting)
+}
+
+// reconcileAborting rolls back an aborted migration and moves it to the Aborted phase
+func (r *MigrationRequestReconciler) reconcileAborting(ctx context.Context, migrationRequest *apiv1.MigrationRequest) (ctrl.Result, error) {
+	l := log.FromContext(ctx)
+
+	done, err := r.rollBack(ctx, migrationRequest)
+	if err != nil {
+		l.Error(err, "failed to roll back the migration")
+		return ctrl.Result{}, err
+	}
+	if !done {
+		return ctrl.Result{RequeueAfter: requeueInterval}, nil
+	}
+
+	now := metav1.Now()
+	migrationRequest.Status.Rollback.CompletionTime = &now
+	message := fmt.Sprintf("the migration was aborted in the %s phase and rolled back", migrationRequest.Status.Rollback.FromPhase)
+	migrationRequest.Status.Message = message
+	setMigrationCondition(migrationRequest, apiv1.MigrationConditionAborted, metav1.ConditionTrue, apiv1.ReasonRolledBack, message)
+	setMigrationCondition(migrationRequest, apiv1.MigrationConditionCompleted, metav1.ConditionFalse, apiv1.ReasonAborted, message)
+	return r.setPhase(ctx, migrationRequest, apiv1.MigrationPhaseAborted)
+}
+
+// rollBack stops the running send, destroys what the destination received and recreates the source pod if it was stopped.
+// Each step is recorded in the rollback status, it returns false while the source pod is still terminating.
+func (r *MigrationRequestReconciler) rollBack(ctx context.Context, migrationRequest *apiv1.MigrationRequest) (bool, error) {
+	if current := migrationRequest.Status.CurrentSnapshot; current != nil && current.Quiescing {
+		// Don't leave the application quiesced, a failing post-snapshot hook doesn't hold the rollback
+		if err := r.runPostSnapshotHooks(ctx, migrationRequest); err != nil {
+			log.FromContext(ctx).Error(err, "failed to run the post-snapshot hooks")
+			setMigrationCondition(migrationRequest, apiv1.MigrationConditionQuiesced, metav1.ConditionFalse, apiv1.ReasonHookFailed, err.Error())
+		}
+		if err := r.Status().Update(ctx, migrationRequest); err != nil {
+			return false, err
+		}
+	}
+
+	if !migrationRequest.Status.Rollback.SendCanceled {
+		if err := r.cancelSend(ctx, migrationRequest); err != nil {
+			return false, err
+		}
+		migrationRequest.Status.Rollback.SendCanceled = true
+		if err := r.Status().Update(ctx, migrationRequest); err != nil {
+			return false, err
+		}
+	}
+
+	if !migrationRequest.Status.Rollback.DestinationCleaned {
+		if err := r.cleanupDestination(ctx, migrationRequest); err != nil {
+			return false, err
+		}
+		migrationRequest.Status.Rollback.DestinationCleaned = true
+		if err := r.Status().Update(ctx, migrationRequest); err != nil {
+			return false, err
+		}
+	}
+
+	if migrationRequest.Status.Rollback.RecreatedPod == "" {
+		recreated, done, err := r.recreateSourcePod(ctx, migrationRequest)
+		if err != nil || !done {
+			return false, err
+		}
+		if recreated != "" {
+			migrationRequest.Status.Rollback.RecreatedPod = recreated
+			if err := r.Status().Update(ctx, migrationRequest); err != nil {
+				return false, err
+			}
+		}
+	}
+	return true, nil
+}
+
+// cancelSend stops the send of the current snapshot on the source node, if one is running
+func (r *MigrationRequestReconciler) cancelSend(ctx context.Context, migrationRequest *apiv1.MigrationRequest) error {
+	current := migrationRequest.Status.CurrentSnapshot
+	if migrationRequest.Status.Source == nil || current == nil || len(current.Handles) == 0 || current.SentVolumes >= len(current.Handles) {
+		// Nothing is being sent
+		return nil
+	}
+
+	sourceAgent, err := r.Agents.ForNode(ctx, r.Client, migrationRequest.Status.Source.NodeName)
+	if errors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	sendStatus, err := sourceAgent.CancelSend(ctx, &agent.CancelSendRequest{ID: sendID(migrationRequest)})
+	if status.Code(err) == codes.NotFound {
+		// The send never started, or the agent restarted and stopped it
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	log.FromContext(ctx).Info("send canceled", "send", sendStatus.ID, "state", sendStatus.State)
+	return nil
+}
+
+// recreateSourcePod recreates the source pod stopped for the cutover on the source node, with its original volumes.
+// A pod with a controller but without the workload in the spec isn't recreated, its controller already replaced it.
+// It returns the name of the recreated pod, empty when the pod wasn't stopped, and false while the stopped pod is still terminating.
+func (r *MigrationRequestReconciler) recreateSourcePod(ctx context.Context, migrationRequest *apiv1.MigrationRequest) (string, bool, error) {
+	source := migrationRequest.Status.Source
+	if source != nil && source.Workload != nil {
+		// The workload recreates the pod once scaled back up
+		return "", true, r.scaleUpSourceWorkload(ctx, migrationRequest)
+	}
+	if source == nil || source.Pod == nil || !podStopped(migrationRequest) || metav1.GetControllerOf(source.Pod) != nil {
+		return "", true, nil
+	}
+
+	existing := &corev1.Pod{}
+	err := r.Get(ctx, types.NamespacedName{Namespace: source.Pod.Namespace, Name: source.Pod.Name}, existing)
+	if err == nil {
+		if existing.DeletionTimestamp != nil {
+			// Wait for the stopped pod to be gone before recreating it under the same name
+			return "", false, nil
+		}
+		// The pod wasn't stopped after all, or it was already recreated
+		return "", true, nil
+	}
+	if !errors.IsNotFound(err) {
+		return "", false, err
+	}
+
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            source.Pod.Name,
+			Namespace:       source.Pod.Namespace,
+			Labels:          source.Pod.Labels,
+			Annotations:     source.Pod.Annotations,
+			OwnerReferences: source.Pod.OwnerReferences,
+		},
+		Spec: *source.Pod.Spec.DeepCopy(),
+	}
+	// The volume is local to the source node
+	pod.Spec.NodeName = source.NodeName
+	pod.Spec.EphemeralContainers = nil
+	if err := r.Create(ctx, pod); err != nil && !errors.IsAlreadyExists(err) {
+		return "", false, err
+	}
+	log.FromContext(ctx).Info("source pod recreated", "pod", pod.Name, "node", pod.Spec.NodeName)
+	return pod.Name, true, nil
+}
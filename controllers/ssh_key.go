@@ -0,0 +1,133 @@
+/*
+Copyright 2023 thehamdiaz.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+
+	"golang.org/x/crypto/ssh"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	"github.com/thehamdiaz/first-controller.git/agent"
+	apiv1 "github.com/thehamdiaz/first-controller.git/api/v1"
+)
+
+// The fields of the migration Secret holding the ssh key pair
+const (
+	privateKeyField = "id_ed25519"
+	publicKeyField  = "id_ed25519.pub"
+)
+
+// migrationKeyID identifies the key of a migration in the authorized_keys of the destination
+func migrationKeyID(migrationRequest *apiv1.MigrationRequest) string {
+	return migrationRequest.Namespace + "/" + migrationRequest.Name
+}
+
+// generateKeyPair returns a new ed25519 private key in the OpenSSH format and its public key in the authorized_keys format
+func generateKeyPair(comment string) ([]byte, []byte, error) {
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	block, err := ssh.MarshalPrivateKey(privateKey, comment)
+	if err != nil {
+		return nil, nil, err
+	}
+	sshPublicKey, err := ssh.NewPublicKey(publicKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	return pem.EncodeToMemory(block), ssh.MarshalAuthorizedKey(sshPublicKey), nil
+}
+
+// destinationCredentials returns the Secret referenced by the destination of the migration, nil when there is none
+func (r *MigrationRequestReconciler) destinationCredentials(ctx context.Context, migrationRequest *apiv1.MigrationRequest) (*corev1.Secret, error) {
+	destination := destinationOf(migrationRequest)
+	if destination.CredentialsSecretName == "" {
+		return nil, nil
+	}
+	secret := &corev1.Secret{}
+	key := client.ObjectKey{Namespace: destination.CredentialsSecretNamespace, Name: destination.CredentialsSecretName}
+	if err := r.Get(ctx, key, secret); err != nil {
+		return nil, err
+	}
+	return secret, nil
+}
+
+// authorizeKey installs the public key of the migration on the destination, restricted to receiving into the destination datasets
+func (r *MigrationRequestReconciler) authorizeKey(ctx context.Context, migrationRequest *apiv1.MigrationRequest) error {
+	destination := destinationOf(migrationRequest)
+	secret := &corev1.Secret{}
+	if err := r.Get(ctx, client.ObjectKey{Namespace: migrationRequest.Namespace, Name: migrationRequest.Status.Source.SecretName}, secret); err != nil {
+		return err
+	}
+	var datasets []string
+	for _, volume := range migrationRequest.Status.Volumes {
+		datasets = append(datasets, volume.RemoteDataset)
+	}
+	destinationAgent, err := r.destinationAgent(ctx, migrationRequest)
+	if err != nil {
+		return err
+	}
+	_, err = destinationAgent.AuthorizeKey(ctx, &agent.AuthorizeKeyRequest{
+		ID:        migrationRequest.Status.AuthorizedKey,
+		User:      destination.User,
+		PublicKey: string(secret.Data[publicKeyField]),
+		Pool:      destination.RemotePool,
+		Datasets:  datasets,
+	})
+	return err
+}
+
+// revokeKey removes the key of a finished migration from the destination and deletes its Secret
+func (r *MigrationRequestReconciler) revokeKey(ctx context.Context, migrationRequest *apiv1.MigrationRequest) error {
+	l := log.FromContext(ctx)
+	destination := destinationOf(migrationRequest)
+
+	destinationAgent, err := r.destinationAgent(ctx, migrationRequest)
+	if errors.IsNotFound(err) {
+		// The destination node is gone and its authorized keys with it
+		l.Info("destination node not found, skipping the key revocation", "node", destination.RemoteHostName)
+	} else if err != nil {
+		return err
+	} else if _, err := destinationAgent.RevokeKey(ctx, &agent.RevokeKeyRequest{ID: migrationRequest.Status.AuthorizedKey, User: destination.User}); err != nil {
+		l.Error(err, "failed to revoke the migration key on the destination")
+		return err
+	}
+
+	if migrationRequest.Status.Source != nil && migrationRequest.Status.Source.SecretName != "" {
+		secret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Namespace: migrationRequest.Namespace, Name: migrationRequest.Status.Source.SecretName}}
+		if err := r.Delete(ctx, secret); err != nil && !errors.IsNotFound(err) {
+			return err
+		}
+	}
+
+	migrationRequest.Status.AuthorizedKey = ""
+	if err := r.Status().Update(ctx, migrationRequest); err != nil {
+		l.Error(err, "failed to update migrationRequest status")
+		return err
+	}
+	l.Info("migration key revoked", "user", destination.User, "host", destination.RemoteHostName)
+	return nil
+}
@@ -0,0 +1,221 @@
+/*
+Copyright 2023 thehamdiaz.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	apiv1 "github.com/thehamdiaz/first-controller.git/api/v1"
+)
+
+// StatefulSetMigrationReconciler migrates the replicas of a StatefulSet with one MigrationRequest per replica
+type StatefulSetMigrationReconciler struct {
+	client.Client
+	Scheme *runtime.Scheme
+}
+
+//+kubebuilder:rbac:groups=api.k8s.zfs-volume-migrator.io,resources=statefulsetmigrations,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=api.k8s.zfs-volume-migrator.io,resources=statefulsetmigrations/status,verbs=get;update;patch
+//+kubebuilder:rbac:groups=api.k8s.zfs-volume-migrator.io,resources=statefulsetmigrations/finalizers,verbs=update
+//+kubebuilder:rbac:groups=api.k8s.zfs-volume-migrator.io,resources=migrationrequests,verbs=get;list;watch;create
+//+kubebuilder:rbac:groups=apps,resources=statefulsets,verbs=get;list;watch
+//+kubebuilder:rbac:groups="",resources=pods,verbs=get;list;watch
+
+// Reconcile migrates the replicas from the highest ordinal down, starting the migration of the next replica once
+// fewer than MaxUnavailable replicas are being migrated. A replica is migrated once its pod is ready on the destination node.
+func (r *StatefulSetMigrationReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	l := log.FromContext(ctx)
+
+	statefulSetMigration := &apiv1.StatefulSetMigration{}
+	if err := r.Get(ctx, req.NamespacedName, statefulSetMigration); err != nil {
+		if errors.IsNotFound(err) {
+			// Object not found Return and don't requeue
+			return ctrl.Result{}, nil
+		}
+		return ctrl.Result{}, err
+	}
+
+	status := &statefulSetMigration.Status
+	switch status.Phase {
+	case apiv1.StatefulSetMigrationPhaseCompleted, apiv1.StatefulSetMigrationPhaseFailed:
+		return ctrl.Result{}, nil
+	case "":
+		statefulSet := &appsv1.StatefulSet{}
+		key := types.NamespacedName{Namespace: statefulSetMigration.Namespace, Name: statefulSetMigration.Spec.StatefulSetName}
+		if err := r.Get(ctx, key, statefulSet); err != nil {
+			l.Error(err, "failed to get the StatefulSet")
+			return ctrl.Result{}, err
+		}
+		status.Replicas = 1
+		if statefulSet.Spec.Replicas != nil {
+			status.Replicas = *statefulSet.Spec.Replicas
+		}
+		status.Phase = apiv1.StatefulSetMigrationPhaseMigrating
+		setStatefulSetMigrationCondition(statefulSetMigration, apiv1.MigrationConditionCompleted, metav1.ConditionFalse, apiv1.ReasonInProgress,
+			fmt.Sprintf("migrating %d replicas", status.Replicas))
+	}
+
+	inFlight := 0
+	status.ReadyReplicas = 0
+	for i := range status.Migrations {
+		migration := &status.Migrations[i]
+		if !migration.Ready {
+			migrationRequest := &apiv1.MigrationRequest{}
+			key := types.NamespacedName{Namespace: statefulSetMigration.Namespace, Name: migration.MigrationRequestName}
+			if err := r.Get(ctx, key, migrationRequest); errors.IsNotFound(err) {
+				return r.fail(ctx, statefulSetMigration, fmt.Sprintf("MigrationRequest %s was deleted", migration.MigrationRequestName))
+			} else if err != nil {
+				return ctrl.Result{}, err
+			}
+			migration.Phase = migrationRequest.Status.Phase
+			switch migration.Phase {
+			case apiv1.MigrationPhaseFailed, apiv1.MigrationPhaseAborted:
+				return r.fail(ctx, statefulSetMigration, fmt.Sprintf("the migration of replica %d is %s: %s",
+					migration.Ordinal, migration.Phase, migrationRequest.Status.Message))
+			case apiv1.MigrationPhaseCompleted:
+				ready, err := r.replicaReady(ctx, statefulSetMigration, migrationRequest, migration.Ordinal)
+				if err != nil {
+					return ctrl.Result{}, err
+				}
+				migration.Ready = ready
+			}
+		}
+		if migration.Ready {
+			status.ReadyReplicas++
+		} else {
+			inFlight++
+		}
+	}
+
+	// The webhook defaults it, an object created while the webhook was unavailable would never start a replica
+	maxUnavailable := statefulSetMigration.Spec.MaxUnavailable
+	if maxUnavailable < 1 {
+		maxUnavailable = apiv1.DefaultMaxUnavailable
+	}
+	for inFlight < maxUnavailable && int32(len(status.Migrations)) < status.Replicas {
+		ordinal := status.Replicas - 1 - int32(len(status.Migrations))
+		migrationRequest, err := r.createReplicaMigration(ctx, statefulSetMigration, ordinal)
+		if err != nil {
+			l.Error(err, "failed to create the MigrationRequest of a replica", "ordinal", ordinal)
+			return ctrl.Result{}, err
+		}
+		l.Info("replica migration started", "ordinal", ordinal, "migrationRequest", migrationRequest.Name)
+		status.Migrations = append(status.Migrations, apiv1.ReplicaMigration{Ordinal: ordinal, MigrationRequestName: migrationRequest.Name})
+		inFlight++
+	}
+
+	result := ctrl.Result{RequeueAfter: requeueInterval}
+	status.Message = fmt.Sprintf("%d of %d replicas migrated", status.ReadyReplicas, status.Replicas)
+	if status.ReadyReplicas == status.Replicas {
+		status.Phase = apiv1.StatefulSetMigrationPhaseCompleted
+		setStatefulSetMigrationCondition(statefulSetMigration, apiv1.MigrationConditionCompleted, metav1.ConditionTrue, apiv1.ReasonCompleted, status.Message)
+		result = ctrl.Result{}
+	}
+	if err := r.Status().Update(ctx, statefulSetMigration); err != nil {
+		l.Error(err, "failed to update statefulSetMigration status")
+		return ctrl.Result{}, err
+	}
+	return result, nil
+}
+
+// replicaMigrationName returns the name of the MigrationRequest of a replica
+func replicaMigrationName(statefulSetMigration *apiv1.StatefulSetMigration, ordinal int32) string {
+	return fmt.Sprintf("%s-%d", statefulSetMigration.Name, ordinal)
+}
+
+// createReplicaMigration creates the MigrationRequest of a replica from the template, it deletes the pod of the
+// replica alone at the cutover and keeps the names of its claims. An existing one was created before a failed status update.
+func (r *StatefulSetMigrationReconciler) createReplicaMigration(ctx context.Context, statefulSetMigration *apiv1.StatefulSetMigration, ordinal int32) (*apiv1.MigrationRequest, error) {
+	spec := *statefulSetMigration.Spec.Template.DeepCopy()
+	spec.PodName = fmt.Sprintf("%s-%d", statefulSetMigration.Spec.StatefulSetName, ordinal)
+	spec.Workload = &apiv1.WorkloadReference{
+		Kind: apiv1.WorkloadKindStatefulSet,
+		Name: statefulSetMigration.Spec.StatefulSetName,
+		Stop: apiv1.WorkloadStopDeletePod,
+	}
+	spec.Destination.RemoteDataset = fmt.Sprintf("%s-%d", spec.Destination.RemoteDataset, ordinal)
+
+	migrationRequest := &apiv1.MigrationRequest{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      replicaMigrationName(statefulSetMigration, ordinal),
+			Namespace: statefulSetMigration.Namespace,
+		},
+		Spec: spec,
+	}
+	if err := controllerutil.SetControllerReference(statefulSetMigration, migrationRequest, r.Scheme); err != nil {
+		return nil, err
+	}
+	if err := r.Create(ctx, migrationRequest); err != nil && !errors.IsAlreadyExists(err) {
+		return nil, err
+	}
+	return migrationRequest, nil
+}
+
+// replicaReady tells whether the StatefulSet recreated the pod of a migrated replica on the destination node and it is ready
+func (r *StatefulSetMigrationReconciler) replicaReady(ctx context.Context, statefulSetMigration *apiv1.StatefulSetMigration, migrationRequest *apiv1.MigrationRequest, ordinal int32) (bool, error) {
+	pod := &corev1.Pod{}
+	key := types.NamespacedName{Namespace: statefulSetMigration.Namespace, Name: fmt.Sprintf("%s-%d", statefulSetMigration.Spec.StatefulSetName, ordinal)}
+	if err := r.Get(ctx, key, pod); errors.IsNotFound(err) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	if pod.DeletionTimestamp != nil || pod.Spec.NodeName != destinationOf(migrationRequest).RemoteHostName {
+		return false, nil
+	}
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type == corev1.PodReady {
+			return condition.Status == corev1.ConditionTrue, nil
+		}
+	}
+	return false, nil
+}
+
+// fail stops the migration of the StatefulSet, the replicas already migrated stay on the destination node
+func (r *StatefulSetMigrationReconciler) fail(ctx context.Context, statefulSetMigration *apiv1.StatefulSetMigration, message string) (ctrl.Result, error) {
+	l := log.FromContext(ctx)
+	statefulSetMigration.Status.Phase = apiv1.StatefulSetMigrationPhaseFailed
+	statefulSetMigration.Status.Message = message
+	setStatefulSetMigrationCondition(statefulSetMigration, apiv1.MigrationConditionCompleted, metav1.ConditionFalse, apiv1.ReasonFailed, message)
+	setStatefulSetMigrationCondition(statefulSetMigration, apiv1.MigrationConditionFailed, metav1.ConditionTrue, apiv1.ReasonFailed, message)
+	if err := r.Status().Update(ctx, statefulSetMigration); err != nil {
+		l.Error(err, "failed to update statefulSetMigration status")
+		return ctrl.Result{}, err
+	}
+	l.Info("statefulSet migration failed", "reason", message)
+	return ctrl.Result{}, nil
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *StatefulSetMigrationReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&apiv1.StatefulSetMigration{}).
+		Owns(&apiv1.MigrationRequest{}).
+		Complete(r)
+}
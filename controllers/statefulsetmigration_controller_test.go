@@ -0,0 +1,156 @@
+/*
+Copyright 2023 thehamdiaz.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+
+	apiv1 "github.com/thehamdiaz/first-controller.git/api/v1"
+)
+
+var _ = Describe("StatefulSetMigration controller", func() {
+	ctx := context.Background()
+	var namespace string
+	var key types.NamespacedName
+
+	// reconcile runs a new reconciler each time, the progress of the migration is only kept in its status
+	reconcile := func() *apiv1.StatefulSetMigration {
+		reconciler := &StatefulSetMigrationReconciler{Client: k8sClient, Scheme: k8sClient.Scheme()}
+		_, err := reconciler.Reconcile(ctx, ctrl.Request{NamespacedName: key})
+		Expect(err).NotTo(HaveOccurred())
+		statefulSetMigration := &apiv1.StatefulSetMigration{}
+		Expect(k8sClient.Get(ctx, key, statefulSetMigration)).To(Succeed())
+		return statefulSetMigration
+	}
+
+	// setPhase moves the MigrationRequest of a replica to the phase, as the MigrationRequest controller would
+	setPhase := func(name string, phase apiv1.MigrationPhase) {
+		migrationRequest := &apiv1.MigrationRequest{}
+		Expect(k8sClient.Get(ctx, types.NamespacedName{Namespace: namespace, Name: name}, migrationRequest)).To(Succeed())
+		migrationRequest.Status.Phase = phase
+		Expect(k8sClient.Status().Update(ctx, migrationRequest)).To(Succeed())
+	}
+
+	// recreateReadyPod creates the pod of a replica, ready on the node, as the StatefulSet controller and the kubelet would
+	recreateReadyPod := func(name, nodeName string) {
+		pod := &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name},
+			Spec: corev1.PodSpec{
+				NodeName:   nodeName,
+				Containers: []corev1.Container{{Name: "db", Image: "postgres"}},
+			},
+		}
+		Expect(k8sClient.Create(ctx, pod)).To(Succeed())
+		pod.Status.Conditions = []corev1.PodCondition{{Type: corev1.PodReady, Status: corev1.ConditionTrue}}
+		Expect(k8sClient.Status().Update(ctx, pod)).To(Succeed())
+	}
+
+	// createStatefulSetMigration creates a StatefulSet of 3 replicas and its StatefulSetMigration, in a namespace of their own
+	createStatefulSetMigration := func(name string, maxUnavailable int) {
+		namespace = name
+		key = types.NamespacedName{Namespace: namespace, Name: "db"}
+		Expect(k8sClient.Create(ctx, &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: namespace}})).To(Succeed())
+		replicas := int32(3)
+		labels := map[string]string{"app": "db"}
+		Expect(k8sClient.Create(ctx, &appsv1.StatefulSet{
+			ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: "db"},
+			Spec: appsv1.StatefulSetSpec{
+				Replicas:    &replicas,
+				ServiceName: "db",
+				Selector:    &metav1.LabelSelector{MatchLabels: labels},
+				Template: corev1.PodTemplateSpec{
+					ObjectMeta: metav1.ObjectMeta{Labels: labels},
+					Spec:       corev1.PodSpec{Containers: []corev1.Container{{Name: "db", Image: "postgres"}}},
+				},
+			},
+		})).To(Succeed())
+		Expect(k8sClient.Create(ctx, &apiv1.StatefulSetMigration{
+			ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: key.Name},
+			Spec: apiv1.StatefulSetMigrationSpec{
+				StatefulSetName: "db",
+				MaxUnavailable:  maxUnavailable,
+				Template: apiv1.MigrationRequestSpec{
+					DesiredSnapshotCount: 2,
+					Destination: apiv1.DestinationDef{
+						RemotePool:     "pool",
+						RemoteDataset:  "data",
+						RemoteHostName: "node-2",
+					},
+				},
+			},
+		})).To(Succeed())
+	}
+
+	It("migrates the replicas from the highest ordinal, MaxUnavailable at a time", func() {
+		createStatefulSetMigration("replicas", 1)
+
+		By("starting with the replica of the highest ordinal")
+		statefulSetMigration := reconcile()
+		Expect(statefulSetMigration.Status.Phase).To(Equal(apiv1.StatefulSetMigrationPhaseMigrating))
+		Expect(statefulSetMigration.Status.Replicas).To(BeEquivalentTo(3))
+		Expect(statefulSetMigration.Status.Migrations).To(Equal([]apiv1.ReplicaMigration{{Ordinal: 2, MigrationRequestName: "db-2"}}))
+		migrationRequest := &apiv1.MigrationRequest{}
+		Expect(k8sClient.Get(ctx, types.NamespacedName{Namespace: namespace, Name: "db-2"}, migrationRequest)).To(Succeed())
+		Expect(migrationRequest.Spec.PodName).To(Equal("db-2"))
+		Expect(migrationRequest.Spec.Destination.RemoteDataset).To(Equal("data-2"))
+		Expect(migrationRequest.Spec.Workload).To(Equal(&apiv1.WorkloadReference{
+			Kind: apiv1.WorkloadKindStatefulSet, Name: "db", Stop: apiv1.WorkloadStopDeletePod,
+		}))
+		Expect(metav1.IsControlledBy(migrationRequest, statefulSetMigration)).To(BeTrue())
+
+		By("waiting for the pod of the migrated replica to be ready on the destination node")
+		Expect(reconcile().Status.Migrations).To(HaveLen(1))
+		setPhase("db-2", apiv1.MigrationPhaseCompleted)
+		statefulSetMigration = reconcile()
+		Expect(statefulSetMigration.Status.Migrations).To(HaveLen(1))
+		Expect(statefulSetMigration.Status.Migrations[0].Phase).To(Equal(apiv1.MigrationPhaseCompleted))
+		Expect(statefulSetMigration.Status.ReadyReplicas).To(BeZero())
+
+		By("migrating the next replica once the previous one is ready")
+		recreateReadyPod("db-2", "node-2")
+		statefulSetMigration = reconcile()
+		Expect(statefulSetMigration.Status.ReadyReplicas).To(BeEquivalentTo(1))
+		Expect(statefulSetMigration.Status.Migrations).To(HaveLen(2))
+		Expect(statefulSetMigration.Status.Migrations[0].Ready).To(BeTrue())
+		Expect(statefulSetMigration.Status.Migrations[1].MigrationRequestName).To(Equal("db-1"))
+
+		By("stopping at the first replica whose migration failed")
+		setPhase("db-1", apiv1.MigrationPhaseFailed)
+		statefulSetMigration = reconcile()
+		Expect(statefulSetMigration.Status.Phase).To(Equal(apiv1.StatefulSetMigrationPhaseFailed))
+		Expect(statefulSetMigration.Status.Migrations).To(HaveLen(2))
+		Expect(meta.IsStatusConditionTrue(statefulSetMigration.Status.Conditions, apiv1.MigrationConditionFailed)).To(BeTrue())
+		Expect(reconcile().Status.Migrations).To(HaveLen(2))
+	})
+
+	It("migrates one replica at a time when maxUnavailable isn't set", func() {
+		createStatefulSetMigration("replicas-default", 0)
+		statefulSetMigration := reconcile()
+		Expect(statefulSetMigration.Status.Migrations).To(Equal([]apiv1.ReplicaMigration{{Ordinal: 2, MigrationRequestName: "db-2"}}))
+		Expect(reconcile().Status.Migrations).To(HaveLen(1))
+	})
+})
@@ -17,12 +17,18 @@ limitations under the License.
 package controllers
 
 import (
+	"context"
+	"os"
+	"os/exec"
 	"path/filepath"
+	"strings"
 	"testing"
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 
+	snapv1 "github.com/kubernetes-csi/external-snapshotter/client/v4/apis/volumesnapshot/v1"
+	openebszfsv1 "github.com/openebs/zfs-localpv/pkg/apis/openebs.io/zfs/v1"
 	"k8s.io/client-go/kubernetes/scheme"
 	"k8s.io/client-go/rest"
 	"sigs.k8s.io/controller-runtime/pkg/client"
@@ -41,18 +47,35 @@ var cfg *rest.Config
 var k8sClient client.Client
 var testEnv *envtest.Environment
 
+// testAgents are the node agents of the nodes of the test environment, all of them are served by the same agent
+var testAgents *testAgent
+var stopAgent context.CancelFunc
+
 func TestAPIs(t *testing.T) {
 	RegisterFailHandler(Fail)
 
 	RunSpecs(t, "Controller Suite")
 }
 
+// moduleDir returns the directory of a dependency in the module cache
+func moduleDir(path string) string {
+	out, err := exec.Command("go", "list", "-m", "-f", "{{.Dir}}", path).Output()
+	Expect(err).NotTo(HaveOccurred())
+	return strings.TrimSpace(string(out))
+}
+
 var _ = BeforeSuite(func() {
+	if os.Getenv("KUBEBUILDER_ASSETS") == "" {
+		Skip("KUBEBUILDER_ASSETS isn't set, run make test to install the binaries of the test environment")
+	}
 	logf.SetLogger(zap.New(zap.WriteTo(GinkgoWriter), zap.UseDevMode(true)))
 
 	By("bootstrapping test environment")
+	// The VolumeSnapshots and the ZFSVolumes are defined by the snapshot controller and ZFS-LocalPV
+	snapshotCRDs := filepath.Join(moduleDir("github.com/kubernetes-csi/external-snapshotter/client/v4"), "config", "crd")
+	zfsVolumeCRD := filepath.Join(moduleDir("github.com/openebs/zfs-localpv"), "deploy", "yamls", "zfsvolume-crd.yaml")
 	testEnv = &envtest.Environment{
-		CRDDirectoryPaths:     []string{filepath.Join("..", "config", "crd", "bases")},
+		CRDDirectoryPaths:     []string{filepath.Join("..", "config", "crd", "bases"), snapshotCRDs, zfsVolumeCRD},
 		ErrorIfCRDPathMissing: true,
 	}
 
@@ -64,6 +87,10 @@ var _ = BeforeSuite(func() {
 
 	err = apiv1.AddToScheme(scheme.Scheme)
 	Expect(err).NotTo(HaveOccurred())
+	err = snapv1.AddToScheme(scheme.Scheme)
+	Expect(err).NotTo(HaveOccurred())
+	err = openebszfsv1.AddToScheme(scheme.Scheme)
+	Expect(err).NotTo(HaveOccurred())
 
 	//+kubebuilder:scaffold:scheme
 
@@ -71,10 +98,19 @@ var _ = BeforeSuite(func() {
 	Expect(err).NotTo(HaveOccurred())
 	Expect(k8sClient).NotTo(BeNil())
 
+	By("starting the node agent")
+	var ctx context.Context
+	ctx, stopAgent = context.WithCancel(context.Background())
+	testAgents, err = startTestAgent(ctx, GinkgoT().TempDir())
+	Expect(err).NotTo(HaveOccurred())
 })
 
 var _ = AfterSuite(func() {
 	By("tearing down the test environment")
+	if testEnv == nil {
+		return
+	}
+	stopAgent()
 	err := testEnv.Stop()
 	Expect(err).NotTo(HaveOccurred())
 })
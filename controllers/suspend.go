@@ -0,0 +1,73 @@
+/*
+Copyright 2023 thehamdiaz.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	apiv1 "github.com/thehamdiaz/first-controller.git/api/v1"
+)
+
+// podStopped tells whether the source pod was stopped for the cutover
+func podStopped(migrationRequest *apiv1.MigrationRequest) bool {
+	return meta.FindStatusCondition(migrationRequest.Status.Conditions, apiv1.MigrationConditionPodStopped) != nil
+}
+
+// holdable tells whether a suspended migration can be held in its current phase, which is the case when
+// no VolumeSnapshot is being taken and the source pod isn't stopped. Sending is held in reconcileSending once no send is running.
+func holdable(migrationRequest *apiv1.MigrationRequest) bool {
+	switch migrationRequest.Status.Phase {
+	case "", apiv1.MigrationPhasePending:
+		return true
+	case apiv1.MigrationPhaseSnapshotting:
+		return migrationRequest.Status.CurrentSnapshot == nil && !podStopped(migrationRequest)
+	case apiv1.MigrationPhaseCuttingOver:
+		return !podStopped(migrationRequest)
+	}
+	return false
+}
+
+// holdMigration records that the migration is suspended, it isn't requeued: unsetting suspend triggers the next reconcile
+func (r *MigrationRequestReconciler) holdMigration(ctx context.Context, migrationRequest *apiv1.MigrationRequest) (ctrl.Result, error) {
+	migrationRequest.Status.Progress = nil
+	if setMigrationCondition(migrationRequest, apiv1.MigrationConditionSuspended, metav1.ConditionTrue, apiv1.ReasonSuspended,
+		fmt.Sprintf("the migration is suspended in the %s phase", migrationRequest.Status.Phase)) {
+		log.FromContext(ctx).Info("migration suspended", "phase", migrationRequest.Status.Phase)
+		if err := r.Status().Update(ctx, migrationRequest); err != nil {
+			log.FromContext(ctx).Error(err, "failed to update migrationRequest status")
+			return ctrl.Result{}, err
+		}
+	}
+	return ctrl.Result{}, nil
+}
+
+// resumeMigration records that a suspended migration continues
+func (r *MigrationRequestReconciler) resumeMigration(ctx context.Context, migrationRequest *apiv1.MigrationRequest) error {
+	if !meta.IsStatusConditionTrue(migrationRequest.Status.Conditions, apiv1.MigrationConditionSuspended) {
+		return nil
+	}
+	log.FromContext(ctx).Info("migration resumed", "phase", migrationRequest.Status.Phase)
+	setMigrationCondition(migrationRequest, apiv1.MigrationConditionSuspended, metav1.ConditionFalse, apiv1.ReasonResumed,
+		fmt.Sprintf("the migration resumed in the %s phase", migrationRequest.Status.Phase))
+	return r.Status().Update(ctx, migrationRequest)
+}
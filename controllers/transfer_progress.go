@@ -0,0 +1,81 @@
+/*
+Copyright 2023 thehamdiaz.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/thehamdiaz/first-controller.git/agent"
+	apiv1 "github.com/thehamdiaz/first-controller.git/api/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// progressInterval throttles the status updates made while a snapshot is being sent
+const progressInterval = 10 * time.Second
+
+// updateTransferProgress records the progress reported by the node agent for the running send in the status
+func (r *MigrationRequestReconciler) updateTransferProgress(ctx context.Context, migrationRequest *apiv1.MigrationRequest, sendStatus *agent.SendStatus) error {
+	progress := migrationRequest.Status.Progress
+	if progress != nil && progress.LastUpdateTime != nil && time.Since(progress.LastUpdateTime.Time) < progressInterval {
+		return nil
+	}
+
+	now := metav1.Now()
+	progress = &apiv1.TransferProgress{
+		EstimatedBytes: sendStatus.EstimatedBytes,
+		BytesSent:      sendStatus.BytesSent,
+		BytesPerSecond: sendStatus.BytesPerSecond,
+		LastUpdateTime: &now,
+	}
+	summarizeProgress(progress)
+	migrationRequest.Status.Progress = progress
+	return r.Status().Update(ctx, migrationRequest)
+}
+
+// summarizeProgress fills the human readable fields shown by kubectl get
+func summarizeProgress(progress *apiv1.TransferProgress) {
+	progress.Rate = formatBytes(progress.BytesPerSecond) + "/s"
+	progress.Percentage = ""
+	progress.ETA = ""
+	if progress.EstimatedBytes > 0 {
+		percentage := progress.BytesSent * 100 / progress.EstimatedBytes
+		if percentage > 100 {
+			percentage = 100
+		}
+		progress.Percentage = fmt.Sprintf("%d%%", percentage)
+		if progress.BytesPerSecond > 0 && progress.BytesSent < progress.EstimatedBytes {
+			remaining := (progress.EstimatedBytes - progress.BytesSent) / progress.BytesPerSecond
+			progress.ETA = (time.Duration(remaining) * time.Second).String()
+		}
+	}
+}
+
+func formatBytes(bytes int64) string {
+	units := []string{"B", "KiB", "MiB", "GiB", "TiB"}
+	value := float64(bytes)
+	unit := 0
+	for value >= 1024 && unit < len(units)-1 {
+		value /= 1024
+		unit++
+	}
+	if unit == 0 {
+		return fmt.Sprintf("%d%s", bytes, units[unit])
+	}
+	return fmt.Sprintf("%.1f%s", value, units[unit])
+}
@@ -0,0 +1,210 @@
+/*
+Copyright 2023 thehamdiaz.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	snapv1 "github.com/kubernetes-csi/external-snapshotter/client/v4/apis/volumesnapshot/v1"
+	corev1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	apiv1 "github.com/thehamdiaz/first-controller.git/api/v1"
+)
+
+// zfsCSIDriver is the CSI driver of ZFS-LocalPV, only its volumes are migrated
+const zfsCSIDriver = "zfs.csi.openebs.io"
+
+// resolveVolumes returns the volumes of the pod claiming ZFS-LocalPV PersistentVolumes, in the order of the pod volumes.
+// A single volume is received into the remote dataset of the destination, several are received into datasets
+// named after it and the volumes.
+func (r *MigrationRequestReconciler) resolveVolumes(ctx context.Context, migrationRequest *apiv1.MigrationRequest, pod *corev1.Pod) ([]apiv1.MigratedVolume, error) {
+	var volumes []apiv1.MigratedVolume
+	for _, podVolume := range pod.Spec.Volumes {
+		if podVolume.PersistentVolumeClaim == nil {
+			continue
+		}
+		// Fetch the PersistentVolumeClaim
+		pvc := &corev1.PersistentVolumeClaim{}
+		if err := r.Get(ctx, types.NamespacedName{Namespace: pod.Namespace, Name: podVolume.PersistentVolumeClaim.ClaimName}, pvc); err != nil {
+			return nil, err
+		}
+		if pvc.Spec.VolumeName == "" {
+			return nil, claimError(fmt.Sprintf("PersistentVolumeClaim %s is %s and bound to no PersistentVolume, there is no volume to migrate",
+				pvc.Name, pvc.Status.Phase))
+		}
+		// Fetch the PersistentVolume
+		pv := &corev1.PersistentVolume{}
+		if err := r.Get(ctx, types.NamespacedName{Name: pvc.Spec.VolumeName}, pv); err != nil {
+			return nil, err
+		}
+		if pv.Spec.CSI == nil || pv.Spec.CSI.Driver != zfsCSIDriver {
+			continue
+		}
+		storageClass := &storagev1.StorageClass{}
+		if err := r.Get(ctx, types.NamespacedName{Name: pv.Spec.StorageClassName}, storageClass); err != nil {
+			return nil, err
+		}
+		restoredClaimName := restoredName(pvc.Name)
+		if migrationRequest.Spec.KeepNames {
+			restoredClaimName = pvc.Name
+		}
+		volumes = append(volumes, apiv1.MigratedVolume{
+			Name:                      podVolume.Name,
+			PersistentVolumeClaimName: pvc.Name,
+			PersistentVolumeName:      pv.Name,
+			StorageClassName:          storageClass.Name,
+			PoolName:                  storageClass.Parameters["poolname"],
+			RestoredClaimName:         restoredClaimName,
+		})
+	}
+	if len(volumes) == 0 {
+		return nil, errNoPersistentVolumeClaim
+	}
+
+	remoteDataset := destinationOf(migrationRequest).RemoteDataset
+	for i := range volumes {
+		volumes[i].RemoteDataset = remoteDataset
+		if len(volumes) > 1 {
+			volumes[i].RemoteDataset += "-" + volumes[i].Name
+		}
+	}
+	return volumes, nil
+}
+
+// volumeSnapshotName returns the name of the VolumeSnapshot of a volume for a snapshot of the migration
+func volumeSnapshotName(snapshot *apiv1.SnapshotRef, volume *apiv1.MigratedVolume) string {
+	return snapshot.Name + "-" + volume.Name
+}
+
+// countMissing counts the VolumeSnapshots that aren't created yet
+func countMissing(snapshots []*snapv1.VolumeSnapshot) int {
+	missing := 0
+	for _, vs := range snapshots {
+		if vs == nil {
+			missing++
+		}
+	}
+	return missing
+}
+
+// restoredName returns the name of the restored copy of a source PersistentVolume or PersistentVolumeClaim
+func restoredName(name string) string {
+	return "restored-" + name
+}
+
+// restoredClaims maps the names of the migrated volumes in the source pod to their restored PersistentVolumeClaims
+func restoredClaims(migrationRequest *apiv1.MigrationRequest) map[string]string {
+	claims := map[string]string{}
+	for _, volume := range migrationRequest.Status.Volumes {
+		claims[volume.Name] = volume.RestoredClaimName
+	}
+	return claims
+}
+
+// restoreRequestsPending tells whether some volumes have no RestoreRequest yet
+func restoreRequestsPending(migrationRequest *apiv1.MigrationRequest) bool {
+	for _, volume := range migrationRequest.Status.Volumes {
+		if volume.RestoreRequestName == "" {
+			return true
+		}
+	}
+	return false
+}
+
+// restoreRequestsRestored tells whether the RestoreRequests of all the volumes restored them
+func restoreRequestsRestored(ctx context.Context, destinationClient client.Client, migrationRequest *apiv1.MigrationRequest) (bool, error) {
+	for _, volume := range migrationRequest.Status.Volumes {
+		if volume.RestoreRequestName == "" {
+			return false, nil
+		}
+		restoreReq := &apiv1.RestoreRequest{}
+		if err := destinationClient.Get(ctx, types.NamespacedName{Namespace: migrationRequest.Namespace, Name: volume.RestoreRequestName}, restoreReq); err != nil {
+			return false, err
+		}
+		if !meta.IsStatusConditionTrue(restoreReq.Status.Conditions, apiv1.RestoreConditionRestored) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// claimError is a claim the migration can't go on with, an unbound source claim or a claim in the way of a restored
+// claim that can't be deleted safely, retrying won't fix it
+type claimError string
+
+func (e claimError) Error() string {
+	return string(e)
+}
+
+// releaseSourceClaims deletes the source claims whose restored claim takes their name in the same cluster, those of a
+// StatefulSet or all of them with KeepNames, once their PersistentVolume is retained so that the source volume is kept
+// for a rollback. It returns false while a claim is still being deleted.
+// The claims are locked from the cutover on, a claim bound to another volume was created while the webhook was
+// unavailable, a StatefulSet recreating it from its template for instance: it is deleted while it is unbound, the
+// migration fails otherwise since the volume it is bound to may hold data.
+func (r *MigrationRequestReconciler) releaseSourceClaims(ctx context.Context, migrationRequest *apiv1.MigrationRequest) (bool, error) {
+	if destinationOf(migrationRequest).KubeconfigSecretName != "" {
+		// The claims of the destination cluster are distinct
+		return true, nil
+	}
+
+	released := true
+	for _, volume := range migrationRequest.Status.Volumes {
+		if volume.RestoreRequestName != "" || volume.RestoredClaimName != volume.PersistentVolumeClaimName {
+			continue
+		}
+		pv := &corev1.PersistentVolume{}
+		if err := r.Get(ctx, types.NamespacedName{Name: volume.PersistentVolumeName}, pv); err != nil {
+			return false, err
+		}
+		if pv.Spec.PersistentVolumeReclaimPolicy != corev1.PersistentVolumeReclaimRetain {
+			patch := client.MergeFrom(pv.DeepCopy())
+			pv.Spec.PersistentVolumeReclaimPolicy = corev1.PersistentVolumeReclaimRetain
+			if err := r.Patch(ctx, pv, patch); err != nil {
+				return false, err
+			}
+		}
+
+		pvc := &corev1.PersistentVolumeClaim{}
+		err := r.Get(ctx, types.NamespacedName{Namespace: migrationRequest.Namespace, Name: volume.PersistentVolumeClaimName}, pvc)
+		if errors.IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return false, err
+		}
+		if pvc.Spec.VolumeName != volume.PersistentVolumeName && pvc.Status.Phase != corev1.ClaimPending && pvc.Spec.VolumeName != "" {
+			return false, claimError(fmt.Sprintf("PersistentVolumeClaim %s was recreated and bound to PersistentVolume %s, the volume would be restored under another name",
+				pvc.Name, pvc.Spec.VolumeName))
+		}
+		released = false
+		if pvc.DeletionTimestamp == nil {
+			if err := r.Delete(ctx, pvc); err != nil && !errors.IsNotFound(err) {
+				return false, err
+			}
+			log.FromContext(ctx).Info("claim deleted, the source volume is retained", "pvc", pvc.Name, "pv", pv.Name, "boundTo", pvc.Spec.VolumeName)
+		}
+	}
+	return released, nil
+}
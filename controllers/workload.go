@@ -0,0 +1,314 @@
+/*
+Copyright 2023 thehamdiaz.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	apiv1 "github.com/thehamdiaz/first-controller.git/api/v1"
+)
+
+// hostnameLabel is the node label the restored PersistentVolumes are pinned to a node with
+const hostnameLabel = "kubernetes.io/hostname"
+
+// workloadError is a workload that can't be migrated as requested, the migration fails
+type workloadError string
+
+func (e workloadError) Error() string {
+	return string(e)
+}
+
+const (
+	errNotControlledByWorkload workloadError = "the pod is not controlled by the workload"
+	errClaimNotFromTemplate    workloadError = "the migrated claims of a pod deleted alone must come from the volumeClaimTemplates of its StatefulSet"
+	errDeletePodRemote         workloadError = "the StatefulSet can't recreate the pod in another cluster"
+	errScaleToZeroReplicas     workloadError = "scaling the StatefulSet to zero would stop its other replicas, set workload.stop to ScaleToZero to allow it"
+)
+
+// deletesPodAlone tells whether the cutover deletes the source pod alone, leaving the other pods of its workload running
+func deletesPodAlone(migrationRequest *apiv1.MigrationRequest) bool {
+	workload := migrationRequest.Status.Source.Workload
+	return workload != nil && workload.Stop == apiv1.WorkloadStopDeletePod
+}
+
+// newWorkload returns an empty object of the kind of the workload
+func newWorkload(kind apiv1.WorkloadKind) client.Object {
+	if kind == apiv1.WorkloadKindStatefulSet {
+		return &appsv1.StatefulSet{}
+	}
+	return &appsv1.Deployment{}
+}
+
+// workloadSpec returns the pod template and the replicas of a Deployment or StatefulSet
+func workloadSpec(workload client.Object) (*corev1.PodTemplateSpec, **int32) {
+	switch w := workload.(type) {
+	case *appsv1.Deployment:
+		return &w.Spec.Template, &w.Spec.Replicas
+	case *appsv1.StatefulSet:
+		return &w.Spec.Template, &w.Spec.Replicas
+	}
+	panic(fmt.Sprintf("unexpected workload %T", workload))
+}
+
+// workloadSelector returns the selector of the pods of a Deployment or StatefulSet
+func workloadSelector(workload client.Object) (labels.Selector, error) {
+	var selector *metav1.LabelSelector
+	switch w := workload.(type) {
+	case *appsv1.Deployment:
+		selector = w.Spec.Selector
+	case *appsv1.StatefulSet:
+		selector = w.Spec.Selector
+	}
+	return metav1.LabelSelectorAsSelector(selector)
+}
+
+// getWorkload fetches the workload referenced in the namespace of the migration
+func getWorkload(ctx context.Context, c client.Client, migrationRequest *apiv1.MigrationRequest, ref apiv1.WorkloadReference) (client.Object, error) {
+	workload := newWorkload(ref.Kind)
+	if err := c.Get(ctx, types.NamespacedName{Namespace: migrationRequest.Namespace, Name: ref.Name}, workload); err != nil {
+		return nil, err
+	}
+	return workload, nil
+}
+
+// resolveWorkload checks that the workload of the spec controls the pod. The claims of the volumes coming from
+// a volumeClaimTemplate of a StatefulSet keep their name, the StatefulSet finds them by name.
+func (r *MigrationRequestReconciler) resolveWorkload(ctx context.Context, migrationRequest *apiv1.MigrationRequest, pod *corev1.Pod, volumes []apiv1.MigratedVolume) (*apiv1.SourceWorkload, error) {
+	ref := *migrationRequest.Spec.Workload
+	workload, err := getWorkload(ctx, r.Client, migrationRequest, ref)
+	if err != nil {
+		return nil, err
+	}
+
+	owner := metav1.GetControllerOf(pod)
+	if owner != nil && ref.Kind == apiv1.WorkloadKindDeployment && owner.Kind == "ReplicaSet" {
+		// The pods of a Deployment are controlled by its ReplicaSets
+		replicaSet := &appsv1.ReplicaSet{}
+		if err := r.Get(ctx, types.NamespacedName{Namespace: pod.Namespace, Name: owner.Name}, replicaSet); err != nil {
+			return nil, err
+		}
+		owner = metav1.GetControllerOf(replicaSet)
+	}
+	if owner == nil || owner.Kind != string(ref.Kind) || owner.UID != workload.GetUID() {
+		return nil, errNotControlledByWorkload
+	}
+
+	statefulSet, ok := workload.(*appsv1.StatefulSet)
+	if ok {
+		for i := range volumes {
+			if fromClaimTemplate(statefulSet, volumes[i]) {
+				volumes[i].RestoredClaimName = volumes[i].PersistentVolumeClaimName
+			}
+		}
+		if ref.Stop == "" {
+			if ref.Stop = statefulSetStopMode(migrationRequest, statefulSet, volumes); ref.Stop == "" {
+				return nil, errScaleToZeroReplicas
+			}
+		}
+	}
+	if ref.Stop == apiv1.WorkloadStopDeletePod {
+		// The pod is recreated by the StatefulSet from the same template, only the claims it creates per pod can change
+		if destinationOf(migrationRequest).KubeconfigSecretName != "" {
+			return nil, errDeletePodRemote
+		}
+		for _, volume := range volumes {
+			if !fromClaimTemplate(statefulSet, volume) {
+				return nil, errClaimNotFromTemplate
+			}
+		}
+	}
+	return &apiv1.SourceWorkload{WorkloadReference: ref}, nil
+}
+
+// fromClaimTemplate tells whether the StatefulSet created the claim of a volume from one of its volumeClaimTemplates
+func fromClaimTemplate(statefulSet *appsv1.StatefulSet, volume apiv1.MigratedVolume) bool {
+	if statefulSet == nil {
+		return false
+	}
+	for _, template := range statefulSet.Spec.VolumeClaimTemplates {
+		if template.Name == volume.Name {
+			return true
+		}
+	}
+	return false
+}
+
+// statefulSetStopMode returns how a StatefulSet whose stop mode isn't set is stopped: its pod is deleted alone when
+// the StatefulSet can recreate it with the restored claims, otherwise it is scaled to zero if that doesn't stop
+// other replicas. It returns an empty mode when the StatefulSet has other replicas it can't keep running.
+func statefulSetStopMode(migrationRequest *apiv1.MigrationRequest, statefulSet *appsv1.StatefulSet, volumes []apiv1.MigratedVolume) apiv1.WorkloadStopMode {
+	fromTemplates := true
+	for _, volume := range volumes {
+		fromTemplates = fromTemplates && fromClaimTemplate(statefulSet, volume)
+	}
+	if fromTemplates && destinationOf(migrationRequest).KubeconfigSecretName == "" {
+		return apiv1.WorkloadStopDeletePod
+	}
+	if statefulSet.Spec.Replicas == nil || *statefulSet.Spec.Replicas <= 1 {
+		return apiv1.WorkloadStopScaleToZero
+	}
+	return ""
+}
+
+// scaleWorkload sets the replicas of the workload
+func scaleWorkload(ctx context.Context, c client.Client, workload client.Object, replicas int32) error {
+	patch := client.MergeFrom(workload.DeepCopyObject().(client.Object))
+	_, workloadReplicas := workloadSpec(workload)
+	*workloadReplicas = &replicas
+	return c.Patch(ctx, workload, patch)
+}
+
+// stopWorkload scales the workload of the source pod to zero, its replicas are recorded first to scale it back up
+func (r *MigrationRequestReconciler) stopWorkload(ctx context.Context, migrationRequest *apiv1.MigrationRequest) error {
+	source := migrationRequest.Status.Source.Workload
+	workload, err := getWorkload(ctx, r.Client, migrationRequest, source.WorkloadReference)
+	if err != nil {
+		return err
+	}
+
+	if source.Replicas == nil {
+		replicas := int32(1)
+		if _, workloadReplicas := workloadSpec(workload); *workloadReplicas != nil {
+			replicas = **workloadReplicas
+		}
+		source.Replicas = &replicas
+		if err := r.Status().Update(ctx, migrationRequest); err != nil {
+			return err
+		}
+	}
+	return scaleWorkload(ctx, r.Client, workload, 0)
+}
+
+// scaleUpSourceWorkload scales the workload of a rolled back migration back to its replicas, if it was scaled down
+func (r *MigrationRequestReconciler) scaleUpSourceWorkload(ctx context.Context, migrationRequest *apiv1.MigrationRequest) error {
+	source := migrationRequest.Status.Source.Workload
+	if source.Replicas == nil {
+		return nil
+	}
+	workload, err := getWorkload(ctx, r.Client, migrationRequest, source.WorkloadReference)
+	if err != nil {
+		return err
+	}
+	if err := scaleWorkload(ctx, r.Client, workload, *source.Replicas); err != nil {
+		return err
+	}
+	log.FromContext(ctx).Info("source workload scaled back up", "kind", source.Kind, "name", source.Name, "replicas", *source.Replicas)
+	return nil
+}
+
+// restoreWorkload points the claims of the workload to the restored PersistentVolumeClaims and scales it back up.
+// When the destination is another cluster the workload is created there, the source one stays scaled to zero.
+func (r *MigrationRequestReconciler) restoreWorkload(ctx context.Context, migrationRequest *apiv1.MigrationRequest) error {
+	source := migrationRequest.Status.Source.Workload
+	if deletesPodAlone(migrationRequest) {
+		// The StatefulSet recreates the pod with the restored claims once the migration completes
+		return nil
+	}
+	workload, err := getWorkload(ctx, r.Client, migrationRequest, source.WorkloadReference)
+	if err != nil {
+		return err
+	}
+
+	if destinationOf(migrationRequest).KubeconfigSecretName == "" {
+		patch := client.MergeFrom(workload.DeepCopyObject().(client.Object))
+		migrateWorkload(migrationRequest, workload)
+		if err := r.Patch(ctx, workload, patch); err != nil {
+			return err
+		}
+		log.FromContext(ctx).Info("workload scaled back up", "kind", source.Kind, "name", source.Name)
+		return nil
+	}
+
+	destinationClient, err := r.destinationClient(ctx, migrationRequest)
+	if err != nil {
+		return err
+	}
+	copied := copyWorkload(workload)
+	migrateWorkload(migrationRequest, copied)
+	if err := destinationClient.Create(ctx, copied); err != nil && !errors.IsAlreadyExists(err) {
+		return err
+	}
+	log.FromContext(ctx).Info("workload created in the destination cluster", "kind", source.Kind, "name", source.Name)
+	return nil
+}
+
+// migrateWorkload points the pod template of the workload to the restored claims and the destination node,
+// and sets its replicas back
+func migrateWorkload(migrationRequest *apiv1.MigrationRequest, workload client.Object) {
+	template, replicas := workloadSpec(workload)
+	migratePodSpec(migrationRequest, &template.Spec)
+	sourceReplicas := *migrationRequest.Status.Source.Workload.Replicas
+	*replicas = &sourceReplicas
+}
+
+// copyWorkload returns a copy of the workload without the fields assigned by its cluster
+func copyWorkload(workload client.Object) client.Object {
+	objectMeta := metav1.ObjectMeta{
+		Name:        workload.GetName(),
+		Namespace:   workload.GetNamespace(),
+		Labels:      workload.GetLabels(),
+		Annotations: workload.GetAnnotations(),
+	}
+	switch w := workload.(type) {
+	case *appsv1.Deployment:
+		return &appsv1.Deployment{ObjectMeta: objectMeta, Spec: *w.Spec.DeepCopy()}
+	case *appsv1.StatefulSet:
+		return &appsv1.StatefulSet{ObjectMeta: objectMeta, Spec: *w.Spec.DeepCopy()}
+	}
+	panic(fmt.Sprintf("unexpected workload %T", workload))
+}
+
+// migratedWorkloadPods returns the pods of the restored workload that replace the source pod, false when the workload doesn't exist.
+// A StatefulSet recreates the pod under the same name, a Deployment under a new one.
+func (r *MigrationRequestReconciler) migratedWorkloadPods(ctx context.Context, destinationClient client.Client, migrationRequest *apiv1.MigrationRequest) ([]corev1.Pod, bool, error) {
+	source := migrationRequest.Status.Source
+	workload, err := getWorkload(ctx, destinationClient, migrationRequest, source.Workload.WorkloadReference)
+	if errors.IsNotFound(err) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+
+	labelSelector, err := workloadSelector(workload)
+	if err != nil {
+		return nil, false, err
+	}
+	pods := &corev1.PodList{}
+	if err := destinationClient.List(ctx, pods, client.InNamespace(migrationRequest.Namespace), client.MatchingLabelsSelector{Selector: labelSelector}); err != nil {
+		return nil, false, err
+	}
+
+	var migrated []corev1.Pod
+	for _, pod := range pods.Items {
+		if source.Workload.Kind == apiv1.WorkloadKindStatefulSet && pod.Name != source.Pod.Name {
+			continue
+		}
+		migrated = append(migrated, pod)
+	}
+	return migrated, true, nil
+}
@@ -18,18 +18,13 @@ package main
 
 import (
 	"flag"
-	"fmt"
 	"os"
-	"path/filepath"
 
 	// Import all Kubernetes client auth plugins (e.g. Azure, GCP, OIDC, etc.)
 	// to ensure that exec-entrypoint and run can make use of them.
-	"k8s.io/client-go/informers"
-	"k8s.io/client-go/kubernetes"
 	_ "k8s.io/client-go/plugin/pkg/client/auth"
-	"k8s.io/client-go/tools/clientcmd"
-	"k8s.io/client-go/util/homedir"
 
+	"k8s.io/apimachinery/pkg/api/resource"
 	"k8s.io/apimachinery/pkg/runtime"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
@@ -39,6 +34,7 @@ import (
 
 	snapv1 "github.com/kubernetes-csi/external-snapshotter/client/v4/apis/volumesnapshot/v1"
 	openebszfsv1 "github.com/openebs/zfs-localpv/pkg/apis/openebs.io/zfs/v1"
+	"github.com/thehamdiaz/first-controller.git/agent"
 	apiv1 "github.com/thehamdiaz/first-controller.git/api/v1"
 	"github.com/thehamdiaz/first-controller.git/controllers"
 	//+kubebuilder:scaffold:imports
@@ -61,11 +57,20 @@ func main() {
 	var metricsAddr string
 	var enableLeaderElection bool
 	var probeAddr string
+	var defaultBandwidthLimit string
+	var nodeAgentPort int
+	var nodeAgentCertDir string
 	flag.StringVar(&metricsAddr, "metrics-bind-address", ":8080", "The address the metric endpoint binds to.")
 	flag.StringVar(&probeAddr, "health-probe-bind-address", ":8081", "The address the probe endpoint binds to.")
 	flag.BoolVar(&enableLeaderElection, "leader-elect", false,
 		"Enable leader election for controller manager. "+
 			"Enabling this will ensure there is only one active controller manager.")
+	flag.StringVar(&defaultBandwidthLimit, "default-bandwidth-limit", "",
+		"Bandwidth limit of the snapshot streams in bytes per second (e.g. 100Mi) "+
+			"for the MigrationRequests that don't set one. Unlimited when empty.")
+	flag.IntVar(&nodeAgentPort, "node-agent-port", agent.DefaultPort, "The port the node agents listen on.")
+	flag.StringVar(&nodeAgentCertDir, "node-agent-cert-dir", "/etc/node-agent/certs",
+		"The directory holding the client certificate the node agents are called with and their CA, as tls.crt, tls.key and ca.crt.")
 	opts := zap.Options{
 		Development: true,
 	}
@@ -74,6 +79,16 @@ func main() {
 
 	ctrl.SetLogger(zap.New(zap.UseFlagOptions(&opts)))
 
+	var bandwidthLimit *resource.Quantity
+	if defaultBandwidthLimit != "" {
+		limit, err := resource.ParseQuantity(defaultBandwidthLimit)
+		if err != nil {
+			setupLog.Error(err, "invalid default bandwidth limit")
+			os.Exit(1)
+		}
+		bandwidthLimit = &limit
+	}
+
 	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
 		Scheme:                 scheme,
 		MetricsBindAddress:     metricsAddr,
@@ -98,22 +113,79 @@ func main() {
 		os.Exit(1)
 	}
 
+	// The connections to the node agents are shared by the controllers
+	nodeAgentCredentials, err := agent.CertDir(nodeAgentCertDir).ClientCredentials()
+	if err != nil {
+		setupLog.Error(err, "unable to load the node agent client certificate")
+		os.Exit(1)
+	}
+	nodeAgents := &controllers.NodeAgents{Clients: agent.NewClients(nodeAgentCredentials), Port: nodeAgentPort}
+	remoteClusters := controllers.NewRemoteClusters(mgr.GetScheme())
+	podExec, err := controllers.NewPodExec(mgr.GetConfig())
+	if err != nil {
+		setupLog.Error(err, "unable to create the pod exec client")
+		os.Exit(1)
+	}
+
 	if err = (&controllers.MigrationRequestReconciler{
-		Client:     mgr.GetClient(),
-		Scheme:     mgr.GetScheme(),
-		CachedData: make(map[string]controllers.CachedResources), // Initialize the cached data map
-		Informers:  setupInformers(),
+		Client:                mgr.GetClient(),
+		Scheme:                mgr.GetScheme(),
+		Agents:                nodeAgents,
+		Remotes:               remoteClusters,
+		Exec:                  podExec,
+		DefaultBandwidthLimit: bandwidthLimit,
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "MigrationRequest")
 		os.Exit(1)
 	}
 	if err = (&controllers.RestoreRequestReconciler{
+		Client:  mgr.GetClient(),
+		Scheme:  mgr.GetScheme(),
+		Agents:  nodeAgents,
+		Remotes: remoteClusters,
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "RestoreRequest")
+		os.Exit(1)
+	}
+	if err = (&controllers.MigrationTargetReconciler{
+		Client:  mgr.GetClient(),
+		Scheme:  mgr.GetScheme(),
+		Agents:  nodeAgents,
+		Remotes: remoteClusters,
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "MigrationTarget")
+		os.Exit(1)
+	}
+	if err = (&controllers.StatefulSetMigrationReconciler{
 		Client: mgr.GetClient(),
 		Scheme: mgr.GetScheme(),
 	}).SetupWithManager(mgr); err != nil {
-		setupLog.Error(err, "unable to create controller", "controller", "RestoreRequest")
+		setupLog.Error(err, "unable to create controller", "controller", "StatefulSetMigration")
 		os.Exit(1)
 	}
+	// The webhooks need a serving certificate, ENABLE_WEBHOOKS=false runs the controllers without them
+	if os.Getenv("ENABLE_WEBHOOKS") != "false" {
+		if err = (&apiv1.MigrationRequest{}).SetupWebhookWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "MigrationRequest")
+			os.Exit(1)
+		}
+		if err = (&apiv1.RestoreRequest{}).SetupWebhookWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "RestoreRequest")
+			os.Exit(1)
+		}
+		if err = (&apiv1.StatefulSetMigration{}).SetupWebhookWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "StatefulSetMigration")
+			os.Exit(1)
+		}
+		if err = apiv1.SetupPodWebhookWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "Pod")
+			os.Exit(1)
+		}
+		if err = apiv1.SetupPersistentVolumeClaimWebhookWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "PersistentVolumeClaim")
+			os.Exit(1)
+		}
+	}
 	//+kubebuilder:scaffold:builder
 
 	if err := mgr.AddHealthzCheck("healthz", healthz.Ping); err != nil {
@@ -131,26 +203,3 @@ func main() {
 		os.Exit(1)
 	}
 }
-
-func setupInformers() informers.SharedInformerFactory {
-	// Path to the kubeconfig file
-	kubeconfigPath := filepath.Join(homedir.HomeDir(), ".kube", "config")
-
-	// Load the kubeconfig file
-	config, err := clientcmd.BuildConfigFromFlags("", kubeconfigPath)
-	if err != nil {
-		// Handle error
-		fmt.Println(err.Error())
-	}
-
-	// Create the Kubernetes clientset
-	clientset, err := kubernetes.NewForConfig(config)
-	if err != nil {
-		// Handle error
-		fmt.Println(err.Error())
-	}
-
-	informers := informers.NewSharedInformerFactory(clientset, 0)
-
-	return informers
-}